@@ -0,0 +1,68 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// AccountBalance represents the funds of your Bhojpur Subscription account,
+// per currency. Funds are pending until they become available, and are then
+// paid out.
+type AccountBalance struct {
+	Available []*BalanceAmount `json:"available"`
+	Pending   []*BalanceAmount `json:"pending"`
+	Livemode  bool             `json:"livemode"`
+}
+
+// BalanceAmount represents the funds of an AccountBalance in a single currency.
+type BalanceAmount struct {
+	Amount   Money  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func (self *BalanceAmount) UnmarshalJSON(data []byte) error {
+	type balanceAmount BalanceAmount
+	if err := json.Unmarshal(data, (*balanceAmount)(self)); err != nil {
+		return err
+	}
+	setCurrency(self.Currency, &self.Amount)
+	return nil
+}
+
+// BalanceClient encapsulates operations for querying the balance of your
+// account using the Bhojpur Subscription REST API.
+type BalanceClient struct {
+	client *Client
+}
+
+// Retrieves the current AccountBalance of your account.
+func (self *BalanceClient) Retrieve() (*AccountBalance, error) {
+	return self.RetrieveCtx(context.Background())
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *BalanceClient) RetrieveCtx(ctx context.Context) (*AccountBalance, error) {
+	balance := AccountBalance{}
+	err := self.client.query(ctx, "GET", "/v1/balance", nil, &balance)
+	return &balance, err
+}
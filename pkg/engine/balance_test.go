@@ -0,0 +1,131 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+	"time"
+)
+
+// pending returns the pending funds of the balance in the currency.
+func pending(balance *AccountBalance, currency string) int64 {
+	for _, funds := range balance.Pending {
+		if funds.Currency == currency {
+			return funds.Amount.Amount
+		}
+	}
+	return 0
+}
+
+// TestRetrieveBalance will test that the funds of a charge, less its fees and
+// refunds, are pending in the balance.
+func TestRetrieveBalance(t *testing.T) {
+	before, err := Balance.Retrieve()
+	if err != nil {
+		t.Errorf("Expected Balance, got Error %s", err.Error())
+		return
+	}
+
+	charge, _ := Charges.Create(&charge1)
+	Refunds.Create(&RefundParams{Charge: charge.ID, Amount: Money{Amount: 50, Currency: INR}})
+
+	// an uncaptured charge that is released does not change the balance
+	capture := false
+	params := charge1
+	params.Capture = &capture
+	uncaptured, _ := Charges.Create(&params)
+	Charges.Release(uncaptured.ID)
+
+	after, err := Balance.Retrieve()
+	if err != nil {
+		t.Errorf("Expected Balance, got Error %s", err.Error())
+		return
+	}
+	expected := charge.Amount.Amount - charge.Fee.Amount - 50
+	if got := pending(after, INR) - pending(before, INR); got != expected {
+		t.Errorf("Expected %d more pending funds, got %d", expected, got)
+	}
+	if len(after.Available) != len(after.Pending) || after.Available[0].Amount.Amount != 0 {
+		t.Errorf("Expected no available funds yet, got %+v", after.Available)
+	}
+}
+
+// TestBalanceTransactions will test that charges and refunds are recorded as
+// balance transactions, which link back to them.
+func TestBalanceTransactions(t *testing.T) {
+	charge, _ := Charges.Create(&charge1)
+	if charge.BalanceTransaction == "" {
+		t.Error("Expected Charge to link to its Balance Transaction")
+		return
+	}
+	txn, err := BalanceTransactions.Retrieve(string(charge.BalanceTransaction))
+	if err != nil {
+		t.Errorf("Expected Balance Transaction, got Error %s", err.Error())
+		return
+	}
+	if txn.Type != BalanceTransactionCharge || txn.Source != charge.ID || txn.Amount != charge.Amount {
+		t.Errorf("Expected %s charge Transaction of %v, got %s %s of %v", charge.ID, charge.Amount, txn.Source, txn.Type, txn.Amount)
+	}
+	if txn.Fee != charge.Fee || len(txn.FeeDetails) != 1 || txn.Net.Amount != charge.Amount.Amount-charge.Fee.Amount {
+		t.Errorf("Expected fee %v, got fee %v and net %v", charge.Fee, txn.Fee, txn.Net)
+	}
+	if txn.Status != BalanceTransactionPending || txn.AvailableOn <= txn.Created {
+		t.Errorf("Expected pending Transaction, got %s available on %d", txn.Status, txn.AvailableOn)
+	}
+
+	refund, _ := Refunds.Create(&RefundParams{Charge: charge.ID, Amount: Money{Amount: 80, Currency: INR}})
+	txns, err := BalanceTransactions.ListFiltered(&BalanceTransactionListParams{Type: BalanceTransactionRefund, Source: refund.ID}, 10, 0)
+	if err != nil {
+		t.Errorf("Expected Balance Transactions, got Error %s", err.Error())
+		return
+	}
+	if len(txns) != 1 || txns[0].ID != string(refund.BalanceTransaction) || txns[0].Net.Amount != -80 {
+		t.Errorf("Expected the Balance Transaction of the Refund, got %d Transactions", len(txns))
+	}
+	if txns, _ := BalanceTransactions.SourceList(charge.ID); len(txns) != 1 || txns[0].ID != txn.ID {
+		t.Errorf("Expected the Balance Transaction of the Charge, got %d Transactions", len(txns))
+	}
+
+	// only transactions that become available within the range are listed
+	tomorrow := time.Now().Add(24 * time.Hour).Unix()
+	params := BalanceTransactionListParams{Source: charge.ID, AvailableOn: &RangeQuery{LT: tomorrow}}
+	if txns, _ := BalanceTransactions.ListFiltered(&params, 10, 0); len(txns) != 0 {
+		t.Errorf("Expected no Balance Transactions available by tomorrow, got %d", len(txns))
+	}
+	params.AvailableOn = &RangeQuery{GT: tomorrow}
+	if txns, _ := BalanceTransactions.ListFiltered(&params, 10, 0); len(txns) != 1 {
+		t.Errorf("Expected one Balance Transaction available after tomorrow, got %d", len(txns))
+	}
+}
+
+// TestDisputeBalanceTransaction will test that the amount of a dispute is
+// withdrawn from the balance.
+func TestDisputeBalanceTransaction(t *testing.T) {
+	charge, _ := disputedCharge("4000000000000259")
+	txns, err := BalanceTransactions.ListFiltered(&BalanceTransactionListParams{Source: string(charge.Dispute)}, 10, 0)
+	if err != nil {
+		t.Errorf("Expected Balance Transactions, got Error %s", err.Error())
+		return
+	}
+	if len(txns) != 1 || txns[0].Type != BalanceTransactionAdjustment || txns[0].Amount.Amount != -charge.Amount.Amount {
+		t.Errorf("Expected an adjustment of -%v, got %d Transactions", charge.Amount, len(txns))
+	}
+}
@@ -0,0 +1,235 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+)
+
+// Balance Transaction Types
+const (
+	BalanceTransactionCharge     = "charge"
+	BalanceTransactionRefund     = "refund"
+	BalanceTransactionAdjustment = "adjustment"
+)
+
+// Balance Transaction Statuses
+const (
+	BalanceTransactionPending   = "pending"
+	BalanceTransactionAvailable = "available"
+)
+
+// BalanceTransaction represents a single change to the AccountBalance of
+// your account, such as the funds of a Charge, less its fees, or a Refund.
+// Source is the ID of the Charge, Refund or Dispute that caused it.
+type BalanceTransaction struct {
+	ID          string        `json:"id"`
+	Type        string        `json:"type"`
+	Amount      Money         `json:"amount"`
+	Currency    string        `json:"currency"`
+	Fee         Money         `json:"fee"`
+	FeeDetails  []*FeeDetails `json:"fee_details"`
+	Net         Money         `json:"net"`
+	Source      string        `json:"source"`
+	Status      string        `json:"status"`
+	Desc        String        `json:"description"`
+	Created     int64         `json:"created"`
+	AvailableOn int64         `json:"available_on"`
+}
+
+func (self *BalanceTransaction) UnmarshalJSON(data []byte) error {
+	type balanceTransaction BalanceTransaction
+	if err := json.Unmarshal(data, (*balanceTransaction)(self)); err != nil {
+		return err
+	}
+	setCurrency(self.Currency, &self.Amount, &self.Fee, &self.Net)
+	return nil
+}
+
+// BalanceTransactionListParams encapsulates options for filtering a list of
+// Balance Transactions. The paging options of the embedded ListParams are only
+// used by Iter.
+type BalanceTransactionListParams struct {
+	ListParams
+
+	// (Optional) Only return transactions of this type, e.g.
+	// BalanceTransactionCharge.
+	Type string
+
+	// (Optional) Only return transactions caused by the charge, refund or
+	// dispute with this ID.
+	Source string
+
+	// (Optional) Only return transactions whose funds become available within
+	// this range of UTC timestamps.
+	AvailableOn *RangeQuery
+
+	// (Optional) Only return transactions created within this range of UTC
+	// timestamps.
+	Created *RangeQuery
+}
+
+// listBalanceTransactionsResp is the wrapper for a list of Balance
+// Transactions, so that we can cleanly parse the JSON.
+type listBalanceTransactionsResp struct {
+	ListMeta
+	Data []*BalanceTransaction `json:"data"`
+}
+
+// BalanceTransactionClient encapsulates operations for querying the balance
+// transactions of your account using the Bhojpur Subscription REST API.
+type BalanceTransactionClient struct {
+	client *Client
+}
+
+// Retrieves the Balance Transaction with the given ID.
+func (self *BalanceTransactionClient) Retrieve(id string) (*BalanceTransaction, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *BalanceTransactionClient) RetrieveCtx(ctx context.Context, id string) (*BalanceTransaction, error) {
+	txn := BalanceTransaction{}
+	path := "/v1/balance_transactions/" + url.QueryEscape(id)
+	err := self.client.query(ctx, "GET", path, nil, &txn)
+	return &txn, err
+}
+
+// Returns a list of your Balance Transactions, most recent first.
+func (self *BalanceTransactionClient) List() ([]*BalanceTransaction, error) {
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *BalanceTransactionClient) ListCtx(ctx context.Context) ([]*BalanceTransaction, error) {
+	return self.list(ctx, nil, 10, 0)
+}
+
+// Returns a list of your Balance Transactions at the specified range.
+func (self *BalanceTransactionClient) ListN(count int, offset int) ([]*BalanceTransaction, error) {
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *BalanceTransactionClient) ListNCtx(ctx context.Context, count int, offset int) ([]*BalanceTransaction, error) {
+	return self.list(ctx, nil, count, offset)
+}
+
+// Returns a list of the Balance Transactions caused by the Charge, Refund or
+// Dispute with the given ID.
+func (self *BalanceTransactionClient) SourceList(id string) ([]*BalanceTransaction, error) {
+	return self.SourceListCtx(context.Background(), id)
+}
+
+// SourceListCtx is like SourceList, but uses ctx for the API request.
+func (self *BalanceTransactionClient) SourceListCtx(ctx context.Context, id string) ([]*BalanceTransaction, error) {
+	return self.list(ctx, &BalanceTransactionListParams{Source: id}, 10, 0)
+}
+
+// Returns a list of your Balance Transactions matching the given filters, at
+// the specified range.
+func (self *BalanceTransactionClient) ListFiltered(params *BalanceTransactionListParams, count int, offset int) ([]*BalanceTransaction, error) {
+	return self.ListFilteredCtx(context.Background(), params, count, offset)
+}
+
+// ListFilteredCtx is like ListFiltered, but uses ctx for the API request.
+func (self *BalanceTransactionClient) ListFilteredCtx(ctx context.Context, params *BalanceTransactionListParams, count int, offset int) ([]*BalanceTransaction, error) {
+	return self.list(ctx, params, count, offset)
+}
+
+func (self *BalanceTransactionClient) list(ctx context.Context, params *BalanceTransactionListParams, count int, offset int) ([]*BalanceTransaction, error) {
+	resp := listBalanceTransactionsResp{}
+
+	// add the count and offset to the list of url values
+	values := url.Values{
+		"count":  {strconv.Itoa(count)},
+		"offset": {strconv.Itoa(offset)},
+	}
+
+	// add the filters, if provided
+	if params != nil {
+		appendBalanceTransactionListParamsToValues(params, &values)
+	}
+
+	err := self.client.query(ctx, "GET", "/v1/balance_transactions", values, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Iter returns an iterator that lazily pages through all of your Balance
+// Transactions matching the filters in params, starting at its cursor, if any.
+func (self *BalanceTransactionClient) Iter(params *BalanceTransactionListParams) *BalanceTransactionIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *BalanceTransactionClient) IterCtx(ctx context.Context, params *BalanceTransactionListParams) *BalanceTransactionIter {
+	values := url.Values{}
+	var list *ListParams
+	if params != nil {
+		appendBalanceTransactionListParamsToValues(params, &values)
+		list = &params.ListParams
+	}
+	return &BalanceTransactionIter{newIter(list, values, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listBalanceTransactionsResp{}
+		err := self.client.query(ctx, "GET", "/v1/balance_transactions", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, txn := range resp.Data {
+			items[i] = txn
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// BalanceTransactionIter is an iterator over a list of Balance Transactions.
+type BalanceTransactionIter struct {
+	*Iter
+}
+
+// Current returns the BalanceTransaction at the current position of the
+// iterator.
+func (it *BalanceTransactionIter) Current() *BalanceTransaction {
+	txn, _ := it.Iter.Current().(*BalanceTransaction)
+	return txn
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helper Function(s)
+
+func appendBalanceTransactionListParamsToValues(params *BalanceTransactionListParams, values *url.Values) {
+	if params.Type != "" {
+		values.Add("type", params.Type)
+	}
+	if params.Source != "" {
+		values.Add("source", params.Source)
+	}
+	if params.AvailableOn != nil {
+		appendRangeQueryToValues("available_on", params.AvailableOn, values)
+	}
+	if params.Created != nil {
+		appendRangeQueryToValues("created", params.Created, values)
+	}
+}
@@ -21,6 +21,7 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
 	"net/url"
 	"strconv"
 	"strings"
@@ -94,22 +95,34 @@ type CardParams struct {
 
 // CardClient encapsulates operations for creating, updating, deleting and
 // querying cards using the Bhojpur Subscription REST API.
-type CardClient struct{}
+type CardClient struct {
+	client *Client
+}
 
 func (self *CardClient) Create(c *CardParams, customerId string) (*Card, error) {
+	return self.CreateCtx(context.Background(), c, customerId)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *CardClient) CreateCtx(ctx context.Context, c *CardParams, customerId string) (*Card, error) {
 	card := Card{}
 	values := url.Values{}
 	appendCardParamsToValues(c, &values)
 
-	err := query("POST", "/v1/customers/"+customerId+"/cards", values, &card)
+	err := self.client.query(ctx, "POST", "/v1/customers/"+customerId+"/cards", values, &card)
 	return &card, err
 }
 
 func (self *CardClient) Delete(cardId string, customerId string) (*DeleteResp, error) {
+	return self.DeleteCtx(context.Background(), cardId, customerId)
+}
+
+// DeleteCtx is like Delete, but uses ctx for the API request.
+func (self *CardClient) DeleteCtx(ctx context.Context, cardId string, customerId string) (*DeleteResp, error) {
 	delResponse := DeleteResp{}
 	values := url.Values{}
 
-	err := query("DELETE", "/v1/customers/"+customerId+"/cards/"+cardId, values, &delResponse)
+	err := self.client.query(ctx, "DELETE", "/v1/customers/"+customerId+"/cards/"+cardId, values, &delResponse)
 	return &delResponse, err
 }
 
@@ -21,6 +21,8 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
+	"encoding/json"
 	"net/url"
 	"strconv"
 )
@@ -38,43 +40,82 @@ const (
 	AUD = "aud" // Australian Dollar (A$)
 )
 
+// Fraud Reports, for ChargeParams.FraudReport.
+const (
+	FraudReportSafe       = "safe"
+	FraudReportFraudulent = "fraudulent"
+)
+
 // Charge represents details about a credit card charge in Bhojpur subscription.
 type Charge struct {
-	ID                   string        `json:"id"`
-	Desc                 String        `json:"description"`
-	Amount               float64       `json:"amount"`
-	Card                 *Card         `json:"card"`
-	Currency             string        `json:"currency"`
-	Created              int64         `json:"created"`
-	Customer             String        `json:"customer"`
-	Invoice              String        `json:"invoice"`
-	Fee                  float64       `json:"fee"`
-	Paid                 bool          `json:"paid"`
-	Details              []*FeeDetails `json:"fee_details"`
-	Refunded             bool          `json:"refunded"`
-	AmountRefunded       float64       `json:"amount_refunded"`
-	FailureMessage       String        `json:"failure_message"`
-	Disputed             bool          `json:"disputed"`
-	Livemode             bool          `json:"livemode"`
-	StatementDescription string        `json:"statement_description"`
+	ID                   string            `json:"id"`
+	Desc                 String            `json:"description"`
+	Amount               Money             `json:"amount"`
+	Card                 *Card             `json:"card"`
+	Currency             string            `json:"currency"`
+	Created              int64             `json:"created"`
+	Customer             String            `json:"customer"`
+	Invoice              String            `json:"invoice"`
+	Fee                  Money             `json:"fee"`
+	Paid                 bool              `json:"paid"`
+	Captured             bool              `json:"captured"`
+	AmountCaptured       Money             `json:"amount_captured"`
+	CaptureBefore        Int64             `json:"capture_before"`
+	Details              []*FeeDetails     `json:"fee_details"`
+	BalanceTransaction   String            `json:"balance_transaction"`
+	Refunded             bool              `json:"refunded"`
+	AmountRefunded       Money             `json:"amount_refunded"`
+	Refunds              *RefundList       `json:"refunds"`
+	FailureMessage       String            `json:"failure_message"`
+	Disputed             bool              `json:"disputed"`
+	Dispute              String            `json:"dispute"`
+	ReceiptEmail         String            `json:"receipt_email"`
+	FraudDetails         *FraudDetails     `json:"fraud_details"`
+	Metadata             map[string]string `json:"metadata"`
+	Livemode             bool              `json:"livemode"`
+	StatementDescription string            `json:"statement_description"`
+}
+
+// FraudDetails holds the assessments of whether a Charge is fraudulent, each
+// either FraudReportSafe, FraudReportFraudulent or empty.
+type FraudDetails struct {
+	UserReport    String `json:"user_report"`
+	BhojpurReport String `json:"bhojpur_report"`
 }
 
 // FeeDetails represents a single fee associated with a Charge.
 type FeeDetails struct {
-	Amount      float64 `json:"amount"`
-	Currency    string  `json:"currency"`
-	Type        string  `json:"type"`
-	Application String  `json:"application"`
+	Amount      Money  `json:"amount"`
+	Currency    string `json:"currency"`
+	Type        string `json:"type"`
+	Application String `json:"application"`
 }
 
-// ChargeParams encapsulates options for creating a new Charge.
-type ChargeParams struct {
-	// A positive integer in paisa representing how much to charge the card.
-	// The minimum amount is 50 paisa.
-	Amount float64
+func (self *Charge) UnmarshalJSON(data []byte) error {
+	type charge Charge
+	if err := json.Unmarshal(data, (*charge)(self)); err != nil {
+		return err
+	}
+	setCurrency(self.Currency, &self.Amount, &self.Fee, &self.AmountRefunded, &self.AmountCaptured)
+	return nil
+}
 
-	// 3-letter ISO code for currency.
-	Currency string
+func (self *FeeDetails) UnmarshalJSON(data []byte) error {
+	type feeDetails FeeDetails
+	if err := json.Unmarshal(data, (*feeDetails)(self)); err != nil {
+		return err
+	}
+	setCurrency(self.Currency, &self.Amount)
+	return nil
+}
+
+// ChargeParams encapsulates options for creating a new Charge, or updating
+// one.
+type ChargeParams struct {
+	// A positive amount in the smallest currency unit representing how much
+	// to charge the card, and the currency to charge it in. The minimum amount
+	// is 50 paisa.
+	Amount Money
 
 	// (Optional) Either customer or card is required, but not both The ID of an
 	// existing customer that will be charged in this request.
@@ -100,18 +141,80 @@ type ChargeParams struct {
 	// banks display this information consistently, some may display it
 	// incorrectly or not at all.
 	StatementDescription string
+
+	// (Optional) The email address to send the receipt of the charge to.
+	ReceiptEmail string
+
+	// (Optional) Set of key/value pairs to attach to the charge, such as the
+	// ID of an order. A blank value removes the key on update.
+	Metadata map[string]string
+
+	// (Optional) Your assessment of the charge, either FraudReportSafe or
+	// FraudReportFraudulent, which improves the detection of fraud. Only used
+	// by Update.
+	FraudReport string
+
+	// (Optional) Whether to capture the charge immediately, which is the
+	// default. When false, the charge only authorizes the amount, which is
+	// captured with Charges.Capture or released with Charges.Release before
+	// the charge's CaptureBefore time. An uncaptured charge expires after 7
+	// days.
+	Capture *bool
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
+}
+
+// ChargeListParams encapsulates options for filtering a list of Charges. The
+// paging options of the embedded ListParams are only used by Iter.
+type ChargeListParams struct {
+	ListParams
+
+	// (Optional) Only return charges for the customer with this ID.
+	Customer string
+
+	// (Optional) Only return charges created within this range of UTC
+	// timestamps.
+	Created *RangeQuery
+
+	// (Optional) Only return charges that were, or were not, paid.
+	Paid *bool
+
+	// (Optional) Only return charges that were, or were not, refunded.
+	Refunded *bool
+
+	// (Optional) Only return charges in this 3-letter ISO currency.
+	Currency string
+
+	// (Optional) Only return charges for the invoice with this ID.
+	Invoice string
+}
+
+// listChargesResp is the wrapper for a list of Charges, so that we can cleanly
+// parse the JSON.
+type listChargesResp struct {
+	ListMeta
+	Data []*Charge `json:"data"`
 }
 
 // ChargeClient encapsulates operations for creating, updating, deleting and
 // querying charges using the Bhojpur Subscription REST API.
-type ChargeClient struct{}
+type ChargeClient struct {
+	client *Client
+}
 
 // Creates a new credit card Charge.
 func (self *ChargeClient) Create(params *ChargeParams) (*Charge, error) {
+	return self.CreateCtx(context.Background(), params)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *ChargeClient) CreateCtx(ctx context.Context, params *ChargeParams) (*Charge, error) {
 	charge := Charge{}
 	values := url.Values{
-		"amount":      {strconv.FormatFloat(params.Amount, 'E', -1, 64)},
-		"currency":    {params.Currency},
+		"amount":      {params.Amount.encode()},
+		"currency":    {params.Amount.Currency},
 		"description": {params.Desc},
 	}
 
@@ -129,63 +232,163 @@ func (self *ChargeClient) Create(params *ChargeParams) (*Charge, error) {
 	if params.StatementDescription != "" {
 		values.Add("statement_description", params.StatementDescription)
 	}
+	if params.Capture != nil {
+		values.Add("capture", strconv.FormatBool(*params.Capture))
+	}
+	appendChargeParamsToValues(params, &values)
 
-	err := query("POST", "/v1/charges", values, &charge)
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/charges", params.IdempotencyKey, values, &charge)
 	return &charge, err
 }
 
 // Retrieves the details of a charge with the given ID.
 func (self *ChargeClient) Retrieve(id string) (*Charge, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *ChargeClient) RetrieveCtx(ctx context.Context, id string) (*Charge, error) {
 	charge := Charge{}
 	path := "/v1/charges/" + url.QueryEscape(id)
-	err := query("GET", path, nil, &charge)
+	err := self.client.query(ctx, "GET", path, nil, &charge)
 	return &charge, err
 }
 
-// Refunds a charge for the full amount.
+// Updates the description, receipt email, metadata or fraud report of the
+// charge with the given ID.
+func (self *ChargeClient) Update(id string, params *ChargeParams) (*Charge, error) {
+	return self.UpdateCtx(context.Background(), id, params)
+}
+
+// UpdateCtx is like Update, but uses ctx for the API request.
+func (self *ChargeClient) UpdateCtx(ctx context.Context, id string, params *ChargeParams) (*Charge, error) {
+	charge := Charge{}
+	values := url.Values{}
+	if params.Desc != "" {
+		values.Add("description", params.Desc)
+	}
+	if params.FraudReport != "" {
+		values.Add("fraud_details[user_report]", params.FraudReport)
+	}
+	appendChargeParamsToValues(params, &values)
+
+	path := "/v1/charges/" + url.QueryEscape(id)
+	err := self.client.queryIdempotent(ctx, "POST", path, params.IdempotencyKey, values, &charge)
+	return &charge, err
+}
+
+// Refunds a charge for the full amount. Use Refunds.Create to give a reason
+// for the refund.
 func (self *ChargeClient) Refund(id string) (*Charge, error) {
+	return self.RefundCtx(context.Background(), id)
+}
+
+// RefundCtx is like Refund, but uses ctx for the API request.
+func (self *ChargeClient) RefundCtx(ctx context.Context, id string) (*Charge, error) {
 	values := url.Values{}
 	charge := Charge{}
 	path := "/v1/charges/" + url.QueryEscape(id) + "/refund"
-	err := query("POST", path, values, &charge)
+	err := self.client.query(ctx, "POST", path, values, &charge)
 	return &charge, err
 }
 
-// Refunds a charge for the specified amount.
-func (self *ChargeClient) RefundAmount(id string, amt float64) (*Charge, error) {
+// Refunds a charge for the specified amount, in the currency of the charge.
+func (self *ChargeClient) RefundAmount(id string, amount Money) (*Charge, error) {
+	return self.RefundAmountCtx(context.Background(), id, amount)
+}
+
+// RefundAmountCtx is like RefundAmount, but uses ctx for the API request.
+func (self *ChargeClient) RefundAmountCtx(ctx context.Context, id string, amount Money) (*Charge, error) {
 	values := url.Values{
-		"amount": {strconv.FormatFloat(amt, 'E', -1, 64)},
+		"amount": {amount.encode()},
 	}
 	charge := Charge{}
 	path := "/v1/charges/" + url.QueryEscape(id) + "/refund"
-	err := query("POST", path, values, &charge)
+	err := self.client.query(ctx, "POST", path, values, &charge)
 	return &charge, err
 }
 
+// Captures the uncaptured charge with the given ID. A non-zero amount
+// captures only part of the charge, and releases the rest.
+func (self *ChargeClient) Capture(id string, amount Money) (*Charge, error) {
+	return self.CaptureCtx(context.Background(), id, amount)
+}
+
+// CaptureCtx is like Capture, but uses ctx for the API request.
+func (self *ChargeClient) CaptureCtx(ctx context.Context, id string, amount Money) (*Charge, error) {
+	values := url.Values{}
+	if !amount.IsZero() {
+		values.Add("amount", amount.encode())
+	}
+	charge := Charge{}
+	path := "/v1/charges/" + url.QueryEscape(id) + "/capture"
+	err := self.client.query(ctx, "POST", path, values, &charge)
+	return &charge, err
+}
+
+// Releases the authorization of the uncaptured charge with the given ID, so
+// that it is never captured. The charge is refunded in full.
+func (self *ChargeClient) Release(id string) (*Charge, error) {
+	return self.ReleaseCtx(context.Background(), id)
+}
+
+// ReleaseCtx is like Release, but uses ctx for the API request.
+func (self *ChargeClient) ReleaseCtx(ctx context.Context, id string) (*Charge, error) {
+	return self.RefundCtx(ctx, id)
+}
+
 // Returns a list of your Charges.
 func (self *ChargeClient) List() ([]*Charge, error) {
-	return self.list("", 10, 0)
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *ChargeClient) ListCtx(ctx context.Context) ([]*Charge, error) {
+	return self.list(ctx, nil, 10, 0)
 }
 
 // Returns a list of your Charges with the specified range.
 func (self *ChargeClient) ListN(count int, offset int) ([]*Charge, error) {
-	return self.list("", count, offset)
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *ChargeClient) ListNCtx(ctx context.Context, count int, offset int) ([]*Charge, error) {
+	return self.list(ctx, nil, count, offset)
 }
 
 // Returns a list of your Charges with the given Customer ID.
 func (self *ChargeClient) CustomerList(id string) ([]*Charge, error) {
-	return self.list(id, 10, 0)
+	return self.CustomerListCtx(context.Background(), id)
+}
+
+// CustomerListCtx is like CustomerList, but uses ctx for the API request.
+func (self *ChargeClient) CustomerListCtx(ctx context.Context, id string) ([]*Charge, error) {
+	return self.list(ctx, &ChargeListParams{Customer: id}, 10, 0)
 }
 
 // Returns a list of your Charges with the given Customer ID and range.
 func (self *ChargeClient) CustomerListN(id string, count int, offset int) ([]*Charge, error) {
-	return self.list(id, count, offset)
+	return self.CustomerListNCtx(context.Background(), id, count, offset)
+}
+
+// CustomerListNCtx is like CustomerListN, but uses ctx for the API request.
+func (self *ChargeClient) CustomerListNCtx(ctx context.Context, id string, count int, offset int) ([]*Charge, error) {
+	return self.list(ctx, &ChargeListParams{Customer: id}, count, offset)
+}
+
+// Returns a list of your Charges matching the given filters, at the specified
+// range.
+func (self *ChargeClient) ListFiltered(params *ChargeListParams, count int, offset int) ([]*Charge, error) {
+	return self.ListFilteredCtx(context.Background(), params, count, offset)
+}
+
+// ListFilteredCtx is like ListFiltered, but uses ctx for the API request.
+func (self *ChargeClient) ListFilteredCtx(ctx context.Context, params *ChargeListParams, count int, offset int) ([]*Charge, error) {
+	return self.list(ctx, params, count, offset)
 }
 
-func (self *ChargeClient) list(id string, count int, offset int) ([]*Charge, error) {
-	// define a wrapper function for the Charge List, so that we can
-	// cleanly parse the JSON
-	type listChargesResp struct{ Data []*Charge }
+func (self *ChargeClient) list(ctx context.Context, params *ChargeListParams, count int, offset int) ([]*Charge, error) {
 	resp := listChargesResp{}
 
 	// add the count and offset to the list of url values
@@ -194,14 +397,83 @@ func (self *ChargeClient) list(id string, count int, offset int) ([]*Charge, err
 		"offset": {strconv.Itoa(offset)},
 	}
 
-	// query for customer id, if provided
-	if id != "" {
-		values.Add("customer", id)
+	// add the filters, if provided
+	if params != nil {
+		appendChargeListParamsToValues(params, &values)
 	}
 
-	err := query("GET", "/v1/charges", values, &resp)
+	err := self.client.query(ctx, "GET", "/v1/charges", values, &resp)
 	if err != nil {
 		return nil, err
 	}
 	return resp.Data, nil
 }
+
+// Iter returns an iterator that lazily pages through all of your Charges
+// matching the filters in params, starting at its cursor, if any.
+func (self *ChargeClient) Iter(params *ChargeListParams) *ChargeIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *ChargeClient) IterCtx(ctx context.Context, params *ChargeListParams) *ChargeIter {
+	values := url.Values{}
+	var list *ListParams
+	if params != nil {
+		appendChargeListParamsToValues(params, &values)
+		list = &params.ListParams
+	}
+	return &ChargeIter{newIter(list, values, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listChargesResp{}
+		err := self.client.query(ctx, "GET", "/v1/charges", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, charge := range resp.Data {
+			items[i] = charge
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// ChargeIter is an iterator over a list of Charges.
+type ChargeIter struct {
+	*Iter
+}
+
+// Current returns the Charge at the current position of the iterator.
+func (it *ChargeIter) Current() *Charge {
+	charge, _ := it.Iter.Current().(*Charge)
+	return charge
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helper Function(s)
+
+func appendChargeParamsToValues(params *ChargeParams, values *url.Values) {
+	if params.ReceiptEmail != "" {
+		values.Add("receipt_email", params.ReceiptEmail)
+	}
+	for k, v := range params.Metadata {
+		values.Add("metadata["+k+"]", v)
+	}
+}
+
+func appendChargeListParamsToValues(params *ChargeListParams, values *url.Values) {
+	if params.Customer != "" {
+		values.Add("customer", params.Customer)
+	}
+	if params.Created != nil {
+		appendRangeQueryToValues("created", params.Created, values)
+	}
+	if params.Paid != nil {
+		values.Add("paid", strconv.FormatBool(*params.Paid))
+	}
+	if params.Refunded != nil {
+		values.Add("refunded", strconv.FormatBool(*params.Refunded))
+	}
+	if params.Currency != "" {
+		values.Add("currency", params.Currency)
+	}
+	if params.Invoice != "" {
+		values.Add("invoice", params.Invoice)
+	}
+}
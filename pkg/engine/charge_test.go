@@ -25,22 +25,13 @@ import (
 	"time"
 )
 
-func init() {
-	// In order to execute Unit Test, you must set your Bhojpur API Key as
-	// environment variable, BHOJPUR_API_KEY=xxxx
-	if err := SetKeyEnv(); err != nil {
-		panic(err)
-	}
-}
-
 // Sample Charges to use when creating, deleting, updating Charge data.
 var (
 
 	// Charge with only the required fields
 	charge1 = ChargeParams{
-		Desc:     "Litti Chokha",
-		Amount:   200,
-		Currency: INR,
+		Desc:   "Litti Chokha",
+		Amount: Money{Amount: 200, Currency: INR},
 		Card: &CardParams{
 			Name:     "Pramila Kumari",
 			Number:   "4242424242424242",
@@ -87,10 +78,9 @@ func TestCreateChargeToken(t *testing.T) {
 
 	// Create a Charge that uses a Token
 	charge := ChargeParams{
-		Desc:     "Litti Chokha",
-		Amount:   400,
-		Currency: INR,
-		Token:    token.ID,
+		Desc:   "Litti Chokha",
+		Amount: Money{Amount: 400, Currency: INR},
+		Token:  token.ID,
 	}
 
 	// Create the charge
@@ -116,8 +106,7 @@ func TestCreateChargeCustomer(t *testing.T) {
 	// Create a Charge that uses a Token
 	charge := ChargeParams{
 		Desc:     "Litti Chokha",
-		Amount:   200,
-		Currency: INR,
+		Amount:   Money{Amount: 200, Currency: INR},
 		Customer: cust.ID,
 	}
 
@@ -162,8 +151,113 @@ func TestRefundCharge(t *testing.T) {
 	if charge.Refunded == false {
 		t.Errorf("Expected Refund, however Refund flag was set to false")
 	}
-	if float64(charge.AmountRefunded) != charge1.Amount {
-		t.Errorf("Expected AmountRefunded %v, but got %v", charge1.Amount, int64(charge.AmountRefunded))
+	if charge.AmountRefunded != charge1.Amount {
+		t.Errorf("Expected AmountRefunded %v, but got %v", charge1.Amount, charge.AmountRefunded)
+		return
+	}
+}
+
+// TestCaptureCharge will test that an uncaptured charge only holds the
+// amount until it is captured, in full or in part.
+func TestCaptureCharge(t *testing.T) {
+	capture := false
+	params := charge1
+	params.Amount = Money{Amount: 1000, Currency: INR}
+	params.Capture = &capture
+
+	charge, err := Charges.Create(&params)
+	if err != nil {
+		t.Errorf("Expected uncaptured Charge, got Error %s", err.Error())
+		return
+	}
+	if charge.Captured || !charge.AmountCaptured.IsZero() || !charge.Fee.IsZero() {
+		t.Errorf("Expected uncaptured Charge without a fee, got %v captured and a fee of %v", charge.AmountCaptured, charge.Fee)
+	}
+	if want := charge.Created + 7*24*60*60; int64(charge.CaptureBefore) != want {
+		t.Errorf("Expected Charge to expire at %d, got %d", want, charge.CaptureBefore)
+	}
+
+	charge, err = Charges.Capture(charge.ID, Money{Amount: 600, Currency: INR})
+	if err != nil {
+		t.Errorf("Expected captured Charge, got Error %s", err.Error())
+		return
+	}
+	if !charge.Captured || charge.AmountCaptured.Amount != 600 || charge.AmountRefunded.Amount != 400 {
+		t.Errorf("Expected 600 captured and 400 released, got %d and %d", charge.AmountCaptured.Amount, charge.AmountRefunded.Amount)
+	}
+	if charge.Fee.Amount != 600*2/100+30 || charge.CaptureBefore != 0 {
+		t.Errorf("Expected fee on the captured amount, got %v", charge.Fee)
+	}
+	if _, err := Charges.Capture(charge.ID, Money{}); err == nil {
+		t.Error("Expected Error capturing a Charge twice")
+	}
+
+	// captured charges are captured in full
+	if charge, _ = Charges.Create(&charge1); !charge.Captured || charge.AmountCaptured != charge1.Amount {
+		t.Errorf("Expected Charge to be captured by default, got %v captured", charge.AmountCaptured)
+	}
+}
+
+// TestReleaseCharge will test that an uncaptured charge can be released, after
+// which it can no longer be captured.
+func TestReleaseCharge(t *testing.T) {
+	capture := false
+	params := charge1
+	params.Capture = &capture
+	charge, _ := Charges.Create(&params)
+
+	if _, err := Charges.RefundAmount(charge.ID, Money{Amount: 100, Currency: INR}); err == nil {
+		t.Error("Expected Error releasing part of an uncaptured Charge")
+	}
+	charge, err := Charges.Release(charge.ID)
+	if err != nil {
+		t.Errorf("Expected released Charge, got Error %s", err.Error())
 		return
 	}
+	if !charge.Refunded || charge.Captured || charge.AmountRefunded != charge.Amount {
+		t.Errorf("Expected Charge to be released in full, got %v refunded", charge.AmountRefunded)
+	}
+	if _, err := Charges.Capture(charge.ID, Money{}); err == nil {
+		t.Error("Expected Error capturing a released Charge")
+	}
+}
+
+// TestUpdateCharge will test that the description, receipt email and
+// metadata of a charge can be updated, and that it can be reported as
+// fraudulent.
+func TestUpdateCharge(t *testing.T) {
+	params := charge1
+	params.Metadata = map[string]string{"order": "1001"}
+	charge, err := Charges.Create(&params)
+	if err != nil {
+		t.Errorf("Expected Charge, got Error %s", err.Error())
+		return
+	}
+	if charge.Metadata["order"] != "1001" {
+		t.Errorf("Expected Charge metadata %v, got %v", params.Metadata, charge.Metadata)
+	}
+
+	update := ChargeParams{
+		Desc:         "Litti Chokha, extra ghee",
+		ReceiptEmail: "pramila@bhojpur.net",
+		Metadata:     map[string]string{"order": "", "shipment": "42"},
+		FraudReport:  FraudReportFraudulent,
+	}
+	charge, err = Charges.Update(charge.ID, &update)
+	if err != nil {
+		t.Errorf("Expected updated Charge, got Error %s", err.Error())
+		return
+	}
+	if charge.Desc != String(update.Desc) || charge.ReceiptEmail != String(update.ReceiptEmail) {
+		t.Errorf("Expected description and receipt email, got %s and %s", charge.Desc, charge.ReceiptEmail)
+	}
+	if _, ok := charge.Metadata["order"]; ok || charge.Metadata["shipment"] != "42" {
+		t.Errorf("Expected updated metadata, got %v", charge.Metadata)
+	}
+	if charge.FraudDetails == nil || charge.FraudDetails.UserReport != FraudReportFraudulent {
+		t.Errorf("Expected Charge reported as fraudulent, got %v", charge.FraudDetails)
+	}
+	if _, err := Charges.Update(charge.ID, &ChargeParams{FraudReport: "suspicious"}); err == nil {
+		t.Error("Expected Error for an invalid fraud report")
+	}
 }
@@ -21,6 +21,7 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
 	"net/url"
 	"strconv"
 )
@@ -44,9 +45,18 @@ type Coupon struct {
 	Livemode         bool   `json:"livemode"`
 }
 
+// listCouponResp is the wrapper for a list of Coupons, so that we can cleanly
+// parse the JSON.
+type listCouponResp struct {
+	ListMeta
+	Data []*Coupon `json:"data"`
+}
+
 // CouponClient encapsulates operations for creating, updating, deleting and
 // querying coupons using the Bhojpur Subscription REST API.
-type CouponClient struct{}
+type CouponClient struct {
+	client *Client
+}
 
 // CouponParams encapsulates options for creating a new Coupon.
 type CouponParams struct {
@@ -75,10 +85,19 @@ type CouponParams struct {
 	// be redeemed. After the redeem_by date, the coupon can no longer be
 	// applied to new customers.
 	RedeemBy int64
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
 }
 
 // Creates a new Coupon.
 func (self *CouponClient) Create(params *CouponParams) (*Coupon, error) {
+	return self.CreateCtx(context.Background(), params)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *CouponClient) CreateCtx(ctx context.Context, params *CouponParams) (*Coupon, error) {
 	coupon := Coupon{}
 	values := url.Values{
 		"duration":    {params.Duration},
@@ -104,23 +123,33 @@ func (self *CouponClient) Create(params *CouponParams) (*Coupon, error) {
 	if params.RedeemBy != 0 {
 		values.Add("redeem_by", strconv.FormatInt(params.RedeemBy, 10))
 	}
-	err := query("POST", "/v1/coupons", values, &coupon)
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/coupons", params.IdempotencyKey, values, &coupon)
 	return &coupon, err
 }
 
 // Retrieves the coupon with the given ID.
 func (self *CouponClient) Retrieve(id string) (*Coupon, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *CouponClient) RetrieveCtx(ctx context.Context, id string) (*Coupon, error) {
 	coupon := Coupon{}
 	path := "/v1/coupons/" + url.QueryEscape(id)
-	err := query("GET", path, nil, &coupon)
+	err := self.client.query(ctx, "GET", path, nil, &coupon)
 	return &coupon, err
 }
 
 // Deletes the coupon with the given ID.
 func (self *CouponClient) Delete(id string) (bool, error) {
+	return self.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx is like Delete, but uses ctx for the API request.
+func (self *CouponClient) DeleteCtx(ctx context.Context, id string) (bool, error) {
 	resp := DeleteResp{}
 	path := "/v1/coupons/" + url.QueryEscape(id)
-	if err := query("DELETE", path, nil, &resp); err != nil {
+	if err := self.client.query(ctx, "DELETE", path, nil, &resp); err != nil {
 		return false, err
 	}
 	return resp.Deleted, nil
@@ -128,14 +157,21 @@ func (self *CouponClient) Delete(id string) (bool, error) {
 
 // Returns a list of your coupons.
 func (self *CouponClient) List() ([]*Coupon, error) {
-	return self.ListN(10, 0)
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *CouponClient) ListCtx(ctx context.Context) ([]*Coupon, error) {
+	return self.ListNCtx(ctx, 10, 0)
 }
 
 // Returns a list of your coupons at the specified range.
 func (self *CouponClient) ListN(count int, offset int) ([]*Coupon, error) {
-	// define a wrapper function for the Coupon List, so that we can
-	// cleanly parse the JSON
-	type listCouponResp struct{ Data []*Coupon }
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *CouponClient) ListNCtx(ctx context.Context, count int, offset int) ([]*Coupon, error) {
 	resp := listCouponResp{}
 
 	// add the count and offset to the list of url values
@@ -144,9 +180,39 @@ func (self *CouponClient) ListN(count int, offset int) ([]*Coupon, error) {
 		"offset": {strconv.Itoa(offset)},
 	}
 
-	err := query("GET", "/v1/coupons", values, &resp)
+	err := self.client.query(ctx, "GET", "/v1/coupons", values, &resp)
 	if err != nil {
 		return nil, err
 	}
 	return resp.Data, nil
 }
+
+// Iter returns an iterator that lazily pages through all of your Coupons,
+// starting at the cursor given in params, if any.
+func (self *CouponClient) Iter(params *ListParams) *CouponIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *CouponClient) IterCtx(ctx context.Context, params *ListParams) *CouponIter {
+	return &CouponIter{newIter(params, url.Values{}, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listCouponResp{}
+		err := self.client.query(ctx, "GET", "/v1/coupons", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, coupon := range resp.Data {
+			items[i] = coupon
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// CouponIter is an iterator over a list of Coupons.
+type CouponIter struct {
+	*Iter
+}
+
+// Current returns the Coupon at the current position of the iterator.
+func (it *CouponIter) Current() *Coupon {
+	coupon, _ := it.Iter.Current().(*Coupon)
+	return coupon
+}
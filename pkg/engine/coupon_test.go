@@ -24,14 +24,6 @@ import (
 	"testing"
 )
 
-func init() {
-	// In order to execute Unit Test, you must set your Bhojpur API Key as
-	// environment variable, BHOJPUR_API_KEY=xxxx
-	if err := SetKeyEnv(); err != nil {
-		panic(err)
-	}
-}
-
 // Sample Coupons to use when creating, deleting, updating Coupon data.
 var (
 	// Coupon with only the required fields
@@ -158,6 +150,6 @@ func TestListCoupon(t *testing.T) {
 
 	// since we added two dummy coupons, we expect the array to be a size of 2
 	if len(coupons) != 2 {
-		t.Errorf("Expected two Coupons, got %s", len(coupons))
+		t.Errorf("Expected two Coupons, got %d", len(coupons))
 	}
 }
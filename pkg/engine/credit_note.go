@@ -0,0 +1,334 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+)
+
+// Credit Note Reasons
+const (
+	CreditNoteDuplicate             = "duplicate"
+	CreditNoteFraudulent            = "fraudulent"
+	CreditNoteOrderChange           = "order_change"
+	CreditNoteProductUnsatisfactory = "product_unsatisfactory"
+)
+
+// CreditNote represents an adjustment to a paid invoice, which is either
+// refunded to the card that paid the invoice, or credited to the customer's
+// account balance.
+type CreditNote struct {
+	ID           string            `json:"id"`
+	Invoice      string            `json:"invoice"`
+	Customer     string            `json:"customer"`
+	Amount       Money             `json:"amount"`
+	Currency     string            `json:"currency"`
+	Lines        []*CreditNoteLine `json:"lines"`
+	Reason       String            `json:"reason"`
+	Memo         String            `json:"memo"`
+	RefundAmount Money             `json:"refund_amount"`
+	Refund       String            `json:"refund"`
+	CreditAmount Money             `json:"credit_amount"`
+	Created      int64             `json:"created"`
+	Metadata     map[string]string `json:"metadata"`
+	Livemode     bool              `json:"livemode"`
+}
+
+// CreditNoteLine is the amount credited for a line of the invoice.
+type CreditNoteLine struct {
+	InvoiceLine string `json:"invoice_line_item"`
+	Amount      Money  `json:"amount"`
+	Desc        String `json:"description"`
+}
+
+func (self *CreditNote) UnmarshalJSON(data []byte) error {
+	type creditNote CreditNote
+	if err := json.Unmarshal(data, (*creditNote)(self)); err != nil {
+		return err
+	}
+	setCurrency(self.Currency, &self.Amount, &self.RefundAmount, &self.CreditAmount)
+	for _, line := range self.Lines {
+		setCurrency(self.Currency, &line.Amount)
+	}
+	return nil
+}
+
+// CreditNoteParams encapsulates options for issuing a Credit Note.
+type CreditNoteParams struct {
+	// The ID of the paid invoice to issue the credit note against.
+	Invoice string
+
+	// (Optional) The lines of the invoice to credit, and how much. When left
+	// blank, the Amount is credited instead.
+	Lines []*CreditNoteLineParams
+
+	// (Optional) The amount to credit, when no Lines are given.
+	Amount Money
+
+	// (Optional) The reason for issuing the credit note, one of
+	// CreditNoteDuplicate, CreditNoteFraudulent, CreditNoteOrderChange or
+	// CreditNoteProductUnsatisfactory.
+	Reason string
+
+	// (Optional) A note for the customer, displayed on the credit note.
+	Memo string
+
+	// (Optional) Whether to refund the amount to the card that paid the
+	// invoice. Otherwise, it is credited to the customer's account balance,
+	// to be applied to the next invoice.
+	Refund bool
+
+	// (Optional) Set of key/value pairs to attach to the credit note.
+	Metadata map[string]string
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
+}
+
+// CreditNoteLineParams encapsulates the amount to credit for a line of an
+// invoice.
+type CreditNoteLineParams struct {
+	// The ID of the InvoiceLine to credit.
+	InvoiceLine string
+
+	// (Optional) The amount to credit. Defaults to the amount of the line
+	// that was not credited yet.
+	Amount Money
+}
+
+// CreditNoteListParams encapsulates options for filtering a list of Credit
+// Notes. The paging options of the embedded ListParams are only used by Iter.
+type CreditNoteListParams struct {
+	ListParams
+
+	// (Optional) Only return credit notes for the invoice with this ID.
+	Invoice string
+
+	// (Optional) Only return credit notes for the customer with this ID.
+	Customer string
+}
+
+// listCreditNotesResp is the wrapper for a list of Credit Notes, so that we
+// can cleanly parse the JSON.
+type listCreditNotesResp struct {
+	ListMeta
+	Data []*CreditNote `json:"data"`
+}
+
+// CreditNoteClient encapsulates operations for issuing and querying credit
+// notes using the Bhojpur Subscription REST API.
+type CreditNoteClient struct {
+	client *Client
+}
+
+// Issues a new Credit Note against a paid invoice.
+func (self *CreditNoteClient) Create(params *CreditNoteParams) (*CreditNote, error) {
+	return self.CreateCtx(context.Background(), params)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *CreditNoteClient) CreateCtx(ctx context.Context, params *CreditNoteParams) (*CreditNote, error) {
+	note := CreditNote{}
+	values := url.Values{"invoice": {params.Invoice}}
+	appendCreditNoteParamsToValues(params, &values)
+
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/credit_notes", params.IdempotencyKey, values, &note)
+	return &note, err
+}
+
+// Preview returns the Credit Note that Create would issue for params, with
+// its amounts, without issuing it.
+func (self *CreditNoteClient) Preview(params *CreditNoteParams) (*CreditNote, error) {
+	return self.PreviewCtx(context.Background(), params)
+}
+
+// PreviewCtx is like Preview, but uses ctx for the API request.
+func (self *CreditNoteClient) PreviewCtx(ctx context.Context, params *CreditNoteParams) (*CreditNote, error) {
+	note := CreditNote{}
+	values := url.Values{"invoice": {params.Invoice}}
+	appendCreditNoteParamsToValues(params, &values)
+
+	err := self.client.query(ctx, "GET", "/v1/credit_notes/preview", values, &note)
+	return &note, err
+}
+
+// Retrieves the Credit Note with the given ID.
+func (self *CreditNoteClient) Retrieve(id string) (*CreditNote, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *CreditNoteClient) RetrieveCtx(ctx context.Context, id string) (*CreditNote, error) {
+	note := CreditNote{}
+	path := "/v1/credit_notes/" + url.QueryEscape(id)
+	err := self.client.query(ctx, "GET", path, nil, &note)
+	return &note, err
+}
+
+// Returns a list of your Credit Notes.
+func (self *CreditNoteClient) List() ([]*CreditNote, error) {
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *CreditNoteClient) ListCtx(ctx context.Context) ([]*CreditNote, error) {
+	return self.list(ctx, nil, 10, 0)
+}
+
+// Returns a list of your Credit Notes at the specified range.
+func (self *CreditNoteClient) ListN(count int, offset int) ([]*CreditNote, error) {
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *CreditNoteClient) ListNCtx(ctx context.Context, count int, offset int) ([]*CreditNote, error) {
+	return self.list(ctx, nil, count, offset)
+}
+
+// Returns a list of the Credit Notes issued against the invoice with the
+// given ID.
+func (self *CreditNoteClient) InvoiceList(id string) ([]*CreditNote, error) {
+	return self.InvoiceListCtx(context.Background(), id)
+}
+
+// InvoiceListCtx is like InvoiceList, but uses ctx for the API request.
+func (self *CreditNoteClient) InvoiceListCtx(ctx context.Context, id string) ([]*CreditNote, error) {
+	return self.list(ctx, &CreditNoteListParams{Invoice: id}, 10, 0)
+}
+
+// Returns a list of the Credit Notes of the customer with the given ID.
+func (self *CreditNoteClient) CustomerList(id string) ([]*CreditNote, error) {
+	return self.CustomerListCtx(context.Background(), id)
+}
+
+// CustomerListCtx is like CustomerList, but uses ctx for the API request.
+func (self *CreditNoteClient) CustomerListCtx(ctx context.Context, id string) ([]*CreditNote, error) {
+	return self.list(ctx, &CreditNoteListParams{Customer: id}, 10, 0)
+}
+
+// Returns a list of your Credit Notes matching the given filters, at the
+// specified range.
+func (self *CreditNoteClient) ListFiltered(params *CreditNoteListParams, count int, offset int) ([]*CreditNote, error) {
+	return self.ListFilteredCtx(context.Background(), params, count, offset)
+}
+
+// ListFilteredCtx is like ListFiltered, but uses ctx for the API request.
+func (self *CreditNoteClient) ListFilteredCtx(ctx context.Context, params *CreditNoteListParams, count int, offset int) ([]*CreditNote, error) {
+	return self.list(ctx, params, count, offset)
+}
+
+func (self *CreditNoteClient) list(ctx context.Context, params *CreditNoteListParams, count int, offset int) ([]*CreditNote, error) {
+	resp := listCreditNotesResp{}
+
+	// add the count and offset to the list of url values
+	values := url.Values{
+		"count":  {strconv.Itoa(count)},
+		"offset": {strconv.Itoa(offset)},
+	}
+
+	// add the filters, if provided
+	if params != nil {
+		appendCreditNoteListParamsToValues(params, &values)
+	}
+
+	err := self.client.query(ctx, "GET", "/v1/credit_notes", values, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Iter returns an iterator that lazily pages through all of your Credit Notes
+// matching the filters in params, starting at its cursor, if any.
+func (self *CreditNoteClient) Iter(params *CreditNoteListParams) *CreditNoteIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *CreditNoteClient) IterCtx(ctx context.Context, params *CreditNoteListParams) *CreditNoteIter {
+	values := url.Values{}
+	var list *ListParams
+	if params != nil {
+		appendCreditNoteListParamsToValues(params, &values)
+		list = &params.ListParams
+	}
+	return &CreditNoteIter{newIter(list, values, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listCreditNotesResp{}
+		err := self.client.query(ctx, "GET", "/v1/credit_notes", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, note := range resp.Data {
+			items[i] = note
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// CreditNoteIter is an iterator over a list of Credit Notes.
+type CreditNoteIter struct {
+	*Iter
+}
+
+// Current returns the Credit Note at the current position of the iterator.
+func (it *CreditNoteIter) Current() *CreditNote {
+	note, _ := it.Iter.Current().(*CreditNote)
+	return note
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helper Function(s)
+
+func appendCreditNoteParamsToValues(params *CreditNoteParams, values *url.Values) {
+	for i, line := range params.Lines {
+		prefix := "lines[" + strconv.Itoa(i) + "]"
+		values.Add(prefix+"[invoice_line_item]", line.InvoiceLine)
+		if !line.Amount.IsZero() {
+			values.Add(prefix+"[amount]", line.Amount.encode())
+		}
+	}
+	if !params.Amount.IsZero() {
+		values.Add("amount", params.Amount.encode())
+	}
+	if params.Reason != "" {
+		values.Add("reason", params.Reason)
+	}
+	if params.Memo != "" {
+		values.Add("memo", params.Memo)
+	}
+	if params.Refund {
+		values.Add("refund", "true")
+	}
+	for k, v := range params.Metadata {
+		values.Add("metadata["+k+"]", v)
+	}
+}
+
+func appendCreditNoteListParamsToValues(params *CreditNoteListParams, values *url.Values) {
+	if params.Invoice != "" {
+		values.Add("invoice", params.Invoice)
+	}
+	if params.Customer != "" {
+		values.Add("customer", params.Customer)
+	}
+}
@@ -0,0 +1,125 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+)
+
+// paidInvoice creates a customer with a card, and an invoice for the amounts
+// that is paid by that card.
+func paidInvoice(amounts ...int64) (*Customer, *Invoice) {
+	cust, _ := Customers.Create(&cust4)
+	for _, amount := range amounts {
+		InvoiceItems.Create(&InvoiceItemParams{Customer: cust.ID, Amount: Money{Amount: amount, Currency: INR}})
+	}
+	invoice, _ := Invoices.Create(cust.ID, &InvoiceParams{})
+	invoice, _ = Invoices.Pay(invoice.ID)
+	return cust, invoice
+}
+
+// TestCreateCreditNote will test that credit notes for lines of a paid
+// invoice are either refunded or credited to the customer, up to the amount
+// of each line.
+func TestCreateCreditNote(t *testing.T) {
+	cust, invoice := paidInvoice(1000, 500)
+	defer Customers.Delete(cust.ID)
+	line := invoice.Lines.Data[0]
+
+	params := CreditNoteParams{
+		Invoice: invoice.ID,
+		Lines:   []*CreditNoteLineParams{{InvoiceLine: line.ID, Amount: Money{Amount: 400, Currency: INR}}},
+		Reason:  CreditNoteProductUnsatisfactory,
+		Memo:    "Sorry about the outage",
+		Refund:  true,
+	}
+	note, err := CreditNotes.Create(&params)
+	if err != nil {
+		t.Errorf("Expected Credit Note, got Error %s", err.Error())
+		return
+	}
+	if note.Amount.Amount != 400 || note.RefundAmount.Amount != 400 || !note.CreditAmount.IsZero() {
+		t.Errorf("Expected refund of 400, got %d refunded of %d", note.RefundAmount.Amount, note.Amount.Amount)
+	}
+	if len(note.Lines) != 1 || note.Lines[0].InvoiceLine != line.ID || note.Lines[0].Amount.Currency != INR {
+		t.Errorf("Expected one credited line %s, got %d lines", line.ID, len(note.Lines))
+	}
+	if note.Reason != CreditNoteProductUnsatisfactory || note.Memo != String(params.Memo) || note.Customer != cust.ID {
+		t.Errorf("Expected reason and memo, got %+v", note)
+	}
+	if refund, _ := Refunds.Retrieve(string(note.Refund)); refund.Amount.Amount != 400 {
+		t.Errorf("Expected Refund of 400 for the Credit Note, got %d", refund.Amount.Amount)
+	}
+	if charge, _ := Charges.Retrieve(string(invoice.Charge)); charge.AmountRefunded.Amount != 400 {
+		t.Errorf("Expected 400 of the Charge refunded, got %d", charge.AmountRefunded.Amount)
+	}
+
+	// the rest of the line is credited to the customer's balance
+	params = CreditNoteParams{Invoice: invoice.ID, Lines: []*CreditNoteLineParams{{InvoiceLine: line.ID}}}
+	note, err = CreditNotes.Create(&params)
+	if err != nil || note.CreditAmount.Amount != 600 || !note.RefundAmount.IsZero() {
+		t.Errorf("Expected credit of 600, got %v", err)
+	}
+	if cust, _ = Customers.Retrieve(cust.ID); cust.Balance.Amount != -600 {
+		t.Errorf("Expected credit balance of -600, got %d", cust.Balance.Amount)
+	}
+	if _, err := CreditNotes.Create(&params); err == nil {
+		t.Error("Expected Error crediting a line twice")
+	}
+	if _, err := CreditNotes.Create(&CreditNoteParams{Invoice: invoice.ID, Amount: Money{Amount: 501, Currency: INR}}); err == nil {
+		t.Error("Expected Error crediting more than the invoice")
+	}
+
+	notes, _ := CreditNotes.InvoiceList(invoice.ID)
+	if len(notes) != 2 {
+		t.Errorf("Expected 2 Credit Notes for the Invoice, got %d", len(notes))
+	}
+	notes, _ = CreditNotes.CustomerList(cust.ID)
+	if len(notes) != 2 {
+		t.Errorf("Expected 2 Credit Notes for the Customer, got %d", len(notes))
+	}
+}
+
+// TestPreviewCreditNote will test that a credit note can be previewed without
+// issuing it, and that only paid invoices can be credited.
+func TestPreviewCreditNote(t *testing.T) {
+	cust, invoice := paidInvoice(1000)
+	defer Customers.Delete(cust.ID)
+
+	params := CreditNoteParams{Invoice: invoice.ID, Amount: Money{Amount: 250, Currency: INR}, Refund: true}
+	note, err := CreditNotes.Preview(&params)
+	if err != nil {
+		t.Errorf("Expected Credit Note preview, got Error %s", err.Error())
+		return
+	}
+	if note.ID != "" || note.Amount.Amount != 250 || note.RefundAmount.Amount != 250 {
+		t.Errorf("Expected preview of a refund of 250, got %+v", note)
+	}
+	if notes, _ := CreditNotes.InvoiceList(invoice.ID); len(notes) != 0 {
+		t.Errorf("Expected no Credit Notes issued, got %d", len(notes))
+	}
+
+	InvoiceItems.Create(&InvoiceItemParams{Customer: cust.ID, Amount: Money{Amount: 700, Currency: INR}})
+	draft, _ := Invoices.Create(cust.ID, &InvoiceParams{})
+	if _, err := CreditNotes.Preview(&CreditNoteParams{Invoice: draft.ID, Amount: Money{Amount: 100, Currency: INR}}); err == nil {
+		t.Error("Expected Error crediting an unpaid Invoice")
+	}
+}
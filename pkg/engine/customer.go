@@ -21,23 +21,35 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
+	"encoding/json"
 	"net/url"
 	"strconv"
 )
 
 // Customer encapsulates details about a Customer registered in Bhojpur Subscription.
 type Customer struct {
-	ID           string        `json:"id"`
-	Desc         String        `json:"description,omitempty"`
-	Email        String        `json:"email,omitempty"`
-	Created      int64         `json:"created"`
-	Balance      float64       `json:"account_balance"`
-	Delinquent   bool          `json:"delinquent"`
-	Cards        CardData      `json:"cards,omitempty"`
-	Discount     *Discount     `json:"discount,omitempty"`
-	Subscription *Subscription `json:"subscription,omitempty"`
-	Livemode     bool          `json:"livemode"`
-	DefaultCard  String        `json:"default_card"`
+	ID            string           `json:"id"`
+	Desc          String           `json:"description,omitempty"`
+	Email         String           `json:"email,omitempty"`
+	Created       int64            `json:"created"`
+	Balance       Money            `json:"account_balance"`
+	Currency      String           `json:"currency"`
+	Delinquent    bool             `json:"delinquent"`
+	Cards         CardData         `json:"cards,omitempty"`
+	Discount      *Discount        `json:"discount,omitempty"`
+	Subscriptions SubscriptionData `json:"subscriptions,omitempty"`
+	Livemode      bool             `json:"livemode"`
+	DefaultCard   String           `json:"default_card"`
+}
+
+func (self *Customer) UnmarshalJSON(data []byte) error {
+	type customer Customer
+	if err := json.Unmarshal(data, (*customer)(self)); err != nil {
+		return err
+	}
+	setCurrency(string(self.Currency), &self.Balance)
+	return nil
 }
 
 type CardData struct {
@@ -84,9 +96,10 @@ type CustomerParams struct {
 	// the customer will get before being charged for the first time.
 	TrialEnd int64
 
-	// (Optional) A decimal amount in paisa that is the starting account
-	// balance for your customer.
-	AccountBalance float64
+	// (Optional) An amount in the smallest currency unit that is the starting
+	// account balance for your customer. Only the Amount is sent, as the
+	// balance is always in the customer's currency.
+	AccountBalance Money
 
 	// (Optional) A set of key/value pairs that you can attach to a customer
 	// object.
@@ -95,45 +108,78 @@ type CustomerParams struct {
 	// (Optional) The quantity you’d like to apply to the subscription you’re
 	// creating.
 	Quantity int64
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
+}
+
+// listCustomerResp is the wrapper for a list of Customers, so that we can cleanly
+// parse the JSON.
+type listCustomerResp struct {
+	ListMeta
+	Data []*Customer `json:"data"`
 }
 
 // CustomerClient encapsulates operations for creating, updating, deleting and
 // querying customers using the Bhojpur Subscription REST API.
-type CustomerClient struct{}
+type CustomerClient struct {
+	client *Client
+}
 
 // Creates a new Customer.
 func (self *CustomerClient) Create(c *CustomerParams) (*Customer, error) {
+	return self.CreateCtx(context.Background(), c)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *CustomerClient) CreateCtx(ctx context.Context, c *CustomerParams) (*Customer, error) {
 	customer := Customer{}
 	values := url.Values{}
 	appendCustomerParamsToValues(c, &values)
 
-	err := query("POST", "/v1/customers", values, &customer)
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/customers", c.IdempotencyKey, values, &customer)
 	return &customer, err
 }
 
 // Retrieves a Customer with the given ID.
 func (self *CustomerClient) Retrieve(id string) (*Customer, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *CustomerClient) RetrieveCtx(ctx context.Context, id string) (*Customer, error) {
 	customer := Customer{}
 	path := "/v1/customers/" + url.QueryEscape(id)
-	err := query("GET", path, nil, &customer)
+	err := self.client.query(ctx, "GET", path, nil, &customer)
 	return &customer, err
 }
 
 // Updates a Customer with the given ID.
 func (self *CustomerClient) Update(id string, c *CustomerParams) (*Customer, error) {
+	return self.UpdateCtx(context.Background(), id, c)
+}
+
+// UpdateCtx is like Update, but uses ctx for the API request.
+func (self *CustomerClient) UpdateCtx(ctx context.Context, id string, c *CustomerParams) (*Customer, error) {
 	customer := Customer{}
 	values := url.Values{}
 	appendCustomerParamsToValues(c, &values)
 
-	err := query("POST", "/v1/customers/"+url.QueryEscape(id), values, &customer)
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/customers/"+url.QueryEscape(id), c.IdempotencyKey, values, &customer)
 	return &customer, err
 }
 
 // Deletes a Customer (permanently) with the given ID.
 func (self *CustomerClient) Delete(id string) (bool, error) {
+	return self.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx is like Delete, but uses ctx for the API request.
+func (self *CustomerClient) DeleteCtx(ctx context.Context, id string) (bool, error) {
 	resp := DeleteResp{}
 	path := "/v1/customers/" + url.QueryEscape(id)
-	if err := query("DELETE", path, nil, &resp); err != nil {
+	if err := self.client.query(ctx, "DELETE", path, nil, &resp); err != nil {
 		return false, err
 	}
 	return resp.Deleted, nil
@@ -141,14 +187,21 @@ func (self *CustomerClient) Delete(id string) (bool, error) {
 
 // Returns a list of your Customers.
 func (self *CustomerClient) List() ([]*Customer, error) {
-	return self.ListN(10, 0)
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *CustomerClient) ListCtx(ctx context.Context) ([]*Customer, error) {
+	return self.ListNCtx(ctx, 10, 0)
 }
 
 // Returns a list of your Customers at the specified range.
 func (self *CustomerClient) ListN(count int, offset int) ([]*Customer, error) {
-	// define a wrapper function for the Customer List, so that we can
-	// cleanly parse the JSON
-	type listCustomerResp struct{ Data []*Customer }
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *CustomerClient) ListNCtx(ctx context.Context, count int, offset int) ([]*Customer, error) {
 	resp := listCustomerResp{}
 
 	// add the count and offset to the list of url values
@@ -157,13 +210,43 @@ func (self *CustomerClient) ListN(count int, offset int) ([]*Customer, error) {
 		"offset": {strconv.Itoa(offset)},
 	}
 
-	err := query("GET", "/v1/customers", values, &resp)
+	err := self.client.query(ctx, "GET", "/v1/customers", values, &resp)
 	if err != nil {
 		return nil, err
 	}
 	return resp.Data, nil
 }
 
+// Iter returns an iterator that lazily pages through all of your Customers,
+// starting at the cursor given in params, if any.
+func (self *CustomerClient) Iter(params *ListParams) *CustomerIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *CustomerClient) IterCtx(ctx context.Context, params *ListParams) *CustomerIter {
+	return &CustomerIter{newIter(params, url.Values{}, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listCustomerResp{}
+		err := self.client.query(ctx, "GET", "/v1/customers", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, customer := range resp.Data {
+			items[i] = customer
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// CustomerIter is an iterator over a list of Customers.
+type CustomerIter struct {
+	*Iter
+}
+
+// Current returns the Customer at the current position of the iterator.
+func (it *CustomerIter) Current() *Customer {
+	customer, _ := it.Iter.Current().(*Customer)
+	return customer
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Helper Function(s)
 
@@ -184,8 +267,8 @@ func appendCustomerParamsToValues(c *CustomerParams, values *url.Values) {
 	if c.TrialEnd != 0 {
 		values.Add("trial_end", strconv.FormatInt(c.TrialEnd, 10))
 	}
-	if c.AccountBalance != 0 {
-		values.Add("account_balance", strconv.FormatFloat(c.AccountBalance, 'E', -1, 64))
+	if !c.AccountBalance.IsZero() {
+		values.Add("account_balance", c.AccountBalance.encode())
 	}
 	if c.Quantity != 0 {
 		values.Add("quantity", strconv.FormatInt(c.Quantity, 10))
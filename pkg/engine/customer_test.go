@@ -25,14 +25,6 @@ import (
 	"time"
 )
 
-func init() {
-	// In order to execute Unit Test, you must set your Bhojpur API Key as
-	// environment variable, BHOJPUR_API_KEY=xxxx
-	if err := SetKeyEnv(); err != nil {
-		panic(err)
-	}
-}
-
 // Sample Customers to use when creating, deleting, updating Customer data.
 var (
 	// Customer with only the required fields
@@ -159,7 +151,7 @@ func TestRetrieveCustomer(t *testing.T) {
 		t.Errorf("Expected Card Name %s, got %s", cust2.Card.Name, cust.Cards.Data[0].Name)
 	}
 	if cust.Cards.Data[0].Last4 != "4242" {
-		t.Errorf("Expected Card Last4 %d, got %d", "4242", cust.Cards.Data[0].Last4)
+		t.Errorf("Expected Card Last4 %s, got %s", "4242", cust.Cards.Data[0].Last4)
 	}
 	if cust.Cards.Data[0].ExpYear != cust2.Card.ExpYear {
 		t.Errorf("Expected Card ExpYear %d, got %d", cust2.Card.ExpYear, cust.Cards.Data[0].ExpYear)
@@ -225,6 +217,6 @@ func TestListCustomers(t *testing.T) {
 
 	// since we added two dummy customers, we expect the array to be a size of 2
 	if len(customers) != 2 {
-		t.Errorf("Expected two Customers, got %s", len(customers))
+		t.Errorf("Expected two Customers, got %d", len(customers))
 	}
 }
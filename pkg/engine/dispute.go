@@ -0,0 +1,328 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+)
+
+// Dispute Reasons
+const (
+	DisputeCreditNotProcessed   = "credit_not_processed"
+	DisputeDuplicate            = "duplicate"
+	DisputeFraudulent           = "fraudulent"
+	DisputeGeneral              = "general"
+	DisputeProductNotReceived   = "product_not_received"
+	DisputeProductUnacceptable  = "product_unacceptable"
+	DisputeSubscriptionCanceled = "subscription_canceled"
+	DisputeUnrecognized         = "unrecognized"
+)
+
+// Dispute Statuses
+const (
+	DisputeNeedsResponse = "needs_response"
+	DisputeUnderReview   = "under_review"
+	DisputeWon           = "won"
+	DisputeLost          = "lost"
+)
+
+// Dispute represents a chargeback of a Charge, raised by the customer's bank.
+// Evidence against it must be submitted before EvidenceDetails.DueBy.
+type Dispute struct {
+	ID                 string            `json:"id"`
+	Amount             Money             `json:"amount"`
+	Currency           string            `json:"currency"`
+	Charge             string            `json:"charge"`
+	Reason             string            `json:"reason"`
+	Status             string            `json:"status"`
+	Evidence           *DisputeEvidence  `json:"evidence"`
+	EvidenceDetails    *EvidenceDetails  `json:"evidence_details"`
+	IsChargeRefundable bool              `json:"is_charge_refundable"`
+	Created            int64             `json:"created"`
+	Metadata           map[string]string `json:"metadata"`
+	Livemode           bool              `json:"livemode"`
+}
+
+// DisputeEvidence is the evidence submitted to counter a Dispute.
+type DisputeEvidence struct {
+	Receipt               String `json:"receipt"`
+	CustomerCommunication String `json:"customer_communication"`
+	ServiceDate           String `json:"service_date"`
+	RefundPolicy          String `json:"refund_policy"`
+}
+
+// EvidenceDetails holds the deadline, and the state, of the evidence of a
+// Dispute.
+type EvidenceDetails struct {
+	DueBy           Int64 `json:"due_by"`
+	HasEvidence     bool  `json:"has_evidence"`
+	PastDue         bool  `json:"past_due"`
+	SubmissionCount int   `json:"submission_count"`
+}
+
+func (self *Dispute) UnmarshalJSON(data []byte) error {
+	type dispute Dispute
+	if err := json.Unmarshal(data, (*dispute)(self)); err != nil {
+		return err
+	}
+	setCurrency(self.Currency, &self.Amount)
+	return nil
+}
+
+// DisputeParams encapsulates options for updating a Dispute.
+type DisputeParams struct {
+	// (Optional) The evidence to counter the dispute with. Fields left blank
+	// keep any evidence given before.
+	Evidence *DisputeEvidenceParams
+
+	// (Optional) Whether to submit the evidence for review, which is the
+	// default. When false, the evidence is only saved, so that more can be
+	// added before submitting it. Evidence can no longer be changed once it
+	// is submitted.
+	Submit *bool
+
+	// (Optional) Set of key/value pairs to attach to the dispute. A blank
+	// value removes the key.
+	Metadata map[string]string
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
+}
+
+// DisputeEvidenceParams encapsulates the evidence to counter a Dispute with.
+type DisputeEvidenceParams struct {
+	// (Optional) The receipt or invoice sent to the customer.
+	Receipt string
+
+	// (Optional) Communication with the customer showing that they recognize
+	// the charge, or are satisfied with the product or service.
+	CustomerCommunication string
+
+	// (Optional) The date on which the service was provided to the customer.
+	ServiceDate string
+
+	// (Optional) The text of your refund policy, as shown to the customer.
+	RefundPolicy string
+}
+
+// DisputeListParams encapsulates options for filtering a list of Disputes.
+// The paging options of the embedded ListParams are only used by Iter.
+type DisputeListParams struct {
+	ListParams
+
+	// (Optional) Only return disputes of the charge with this ID.
+	Charge string
+
+	// (Optional) Only return disputes with this status, e.g.
+	// DisputeNeedsResponse.
+	Status string
+
+	// (Optional) Only return disputes created within this range of UTC
+	// timestamps.
+	Created *RangeQuery
+}
+
+// listDisputesResp is the wrapper for a list of Disputes, so that we can
+// cleanly parse the JSON.
+type listDisputesResp struct {
+	ListMeta
+	Data []*Dispute `json:"data"`
+}
+
+// DisputeClient encapsulates operations for responding to and querying
+// disputes using the Bhojpur Subscription REST API.
+type DisputeClient struct {
+	client *Client
+}
+
+// Retrieves the Dispute with the given ID.
+func (self *DisputeClient) Retrieve(id string) (*Dispute, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *DisputeClient) RetrieveCtx(ctx context.Context, id string) (*Dispute, error) {
+	dispute := Dispute{}
+	path := "/v1/disputes/" + url.QueryEscape(id)
+	err := self.client.query(ctx, "GET", path, nil, &dispute)
+	return &dispute, err
+}
+
+// Updates the Dispute with the given ID, usually to submit evidence against
+// it.
+func (self *DisputeClient) Update(id string, params *DisputeParams) (*Dispute, error) {
+	return self.UpdateCtx(context.Background(), id, params)
+}
+
+// UpdateCtx is like Update, but uses ctx for the API request.
+func (self *DisputeClient) UpdateCtx(ctx context.Context, id string, params *DisputeParams) (*Dispute, error) {
+	dispute := Dispute{}
+	values := url.Values{}
+	appendDisputeParamsToValues(params, &values)
+
+	path := "/v1/disputes/" + url.QueryEscape(id)
+	err := self.client.queryIdempotent(ctx, "POST", path, params.IdempotencyKey, values, &dispute)
+	return &dispute, err
+}
+
+// Closes the Dispute with the given ID, accepting it without a response. The
+// dispute is lost, and can no longer be updated.
+func (self *DisputeClient) Close(id string) (*Dispute, error) {
+	return self.CloseCtx(context.Background(), id)
+}
+
+// CloseCtx is like Close, but uses ctx for the API request.
+func (self *DisputeClient) CloseCtx(ctx context.Context, id string) (*Dispute, error) {
+	dispute := Dispute{}
+	path := "/v1/disputes/" + url.QueryEscape(id) + "/close"
+	err := self.client.query(ctx, "POST", path, nil, &dispute)
+	return &dispute, err
+}
+
+// Returns a list of your Disputes.
+func (self *DisputeClient) List() ([]*Dispute, error) {
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *DisputeClient) ListCtx(ctx context.Context) ([]*Dispute, error) {
+	return self.list(ctx, nil, 10, 0)
+}
+
+// Returns a list of your Disputes at the specified range.
+func (self *DisputeClient) ListN(count int, offset int) ([]*Dispute, error) {
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *DisputeClient) ListNCtx(ctx context.Context, count int, offset int) ([]*Dispute, error) {
+	return self.list(ctx, nil, count, offset)
+}
+
+// Returns a list of your Disputes matching the given filters, at the
+// specified range.
+func (self *DisputeClient) ListFiltered(params *DisputeListParams, count int, offset int) ([]*Dispute, error) {
+	return self.ListFilteredCtx(context.Background(), params, count, offset)
+}
+
+// ListFilteredCtx is like ListFiltered, but uses ctx for the API request.
+func (self *DisputeClient) ListFilteredCtx(ctx context.Context, params *DisputeListParams, count int, offset int) ([]*Dispute, error) {
+	return self.list(ctx, params, count, offset)
+}
+
+func (self *DisputeClient) list(ctx context.Context, params *DisputeListParams, count int, offset int) ([]*Dispute, error) {
+	resp := listDisputesResp{}
+
+	// add the count and offset to the list of url values
+	values := url.Values{
+		"count":  {strconv.Itoa(count)},
+		"offset": {strconv.Itoa(offset)},
+	}
+
+	// add the filters, if provided
+	if params != nil {
+		appendDisputeListParamsToValues(params, &values)
+	}
+
+	err := self.client.query(ctx, "GET", "/v1/disputes", values, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Iter returns an iterator that lazily pages through all of your Disputes
+// matching the filters in params, starting at its cursor, if any.
+func (self *DisputeClient) Iter(params *DisputeListParams) *DisputeIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *DisputeClient) IterCtx(ctx context.Context, params *DisputeListParams) *DisputeIter {
+	values := url.Values{}
+	var list *ListParams
+	if params != nil {
+		appendDisputeListParamsToValues(params, &values)
+		list = &params.ListParams
+	}
+	return &DisputeIter{newIter(list, values, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listDisputesResp{}
+		err := self.client.query(ctx, "GET", "/v1/disputes", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, dispute := range resp.Data {
+			items[i] = dispute
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// DisputeIter is an iterator over a list of Disputes.
+type DisputeIter struct {
+	*Iter
+}
+
+// Current returns the Dispute at the current position of the iterator.
+func (it *DisputeIter) Current() *Dispute {
+	dispute, _ := it.Iter.Current().(*Dispute)
+	return dispute
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helper Function(s)
+
+func appendDisputeParamsToValues(params *DisputeParams, values *url.Values) {
+	if evidence := params.Evidence; evidence != nil {
+		if evidence.Receipt != "" {
+			values.Add("evidence[receipt]", evidence.Receipt)
+		}
+		if evidence.CustomerCommunication != "" {
+			values.Add("evidence[customer_communication]", evidence.CustomerCommunication)
+		}
+		if evidence.ServiceDate != "" {
+			values.Add("evidence[service_date]", evidence.ServiceDate)
+		}
+		if evidence.RefundPolicy != "" {
+			values.Add("evidence[refund_policy]", evidence.RefundPolicy)
+		}
+	}
+	if params.Submit != nil {
+		values.Add("submit", strconv.FormatBool(*params.Submit))
+	}
+	for k, v := range params.Metadata {
+		values.Add("metadata["+k+"]", v)
+	}
+}
+
+func appendDisputeListParamsToValues(params *DisputeListParams, values *url.Values) {
+	if params.Charge != "" {
+		values.Add("charge", params.Charge)
+	}
+	if params.Status != "" {
+		values.Add("status", params.Status)
+	}
+	if params.Created != nil {
+		appendRangeQueryToValues("created", params.Created, values)
+	}
+}
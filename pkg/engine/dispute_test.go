@@ -0,0 +1,127 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+)
+
+// disputedCharge creates a charge with a card whose charges are disputed.
+func disputedCharge(number string) (*Charge, error) {
+	params := charge1
+	card := *charge1.Card
+	card.Number = number
+	params.Card = &card
+	return Charges.Create(&params)
+}
+
+// TestRetrieveDispute will test that a disputed charge links to its dispute,
+// which has a deadline for evidence.
+func TestRetrieveDispute(t *testing.T) {
+	charge, err := disputedCharge("4000000000000259")
+	if err != nil {
+		t.Errorf("Expected Charge, got Error %s", err.Error())
+		return
+	}
+	if !charge.Disputed || charge.Dispute == "" {
+		t.Errorf("Expected disputed Charge, got %v", charge.Dispute)
+		return
+	}
+
+	dispute, err := Disputes.Retrieve(string(charge.Dispute))
+	if err != nil {
+		t.Errorf("Expected Dispute, got Error %s", err.Error())
+		return
+	}
+	if dispute.Charge != charge.ID || dispute.Amount != charge.Amount || dispute.Reason != DisputeFraudulent {
+		t.Errorf("Expected fraudulent Dispute of %v, got %s Dispute of %v", charge.Amount, dispute.Reason, dispute.Amount)
+	}
+	if dispute.Status != DisputeNeedsResponse || dispute.EvidenceDetails == nil || int64(dispute.EvidenceDetails.DueBy) <= dispute.Created {
+		t.Errorf("Expected Dispute needing a response with a deadline, got %+v", dispute)
+	}
+
+	disputes, _ := Disputes.ListFiltered(&DisputeListParams{Charge: charge.ID, Status: DisputeNeedsResponse}, 10, 0)
+	if len(disputes) != 1 || disputes[0].ID != dispute.ID {
+		t.Errorf("Expected the Dispute of the Charge, got %d Disputes", len(disputes))
+	}
+	if charge, _ = Charges.Create(&charge1); charge.Disputed || charge.Dispute != "" {
+		t.Errorf("Expected undisputed Charge, got Dispute %s", charge.Dispute)
+	}
+}
+
+// TestUpdateDispute will test that evidence can be saved, and then submitted,
+// after which it can no longer be changed.
+func TestUpdateDispute(t *testing.T) {
+	charge, _ := disputedCharge("4000000000002685")
+	submit := false
+	params := DisputeParams{
+		Evidence: &DisputeEvidenceParams{
+			Receipt:      "https://bhojpur.net/receipts/1001",
+			ServiceDate:  "2021-04-01",
+			RefundPolicy: "Refunds within 30 days of delivery.",
+		},
+		Submit:   &submit,
+		Metadata: map[string]string{"case": "77"},
+	}
+	dispute, err := Disputes.Update(string(charge.Dispute), &params)
+	if err != nil {
+		t.Errorf("Expected Dispute, got Error %s", err.Error())
+		return
+	}
+	if dispute.Status != DisputeNeedsResponse || !dispute.EvidenceDetails.HasEvidence || dispute.Evidence.ServiceDate != "2021-04-01" {
+		t.Errorf("Expected saved evidence, got %+v", dispute.Evidence)
+	}
+
+	params = DisputeParams{Evidence: &DisputeEvidenceParams{CustomerCommunication: "Delivered, signed by the customer."}}
+	dispute, err = Disputes.Update(dispute.ID, &params)
+	if err != nil {
+		t.Errorf("Expected Dispute, got Error %s", err.Error())
+		return
+	}
+	if dispute.Status != DisputeUnderReview || dispute.EvidenceDetails.SubmissionCount != 1 {
+		t.Errorf("Expected submitted evidence, got status %s", dispute.Status)
+	}
+	if dispute.Evidence.Receipt == "" || dispute.Evidence.CustomerCommunication == "" || dispute.Metadata["case"] != "77" {
+		t.Errorf("Expected all evidence to be kept, got %+v", dispute.Evidence)
+	}
+	if _, err := Disputes.Update(dispute.ID, &params); err == nil {
+		t.Error("Expected Error changing submitted evidence")
+	}
+	if _, err := Disputes.Close(dispute.ID); err == nil {
+		t.Error("Expected Error closing a Dispute under review")
+	}
+}
+
+// TestCloseDispute will test that closing a dispute accepts it as lost.
+func TestCloseDispute(t *testing.T) {
+	charge, _ := disputedCharge("4000000000000259")
+	dispute, err := Disputes.Close(string(charge.Dispute))
+	if err != nil {
+		t.Errorf("Expected closed Dispute, got Error %s", err.Error())
+		return
+	}
+	if dispute.Status != DisputeLost {
+		t.Errorf("Expected lost Dispute, got %s", dispute.Status)
+	}
+	if _, err := Disputes.Update(dispute.ID, &DisputeParams{Evidence: &DisputeEvidenceParams{Receipt: "late"}}); err == nil {
+		t.Error("Expected Error submitting evidence for a closed Dispute")
+	}
+}
@@ -21,74 +21,218 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
+	crand "crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// enable logging to print the request and reponses to stdout
-var _log bool
-
-// the API Key used to authenticate all Bhojpur Subscription API requests
-var _key string
-
 // the default URL for all Bhojpur Subscription API requests
-var _url string = "https://api.bhojpur.net"
+const defaultURL = "https://api.bhojpur.net"
 
 const apiVersion = "2018-03-26"
 
+// the default retry policy for failed Bhojpur Subscription API requests
+const (
+	defaultMaxRetries = 2
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 8 * time.Second
+)
+
+// Client is used to invoke the Bhojpur Subscription REST API on behalf of a
+// single account. Each Client owns its API key, base URL, http.Client, logger
+// and API version, so several accounts (i.e. test and live, or two merchants)
+// can be used safely from the same process.
+type Client struct {
+	key        string
+	url        string
+	version    string
+	httpClient *http.Client
+	logger     *log.Logger
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	// Available Bhojpur Subscription APIs
+	Balance             *BalanceClient
+	BalanceTransactions *BalanceTransactionClient
+	Cards               *CardClient
+	Charges             *ChargeClient
+	Coupons             *CouponClient
+	CreditNotes         *CreditNoteClient
+	Customers           *CustomerClient
+	Disputes            *DisputeClient
+	Events              *EventClient
+	Invoices            *InvoiceClient
+	InvoiceItems        *InvoiceItemClient
+	Plans               *PlanClient
+	Products            *ProductClient
+	Refunds             *RefundClient
+	Subscriptions       *SubscriptionClient
+	Tokens              *TokenClient
+	UsageRecords        *UsageRecordClient
+}
+
+// Option configures a Client created with New.
+type Option func(*Client)
+
+// WithURL overrides the default Bhojpur Subscription API URL.
+func WithURL(url string) Option {
+	return func(c *Client) { c.url = url }
+}
+
+// WithHTTPClient sets the http.Client used to submit API requests. By default
+// http.DefaultClient is used.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithLogger enables logging of every request and response to the given
+// logger.
+func WithLogger(logger *log.Logger) Option {
+	return func(c *Client) { c.logger = logger }
+}
+
+// WithAPIVersion overrides the Bhojpur Subscription API version sent with
+// every request.
+func WithAPIVersion(version string) Option {
+	return func(c *Client) { c.version = version }
+}
+
+// WithMaxRetries sets how many times a request is retried after a connection
+// error, a 429 or a 5xx response. Zero disables retries.
+func WithMaxRetries(n int) Option {
+	return func(c *Client) { c.maxRetries = n }
+}
+
+// WithBackoff sets the bounds of the jittered exponential backoff between
+// retries. The wait before the first retry is at most min, and doubles with
+// every attempt up to max.
+func WithBackoff(min, max time.Duration) Option {
+	return func(c *Client) { c.minBackoff, c.maxBackoff = min, max }
+}
+
+// New returns a Client that authenticates all Bhojpur Subscription API
+// requests using the given API key.
+func New(key string, opts ...Option) *Client {
+	c := &Client{
+		key:        key,
+		url:        defaultURL,
+		version:    apiVersion,
+		httpClient: http.DefaultClient,
+		maxRetries: defaultMaxRetries,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.Balance = &BalanceClient{client: c}
+	c.BalanceTransactions = &BalanceTransactionClient{client: c}
+	c.Cards = &CardClient{client: c}
+	c.Charges = &ChargeClient{client: c}
+	c.Coupons = &CouponClient{client: c}
+	c.CreditNotes = &CreditNoteClient{client: c}
+	c.Customers = &CustomerClient{client: c}
+	c.Disputes = &DisputeClient{client: c}
+	c.Events = &EventClient{client: c}
+	c.Invoices = &InvoiceClient{client: c}
+	c.InvoiceItems = &InvoiceItemClient{client: c}
+	c.Plans = &PlanClient{client: c}
+	c.Products = &ProductClient{client: c}
+	c.Refunds = &RefundClient{client: c}
+	c.Subscriptions = &SubscriptionClient{client: c}
+	c.Tokens = &TokenClient{client: c}
+	c.UsageRecords = &UsageRecordClient{client: c}
+	return c
+}
+
+// the default Client, used by the package-level Bhojpur Subscription APIs
+var defaultClient = New("")
+
 // SetUrl will override the default Bhojpur Subscription API URL. This is
 // primarily used for unit testing.
 func SetUrl(url string) {
-	_url = url
+	defaultClient.url = url
 }
 
 // SetKey will set the default Bhojpur Subscription API key used to authenticate
 // all Bhojpur Subscription API requests.
 func SetKey(key string) {
-	_key = key
+	defaultClient.key = key
 }
 
-// Available Bhojpur Subscription APIs
+// Available Bhojpur Subscription APIs, bound to the default Client.
 var (
-	Charges       = new(ChargeClient)
-	Coupons       = new(CouponClient)
-	Customers     = new(CustomerClient)
-	Invoices      = new(InvoiceClient)
-	InvoiceItems  = new(InvoiceItemClient)
-	Plans         = new(PlanClient)
-	Subscriptions = new(SubscriptionClient)
-	Tokens        = new(TokenClient)
+	Balance             = defaultClient.Balance
+	BalanceTransactions = defaultClient.BalanceTransactions
+	Cards               = defaultClient.Cards
+	Charges             = defaultClient.Charges
+	Coupons             = defaultClient.Coupons
+	CreditNotes         = defaultClient.CreditNotes
+	Customers           = defaultClient.Customers
+	Disputes            = defaultClient.Disputes
+	Events              = defaultClient.Events
+	Invoices            = defaultClient.Invoices
+	InvoiceItems        = defaultClient.InvoiceItems
+	Plans               = defaultClient.Plans
+	Products            = defaultClient.Products
+	Refunds             = defaultClient.Refunds
+	Subscriptions       = defaultClient.Subscriptions
+	Tokens              = defaultClient.Tokens
+	UsageRecords        = defaultClient.UsageRecords
 )
 
 // SetKeyEnv retrieves the Bhojpur Subscription API key using the BHOJPUR_API_KEY
 // environment variable.
 func SetKeyEnv() (err error) {
-	_key = os.Getenv("BHOJPUR_API_KEY")
-	if _key == "" {
+	defaultClient.key = os.Getenv("BHOJPUR_API_KEY")
+	if defaultClient.key == "" {
 		err = errors.New("BHOJPUR_API_KEY not found in environment")
 	}
 	return
 }
 
 // query submits an http.Request and parses the JSON-encoded http.Response,
-// storing the result in the value pointed to by v.
-func query(method, path string, values url.Values, v interface{}) error {
+// storing the result in the value pointed to by v. A nil Client (i.e. a
+// resource client created with new) falls back to the default Client.
+//
+// If ctx is canceled or its deadline expires before the response is read,
+// ctx.Err() is returned rather than an *Error, so callers can tell the two
+// apart using errors.Is(err, context.Canceled) or context.DeadlineExceeded.
+func (c *Client) query(ctx context.Context, method, path string, values url.Values, v interface{}) error {
+	return c.queryIdempotent(ctx, method, path, "", values, v)
+}
+
+// queryIdempotent is like query, but sends the given Idempotency-Key with a
+// POST request. If key is empty a random key is generated, so that every
+// attempt of a retried POST carries the same key.
+func (c *Client) queryIdempotent(ctx context.Context, method, path, key string, values url.Values, v interface{}) error {
+	if c == nil {
+		c = defaultClient
+	}
+
 	// parse the Bhojpur Subscription URL
-	endpoint, err := url.Parse(_url)
+	endpoint, err := url.Parse(c.url)
 	if err != nil {
 		return err
 	}
 
 	// set the endpoint for the specific API
 	endpoint.Path = path
-	endpoint.User = url.User(_key)
+	endpoint.User = url.User(c.key)
 
 	// if this is an http GET, add the url.Values to the endpoint
 	if method == "GET" {
@@ -96,53 +240,161 @@ func query(method, path string, values url.Values, v interface{}) error {
 	}
 
 	// else if this is not a GET, encode the url.Values in the body.
-	var reqBody io.Reader
+	var reqBody string
 	if method != "GET" && values != nil {
-		reqBody = strings.NewReader(values.Encode())
+		reqBody = values.Encode()
+	}
+
+	// POST requests are made idempotent, so they can be safely retried
+	if method == "POST" && key == "" {
+		if key, err = newIdempotencyKey(); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		// Log request if logging enabled
+		if c.logger != nil {
+			c.logger.Println("REQUEST: ", method, endpoint.Redacted())
+			c.logger.Println(values.Encode())
+		}
+
+		status, header, body, err := c.do(ctx, method, endpoint.String(), key, reqBody)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Log response if logging enabled
+		if c.logger != nil && err == nil {
+			c.logger.Println("RESPONSE: ", status)
+			c.logger.Println(string(body))
+		}
+
+		// retry connection errors, rate limiting and server errors
+		if attempt < c.maxRetries && shouldRetry(status, err) {
+			if c.logger != nil {
+				c.logger.Println("RETRYING: ", method, endpoint.Redacted())
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.backoff(attempt, header)):
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// is this an error?
+		if status != 200 {
+			error := Error{Code: status}
+			json.Unmarshal(body, &error)
+			return &error
+		}
+
+		//parse the JSON response into the response object
+		return json.Unmarshal(body, v)
 	}
+}
 
-	// Log request if logging enabled
-	if _log {
-		fmt.Println("REQUEST: ", method, endpoint.String())
-		fmt.Println(values.Encode())
+// do submits a single http.Request, returning the status code, headers and
+// body of the http.Response.
+func (c *Client) do(ctx context.Context, method, endpoint, key, reqBody string) (int, http.Header, []byte, error) {
+	var body io.Reader
+	if reqBody != "" {
+		body = strings.NewReader(reqBody)
 	}
 
 	// create the request
-	req, err := http.NewRequest(method, endpoint.String(), reqBody)
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
 	if err != nil {
-		return err
+		return 0, nil, nil, err
 	}
 
-	req.Header.Set("Bhojpur-Version", apiVersion)
+	req.Header.Set("Bhojpur-Version", c.version)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
 
 	// submit the http request
-	r, err := http.DefaultClient.Do(req)
+	r, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		return 0, nil, nil, err
 	}
+	defer r.Body.Close()
 
 	// read the body of the http message into a byte array
-	body, err := ioutil.ReadAll(r.Body)
-	defer r.Body.Close()
+	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return err
+		return 0, nil, nil, err
+	}
+	return r.StatusCode, r.Header, data, nil
+}
+
+// shouldRetry reports whether a request that failed with the given status
+// code or connection error should be attempted again.
+func shouldRetry(status int, err error) bool {
+	if err != nil {
+		return true
 	}
+	return status == http.StatusTooManyRequests || status >= 500
+}
 
-	// Log response if logging enabled
-	if _log {
-		fmt.Println("RESPONSE: ", r.StatusCode)
-		fmt.Println(string(body))
+// backoff returns how long to wait before the given retry attempt. The
+// server's Retry-After header is respected when present, up to maxBackoff,
+// otherwise a jittered exponential backoff between minBackoff and maxBackoff
+// is used.
+func (c *Client) backoff(attempt int, header http.Header) time.Duration {
+	if after := header.Get("Retry-After"); after != "" {
+		wait, ok := time.Duration(0), false
+		if secs, err := strconv.ParseInt(after, 10, 64); err == nil && secs >= 0 {
+			wait, ok = c.maxBackoff, true
+			if secs <= int64(c.maxBackoff/time.Second) {
+				wait = time.Duration(secs) * time.Second
+			}
+		} else if t, err := http.ParseTime(after); err == nil {
+			wait, ok = time.Until(t), true
+		}
+		if ok {
+			if wait > c.maxBackoff {
+				wait = c.maxBackoff
+			}
+			if wait < 0 {
+				wait = 0
+			}
+			return wait
+		}
 	}
 
-	// is this an error?
-	if r.StatusCode != 200 {
-		error := Error{}
-		json.Unmarshal(body, &error)
-		return &error
+	// double minBackoff for every attempt, up to maxBackoff. Comparing with
+	// maxBackoff shifted right avoids overflowing the shift to the left.
+	wait := c.maxBackoff
+	if c.minBackoff <= c.maxBackoff>>uint(attempt) {
+		wait = c.minBackoff << uint(attempt)
 	}
 
-	//parse the JSON response into the response object
-	return json.Unmarshal(body, v)
+	// pick a random wait between half and all of the computed backoff, so
+	// that clients retrying at the same time don't do so in lock step
+	if half := int64(wait / 2); half > 0 {
+		wait = time.Duration(half + rand.Int63n(half+1))
+	}
+	return wait
+}
+
+// newIdempotencyKey returns a random (version 4) UUID to be used as the
+// Idempotency-Key of a request.
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
 }
 
 // Response to a Deletion request.
@@ -0,0 +1,245 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/subscription/pkg/engine/enginetest"
+)
+
+// TestMain runs the tests against the live API when BHOJPUR_API_KEY is set,
+// and against an in-memory enginetest.Server otherwise.
+func TestMain(m *testing.M) {
+	if err := SetKeyEnv(); err == nil {
+		os.Exit(m.Run())
+	}
+
+	server := enginetest.NewServer()
+	server.Configure(SetUrl, SetKey)
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// TestClientIsolation will test that two Clients created with New use their
+// own API key, base URL and API version, independent of the default Client.
+func TestClientIsolation(t *testing.T) {
+	type request struct{ key, version, path string }
+	var got []request
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _, _ := r.BasicAuth()
+		got = append(got, request{key, r.Header.Get("Bhojpur-Version"), r.URL.Path})
+		w.Write([]byte(`{"id":"cus_1"}`))
+	}))
+	defer server.Close()
+
+	test := New("sk_test", WithURL(server.URL))
+	live := New("sk_live", WithURL(server.URL), WithAPIVersion("2020-01-01"))
+
+	if _, err := test.Customers.Retrieve("cus_1"); err != nil {
+		t.Errorf("Expected Customer, got Error %s", err.Error())
+	}
+	if _, err := live.Charges.Retrieve("ch_1"); err != nil {
+		t.Errorf("Expected Charge, got Error %s", err.Error())
+	}
+
+	want := []request{
+		{"sk_test", apiVersion, "/v1/customers/cus_1"},
+		{"sk_live", "2020-01-01", "/v1/charges/ch_1"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d requests, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected request %+v, got %+v", want[i], got[i])
+		}
+	}
+	if defaultClient.url == server.URL {
+		t.Errorf("Expected default Client URL to be unchanged")
+	}
+}
+
+// TestClientError will test that a non-200 response is returned as an *Error
+// carrying the http status code.
+func TestClientError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"No such plan: plan1"}}`))
+	}))
+	defer server.Close()
+
+	client := New("sk_test", WithURL(server.URL))
+	_, err := client.Plans.Retrieve("plan1")
+	bhojpurErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Expected *Error, got %v", err)
+	}
+	if bhojpurErr.Code != http.StatusNotFound {
+		t.Errorf("Expected Error Code %d, got %d", http.StatusNotFound, bhojpurErr.Code)
+	}
+	if bhojpurErr.Detail.Type != ErrTypeInvalidRequest {
+		t.Errorf("Expected Error Type %s, got %s", ErrTypeInvalidRequest, bhojpurErr.Detail.Type)
+	}
+}
+
+// TestClientContext will test that a context deadline reaches the outgoing
+// request, and that the resulting error is the context error, not an *Error.
+func TestClientContext(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client := New("sk_test", WithURL(server.URL))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.Charges.RetrieveCtx(ctx, "ch_1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if _, ok := err.(*Error); ok {
+		t.Errorf("Expected a context error, got *Error")
+	}
+}
+
+// TestClientRetry will test that a POST failing with a 5xx and then a 429 is
+// retried, with the same Idempotency-Key on every attempt.
+func TestClientRetry(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		switch len(keys) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{"id":"ch_1","paid":true}`))
+		}
+	}))
+	defer server.Close()
+
+	client := New("sk_test", WithURL(server.URL), WithBackoff(time.Millisecond, 2*time.Millisecond))
+	charge, err := client.Charges.Create(&ChargeParams{Amount: Money{Amount: 200, Currency: INR}, Customer: "cus_1"})
+	if err != nil {
+		t.Fatalf("Expected Successful Charge, got Error %s", err.Error())
+	}
+	if !charge.Paid {
+		t.Errorf("Expected Charge was paid, got %v", charge.Paid)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", len(keys))
+	}
+	if keys[0] == "" || keys[0] != keys[1] || keys[1] != keys[2] {
+		t.Errorf("Expected the same Idempotency-Key on every attempt, got %v", keys)
+	}
+}
+
+// TestClientRetryLimit will test that the caller supplied Idempotency-Key is
+// used, and that requests are not retried beyond the configured limit or for
+// client errors.
+func TestClientRetryLimit(t *testing.T) {
+	var attempts int
+	var key string
+	status := http.StatusBadGateway
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		key = r.Header.Get("Idempotency-Key")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"error":{"type":"api_error","message":"oops"}}`))
+	}))
+	defer server.Close()
+
+	client := New("sk_test", WithURL(server.URL), WithMaxRetries(1), WithBackoff(time.Millisecond, time.Millisecond))
+	_, err := client.Customers.Create(&CustomerParams{Email: "test@bhojpur.net", IdempotencyKey: "key-1"})
+	if bhojpurErr, ok := err.(*Error); !ok || bhojpurErr.Code != http.StatusBadGateway {
+		t.Errorf("Expected *Error with Code %d, got %v", http.StatusBadGateway, err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+	if key != "key-1" {
+		t.Errorf("Expected Idempotency-Key key-1, got %s", key)
+	}
+
+	attempts, status = 0, http.StatusBadRequest
+	client.Customers.Create(&CustomerParams{Email: "test@bhojpur.net"})
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt for a client error, got %d", attempts)
+	}
+}
+
+// TestClientBackoff will test that the wait before a retry grows from the
+// minimum to the maximum backoff, and that Retry-After is capped by the
+// maximum.
+func TestClientBackoff(t *testing.T) {
+	client := New("sk_test", WithBackoff(0, time.Second))
+	for attempt := 0; attempt < 100; attempt += 10 {
+		if wait := client.backoff(attempt, http.Header{}); wait != 0 {
+			t.Errorf("Expected no wait for attempt %d without a minimum, got %s", attempt, wait)
+		}
+	}
+
+	client = New("sk_test", WithBackoff(100*time.Millisecond, time.Second))
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond, 400 * time.Millisecond},
+		{10, 500 * time.Millisecond, time.Second},
+		{100, 500 * time.Millisecond, time.Second},
+	}
+	for _, test := range tests {
+		if wait := client.backoff(test.attempt, http.Header{}); wait < test.min || wait > test.max {
+			t.Errorf("Expected wait between %s and %s for attempt %d, got %s", test.min, test.max, test.attempt, wait)
+		}
+	}
+
+	for after, want := range map[string]time.Duration{
+		"0":                   0,
+		"1":                   time.Second,
+		"86400":               time.Second,
+		"9223372036854775807": time.Second,
+		time.Now().Add(time.Hour).UTC().Format(http.TimeFormat): time.Second,
+		"Mon, 02 Jan 2006 15:04:05 GMT":                         0,
+	} {
+		if wait := client.backoff(0, http.Header{"Retry-After": {after}}); wait != want {
+			t.Errorf("Expected wait %s for Retry-After %s, got %s", want, after, wait)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+	"sort"
+)
+
+// time after which the funds of a balance transaction become available, in
+// seconds
+const availableDelay = 2 * 24 * 60 * 60
+
+func (s *Server) registerBalance() {
+	s.handle("GET", "balance", s.retrieveBalance)
+	s.handle("GET", "balance_transactions", s.listBalanceTransactions)
+	s.handle("GET", "balance_transactions/:", s.retrieveBalanceTransaction)
+}
+
+// transaction records the change to the balance caused by the source, a
+// charge, refund or dispute, and links the source to it. The funds are
+// pending until they become available.
+func (s *Server) transaction(kind string, source object, amount, fee int64, details []object) object {
+	created := now()
+	txn := object{
+		"id":           s.newID("txn"),
+		"object":       "balance_transaction",
+		"type":         kind,
+		"amount":       amount,
+		"currency":     source["currency"],
+		"fee":          fee,
+		"fee_details":  details,
+		"net":          amount - fee,
+		"source":       source["id"],
+		"status":       "pending",
+		"description":  source["description"],
+		"created":      created,
+		"available_on": created + availableDelay,
+	}
+	s.put("balance_transactions", txn)
+	source["balance_transaction"] = txn["id"]
+	return txn
+}
+
+// chargeTransaction records the captured amount of the charge, less its
+// fees.
+func (s *Server) chargeTransaction(charge object) object {
+	details, _ := charge["fee_details"].([]object)
+	return s.transaction("charge", charge, toInt64(charge["amount_captured"]), toInt64(charge["fee"]), details)
+}
+
+// settle makes the funds of the transaction available, once they are due.
+func settle(txn object) object {
+	if txn["status"] == "pending" && now() >= toInt64(txn["available_on"]) {
+		txn["status"] = "available"
+	}
+	return txn
+}
+
+func (s *Server) retrieveBalance(args []string, form url.Values) (interface{}, error) {
+	available, pending := map[string]int64{}, map[string]int64{}
+	for _, txn := range s.all("balance_transactions", nil) {
+		currency := txn["currency"].(string)
+		if _, ok := available[currency]; !ok {
+			available[currency], pending[currency] = 0, 0
+		}
+		if settle(txn)["status"] == "available" {
+			available[currency] += toInt64(txn["net"])
+		} else {
+			pending[currency] += toInt64(txn["net"])
+		}
+	}
+	amounts := func(funds map[string]int64) []object {
+		currencies := make([]string, 0, len(funds))
+		for currency := range funds {
+			currencies = append(currencies, currency)
+		}
+		sort.Strings(currencies)
+		list := make([]object, len(currencies))
+		for i, currency := range currencies {
+			list[i] = object{"amount": funds[currency], "currency": currency}
+		}
+		return list
+	}
+	return object{
+		"object":    "balance",
+		"available": amounts(available),
+		"pending":   amounts(pending),
+		"livemode":  false,
+	}, nil
+}
+
+func (s *Server) retrieveBalanceTransaction(args []string, form url.Values) (interface{}, error) {
+	txn := s.get("balance_transactions", args[0])
+	if txn == nil {
+		return nil, notFound("balance_transaction", args[0])
+	}
+	return settle(txn), nil
+}
+
+func (s *Server) listBalanceTransactions(args []string, form url.Values) (interface{}, error) {
+	filter := func(txn object) bool {
+		settle(txn)
+		if v := form.Get("type"); v != "" && txn["type"] != v {
+			return false
+		}
+		if v := form.Get("source"); v != "" && txn["source"] != v {
+			return false
+		}
+		return matchRange(form, "available_on", toInt64(txn["available_on"])) &&
+			matchRange(form, "created", toInt64(txn["created"]))
+	}
+	return s.list("balance_transactions", s.all("balance_transactions", filter), form), nil
+}
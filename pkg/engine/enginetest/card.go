@@ -0,0 +1,201 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// declines maps the test card numbers that are declined when charged to the
+// resulting error code and message.
+var declines = map[string][2]string{
+	"4000000000000341": {"card_declined", "Your card was declined."},
+	"4000000000000002": {"card_declined", "Your card was declined."},
+	"4000000000000127": {"incorrect_cvc", "Your card's security code is incorrect."},
+	"4000000000000069": {"expired_card", "Your card has expired."},
+	"4000000000000119": {"processing_error", "An error occurred while processing your card."},
+}
+
+func (s *Server) registerCards() {
+	s.handle("POST", "customers/:/cards", s.createCard)
+	s.handle("DELETE", "customers/:/cards/:", s.deleteCard)
+}
+
+func (s *Server) createCard(args []string, form url.Values) (interface{}, error) {
+	customer := s.get("customers", args[0])
+	if customer == nil {
+		return nil, notFound("customer", args[0])
+	}
+	card, err := s.cardParam(form)
+	if err != nil {
+		return nil, err
+	}
+	if card == nil {
+		return nil, invalidRequest("card", "Missing required param: card.")
+	}
+	s.attachCard(customer, card)
+	return card, nil
+}
+
+func (s *Server) deleteCard(args []string, form url.Values) (interface{}, error) {
+	customer := s.get("customers", args[0])
+	if customer == nil {
+		return nil, notFound("customer", args[0])
+	}
+	card := s.get("cards", args[1])
+	if card == nil || card["customer"] != args[0] {
+		return nil, notFound("card", args[1])
+	}
+	s.remove("cards", args[1])
+	if customer["default_card"] == args[1] {
+		customer["default_card"] = nil
+		if cards := s.customerCards(args[0]); len(cards) != 0 {
+			customer["default_card"] = cards[0]["id"]
+		}
+	}
+	return object{"id": args[1], "deleted": true}, nil
+}
+
+// cardParam returns the card sent either as card[...] parameters or as a
+// token in the card parameter, or nil if neither was sent.
+func (s *Server) cardParam(form url.Values) (object, error) {
+	if token := form.Get("card"); token != "" {
+		return s.useToken(token)
+	}
+	if hashParam(form, "card") == nil {
+		return nil, nil
+	}
+	return s.newCard(form)
+}
+
+// newCard validates the card[...] parameters and stores a new card.
+func (s *Server) newCard(form url.Values) (object, error) {
+	params := hashParam(form, "card")
+	number := strings.Replace(params["number"], " ", "", -1)
+	if number == "" {
+		return nil, invalidRequest("card[number]", "Missing required param: card[number].")
+	}
+	if !luhnValid(number) {
+		return nil, cardError("incorrect_number", "Your card number is incorrect.")
+	}
+	month, err := strconv.Atoi(params["exp_month"])
+	if err != nil || month < 1 || month > 12 {
+		return nil, cardError("invalid_expiry_month", "Your card's expiration month is invalid.")
+	}
+	year, err := strconv.Atoi(params["exp_year"])
+	if err != nil || year < 1970 {
+		return nil, cardError("invalid_expiry_year", "Your card's expiration year is invalid.")
+	}
+
+	card := object{
+		"id":              s.newID("card"),
+		"object":          "card",
+		"name":            nullable(params["name"]),
+		"type":            cardType(number),
+		"exp_month":       month,
+		"exp_year":        year,
+		"last4":           number[len(number)-4:],
+		"fingerprint":     "fp_" + number[len(number)-8:],
+		"country":         "IN",
+		"address_line1":   nullable(params["address_line1"]),
+		"address_line2":   nullable(params["address_line2"]),
+		"address_city":    nullable(params["address_city"]),
+		"address_state":   nullable(params["address_state"]),
+		"address_pin":     nullable(params["address_pin"]),
+		"address_country": nullable(params["address_country"]),
+		"cvc_check":       nil,
+		"customer":        nil,
+	}
+	if params["cvc"] != "" {
+		card["cvc_check"] = "pass"
+	}
+	s.put("cards", card)
+	s.numbers[card["id"].(string)] = number
+	return card, nil
+}
+
+// chargeCard returns the error, if any, of charging the card.
+func (s *Server) chargeCard(card object) error {
+	if decline, ok := declines[s.numbers[card["id"].(string)]]; ok {
+		return cardError(decline[0], decline[1])
+	}
+	return nil
+}
+
+// attachCard attaches a card to a customer, making it the default card.
+func (s *Server) attachCard(customer, card object) {
+	card["customer"] = customer["id"]
+	customer["default_card"] = card["id"]
+}
+
+// customerCards returns the cards attached to a customer.
+func (s *Server) customerCards(id string) []object {
+	return s.all("cards", func(card object) bool {
+		return card["customer"] == id
+	})
+}
+
+// nullable returns nil for an empty string, which is encoded as null.
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// luhnValid verifies the checksum of a card number.
+func luhnValid(number string) bool {
+	sum := 0
+	for i, even := len(number)-1, false; i >= 0; i, even = i-1, !even {
+		digit := int(number[i] - '0')
+		if digit < 0 || digit > 9 {
+			return false
+		}
+		if even {
+			if digit *= 2; digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+// cardType returns the brand of a card number.
+func cardType(number string) string {
+	switch {
+	case strings.HasPrefix(number, "4"):
+		return "Visa"
+	case strings.HasPrefix(number, "34"), strings.HasPrefix(number, "37"):
+		return "American Express"
+	case strings.HasPrefix(number, "6011"):
+		return "Discover"
+	case strings.HasPrefix(number, "35"):
+		return "RuPay"
+	case strings.HasPrefix(number, "30"), strings.HasPrefix(number, "36"), strings.HasPrefix(number, "38"):
+		return "Diners Club"
+	case number[0] == '5' && number[1] >= '1' && number[1] <= '5':
+		return "MasterCard"
+	}
+	return "Unknown"
+}
@@ -0,0 +1,322 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// minimum amount of a charge, in paisa
+const minChargeAmount = 50
+
+// time after which an uncaptured charge expires, in seconds
+const captureWindow = 7 * 24 * 60 * 60
+
+func (s *Server) registerCharges() {
+	s.handle("POST", "charges", s.createCharge)
+	s.handle("GET", "charges", s.listCharges)
+	s.handle("GET", "charges/:", s.retrieveCharge)
+	s.handle("POST", "charges/:", s.updateCharge)
+	s.handle("POST", "charges/:/refund", s.refundCharge)
+	s.handle("POST", "charges/:/capture", s.captureCharge)
+}
+
+func (s *Server) createCharge(args []string, form url.Values) (interface{}, error) {
+	amount, ok, err := amountParam(form, "amount")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, invalidRequest("amount", "Missing required param: amount.")
+	}
+	if amount < minChargeAmount {
+		return nil, invalidRequest("amount", "Amount must be at least %d paisa.", minChargeAmount)
+	}
+	currency, err := currencyParam(form)
+	if err != nil {
+		return nil, err
+	}
+	capture, err := boolParam(form, "capture", true)
+	if err != nil {
+		return nil, err
+	}
+
+	// charge either the card, or the customer's default card
+	var customer object
+	card, err := s.cardParam(form)
+	if err != nil {
+		return nil, err
+	}
+	if card == nil {
+		id := form.Get("customer")
+		if id == "" {
+			return nil, invalidRequest("card", "You must supply either a card or a customer id.")
+		}
+		if customer = s.get("customers", id); customer == nil {
+			return nil, notFound("customer", id)
+		}
+		if id, _ := customer["default_card"].(string); id != "" {
+			card = s.get("cards", id)
+		}
+		if card == nil {
+			return nil, invalidRequest("card", "Cannot charge a customer that has no active card.")
+		}
+	}
+	if err := s.chargeCard(card); err != nil {
+		return nil, err
+	}
+
+	charge := s.newCharge(amount, currency, card, customer)
+	charge["description"] = nullable(form.Get("description"))
+	if v := form.Get("statement_description"); v != "" {
+		charge["statement_description"] = v
+	}
+	charge["receipt_email"] = nullable(form.Get("receipt_email"))
+	metadataParam(form, charge)
+
+	// an uncaptured charge only holds the amount, and is charged no fee
+	// until it is captured
+	if !capture {
+		charge["captured"] = false
+		charge["amount_captured"] = int64(0)
+		charge["capture_before"] = toInt64(charge["created"]) + captureWindow
+		setFee(charge, 0)
+	}
+	s.put("charges", charge)
+	s.emit("charge.succeeded", charge)
+	if capture {
+		s.chargeTransaction(charge)
+		s.dispute(charge)
+	}
+	return charge, nil
+}
+
+// newCharge returns a paid and captured charge against the card.
+func (s *Server) newCharge(amount int64, currency string, card, customer object) object {
+	charge := object{
+		"id":                    s.newID("ch"),
+		"object":                "charge",
+		"amount":                amount,
+		"currency":              currency,
+		"created":               now(),
+		"card":                  card,
+		"customer":              nil,
+		"invoice":               nil,
+		"description":           nil,
+		"paid":                  true,
+		"captured":              true,
+		"amount_captured":       amount,
+		"capture_before":        nil,
+		"refunded":              false,
+		"amount_refunded":       int64(0),
+		"refunds":               object{"object": "list", "url": "/v1/refunds", "has_more": false, "total_count": 0, "data": []object{}},
+		"failure_message":       nil,
+		"disputed":              false,
+		"dispute":               nil,
+		"balance_transaction":   nil,
+		"livemode":              false,
+		"statement_description": "",
+		"receipt_email":         nil,
+		"fraud_details":         object{},
+		"metadata":              map[string]string{},
+	}
+	if customer != nil {
+		charge["customer"] = customer["id"]
+	}
+	setFee(charge, amount)
+	return charge
+}
+
+// setFee sets the fee of the charge for the captured amount, which is 2% +
+// 30, or nothing if no amount was captured.
+func setFee(charge object, captured int64) {
+	var fee int64
+	details := []object{}
+	if captured > 0 {
+		fee = captured*2/100 + 30
+		details = append(details, object{"amount": fee, "currency": charge["currency"], "type": "bhojpur_fee", "application": nil})
+	}
+	charge["fee"] = fee
+	charge["fee_details"] = details
+}
+
+func (s *Server) captureCharge(args []string, form url.Values) (interface{}, error) {
+	charge := s.get("charges", args[0])
+	if charge == nil {
+		return nil, notFound("charge", args[0])
+	}
+	if charge["captured"] == true {
+		return nil, invalidRequest("charge", "Charge %s has already been captured.", args[0])
+	}
+	if charge["refunded"] == true {
+		return nil, invalidRequest("charge", "Charge %s has been released, and can no longer be captured.", args[0])
+	}
+	if now() > toInt64(charge["capture_before"]) {
+		return nil, invalidRequest("charge", "Charge %s has expired, and can no longer be captured.", args[0])
+	}
+	total := toInt64(charge["amount"])
+	amount, ok, err := amountParam(form, "amount")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		amount = total
+	}
+	if amount < minChargeAmount || amount > total {
+		return nil, invalidRequest("amount", "Capture amount must be between %d and the amount of the charge (%d).", minChargeAmount, total)
+	}
+
+	charge["captured"] = true
+	charge["amount_captured"] = amount
+	charge["capture_before"] = nil
+	setFee(charge, amount)
+	s.chargeTransaction(charge)
+	s.emit("charge.captured", charge)
+
+	// the rest of the authorization is released
+	if amount < total {
+		if _, err := s.refund(charge, total-amount); err != nil {
+			return nil, err
+		}
+	}
+	return charge, nil
+}
+
+func (s *Server) retrieveCharge(args []string, form url.Values) (interface{}, error) {
+	charge := s.get("charges", args[0])
+	if charge == nil {
+		return nil, notFound("charge", args[0])
+	}
+	return charge, nil
+}
+
+func (s *Server) updateCharge(args []string, form url.Values) (interface{}, error) {
+	charge := s.get("charges", args[0])
+	if charge == nil {
+		return nil, notFound("charge", args[0])
+	}
+	if v := form.Get("fraud_details[user_report]"); v != "" {
+		if v != "safe" && v != "fraudulent" {
+			return nil, invalidRequest("fraud_details[user_report]", "Invalid user report: %s", v)
+		}
+		charge["fraud_details"].(object)["user_report"] = v
+	}
+	if v := form.Get("description"); v != "" {
+		charge["description"] = v
+	}
+	if v := form.Get("receipt_email"); v != "" {
+		charge["receipt_email"] = v
+	}
+	metadataParam(form, charge)
+	s.emit("charge.updated", charge)
+	return charge, nil
+}
+
+func (s *Server) refundCharge(args []string, form url.Values) (interface{}, error) {
+	charge := s.get("charges", args[0])
+	if charge == nil {
+		return nil, notFound("charge", args[0])
+	}
+	remaining := toInt64(charge["amount"]) - toInt64(charge["amount_refunded"])
+	amount, ok, err := amountParam(form, "amount")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		amount = remaining
+	}
+	if _, err := s.refund(charge, amount); err != nil {
+		return nil, err
+	}
+	return charge, nil
+}
+
+// refund refunds the amount of the charge, and returns the refund.
+func (s *Server) refund(charge object, amount int64) (object, error) {
+	remaining := toInt64(charge["amount"]) - toInt64(charge["amount_refunded"])
+	if remaining == 0 {
+		return nil, invalidRequest("charge", "Charge %s has already been refunded.", charge["id"])
+	}
+	if amount <= 0 || amount > remaining {
+		return nil, invalidRequest("amount", "Refund amount (%d) is greater than unrefunded amount on charge (%d).", amount, remaining)
+	}
+	if charge["captured"] == false && amount != remaining {
+		return nil, invalidRequest("amount", "An uncaptured charge can only be released in full.")
+	}
+
+	refund := object{
+		"id":                  s.newID("re"),
+		"object":              "refund",
+		"amount":              amount,
+		"currency":            charge["currency"],
+		"charge":              charge["id"],
+		"reason":              nil,
+		"balance_transaction": nil,
+		"created":             now(),
+		"metadata":            map[string]string{},
+		"livemode":            false,
+	}
+	s.put("refunds", refund)
+
+	// only the captured part of the charge is taken back from the balance,
+	// since any uncaptured part was released first
+	uncaptured := toInt64(charge["amount"]) - toInt64(charge["amount_captured"])
+	refunded := toInt64(charge["amount_refunded"])
+	if captured := refunded + amount - uncaptured; captured > 0 {
+		if refunded > uncaptured {
+			captured = amount
+		}
+		s.transaction("refund", refund, -captured, 0, []object{})
+	}
+
+	// the charge embeds all of its refunds, most recent first
+	refunds := charge["refunds"].(object)
+	data := append([]object{refund}, refunds["data"].([]object)...)
+	refunds["data"], refunds["total_count"] = data, len(data)
+
+	charge["amount_refunded"] = toInt64(charge["amount_refunded"]) + amount
+	charge["refunded"] = toInt64(charge["amount_refunded"]) == toInt64(charge["amount"])
+	s.emit("charge.refunded", charge)
+	return refund, nil
+}
+
+func (s *Server) listCharges(args []string, form url.Values) (interface{}, error) {
+	filter := func(charge object) bool {
+		if v := form.Get("customer"); v != "" && charge["customer"] != v {
+			return false
+		}
+		if v := form.Get("invoice"); v != "" && charge["invoice"] != v {
+			return false
+		}
+		if v := form.Get("currency"); v != "" && charge["currency"] != v {
+			return false
+		}
+		if v := form.Get("paid"); v != "" && strconv.FormatBool(charge["paid"] == true) != v {
+			return false
+		}
+		if v := form.Get("refunded"); v != "" && strconv.FormatBool(charge["refunded"] == true) != v {
+			return false
+		}
+		return matchRange(form, "created", toInt64(charge["created"]))
+	}
+	return s.list("charges", s.all("charges", filter), form), nil
+}
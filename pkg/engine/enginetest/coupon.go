@@ -0,0 +1,175 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+)
+
+func (s *Server) registerCoupons() {
+	s.handle("POST", "coupons", s.createCoupon)
+	s.handle("GET", "coupons", s.listCoupons)
+	s.handle("GET", "coupons/:", s.retrieveCoupon)
+	s.handle("DELETE", "coupons/:", s.deleteCoupon)
+}
+
+func (s *Server) createCoupon(args []string, form url.Values) (interface{}, error) {
+	id := form.Get("id")
+	if id == "" {
+		id = s.newID("co")
+	} else if s.get("coupons", id) != nil {
+		return nil, invalidRequest("id", "Coupon already exists.")
+	}
+
+	percentOff, err := intParam(form, "percent_off", 0)
+	if err != nil {
+		return nil, err
+	}
+	if percentOff < 1 || percentOff > 100 {
+		return nil, invalidRequest("percent_off", "Invalid percent_off: must be between 1 and 100.")
+	}
+	duration := form.Get("duration")
+	switch duration {
+	case "forever", "once", "repeating":
+	case "":
+		return nil, invalidRequest("duration", "Missing required param: duration.")
+	default:
+		return nil, invalidRequest("duration", "Invalid duration: %s.", duration)
+	}
+	months, err := intParam(form, "duration_in_months", 0)
+	if err != nil {
+		return nil, err
+	}
+	if duration == "repeating" && months < 1 {
+		return nil, invalidRequest("duration_in_months", "Missing required param: duration_in_months.")
+	}
+	maxRedemptions, err := intParam(form, "max_redemptions", 0)
+	if err != nil {
+		return nil, err
+	}
+	redeemBy, err := intParam(form, "redeem_by", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	coupon := object{
+		"id":                 id,
+		"object":             "coupon",
+		"percent_off":        percentOff,
+		"duration":           duration,
+		"duration_in_months": nil,
+		"max_redemptions":    nil,
+		"redeem_by":          nil,
+		"times_redeemed":     0,
+		"livemode":           false,
+	}
+	if months != 0 {
+		coupon["duration_in_months"] = months
+	}
+	if maxRedemptions != 0 {
+		coupon["max_redemptions"] = maxRedemptions
+	}
+	if redeemBy != 0 {
+		coupon["redeem_by"] = redeemBy
+	}
+	s.put("coupons", coupon)
+	return coupon, nil
+}
+
+func (s *Server) retrieveCoupon(args []string, form url.Values) (interface{}, error) {
+	coupon := s.get("coupons", args[0])
+	if coupon == nil {
+		return nil, notFound("coupon", args[0])
+	}
+	return coupon, nil
+}
+
+func (s *Server) deleteCoupon(args []string, form url.Values) (interface{}, error) {
+	if s.get("coupons", args[0]) == nil {
+		return nil, notFound("coupon", args[0])
+	}
+	s.remove("coupons", args[0])
+	return object{"id": args[0], "deleted": true}, nil
+}
+
+func (s *Server) listCoupons(args []string, form url.Values) (interface{}, error) {
+	return s.list("coupons", s.all("coupons", nil), form), nil
+}
+
+// couponParam returns the coupon sent in the coupon parameter, if it can
+// still be redeemed, or nil if it was not sent.
+func (s *Server) couponParam(form url.Values) (object, error) {
+	id := form.Get("coupon")
+	if id == "" {
+		return nil, nil
+	}
+	coupon := s.get("coupons", id)
+	if coupon == nil {
+		return nil, invalidRequest("coupon", "No such coupon: %s", id)
+	}
+	if max := toInt64(coupon["max_redemptions"]); max != 0 && toInt64(coupon["times_redeemed"]) >= max {
+		return nil, invalidRequest("coupon", "Coupon expired: %s", id)
+	}
+	if redeemBy := toInt64(coupon["redeem_by"]); redeemBy != 0 && now() > redeemBy {
+		return nil, invalidRequest("coupon", "Coupon expired: %s", id)
+	}
+	return coupon, nil
+}
+
+// applyCoupon applies a discount to a customer, redeeming the coupon.
+func (s *Server) applyCoupon(customer, coupon object) {
+	coupon["times_redeemed"] = toInt64(coupon["times_redeemed"]) + 1
+	customer["discount"] = s.newDiscount(customer, coupon)
+}
+
+// newDiscount returns the discount a customer would get from a coupon,
+// starting now.
+func (s *Server) newDiscount(customer, coupon object) object {
+	start := now()
+	var end interface{}
+	switch coupon["duration"] {
+	case "once":
+		end = addInterval(start, "month", 1)
+	case "repeating":
+		end = addInterval(start, "month", toInt64(coupon["duration_in_months"]))
+	}
+	return object{
+		"id":       s.newID("di"),
+		"object":   "discount",
+		"customer": customer["id"],
+		"start":    start,
+		"end":      end,
+		"coupon":   coupon,
+	}
+}
+
+// discounted returns the amount after applying the customer's discount.
+func discounted(customer object, amount int64) int64 {
+	discount, _ := customer["discount"].(object)
+	if discount == nil {
+		return amount
+	}
+	if end := toInt64(discount["end"]); end != 0 && now() > end {
+		return amount
+	}
+	percentOff := toInt64(discount["coupon"].(object)["percent_off"])
+	return amount - amount*percentOff/100
+}
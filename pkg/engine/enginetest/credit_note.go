@@ -0,0 +1,206 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// creditNoteReasons are the valid reasons for issuing a credit note.
+var creditNoteReasons = map[string]bool{
+	"duplicate":              true,
+	"fraudulent":             true,
+	"order_change":           true,
+	"product_unsatisfactory": true,
+}
+
+func (s *Server) registerCreditNotes() {
+	s.handle("GET", "credit_notes/preview", s.previewCreditNote)
+	s.handle("POST", "credit_notes", s.createCreditNote)
+	s.handle("GET", "credit_notes", s.listCreditNotes)
+	s.handle("GET", "credit_notes/:", s.retrieveCreditNote)
+}
+
+func (s *Server) previewCreditNote(args []string, form url.Values) (interface{}, error) {
+	return s.newCreditNote(form)
+}
+
+func (s *Server) createCreditNote(args []string, form url.Values) (interface{}, error) {
+	note, err := s.newCreditNote(form)
+	if err != nil {
+		return nil, err
+	}
+
+	// the credit is either refunded, or applied to the next invoice
+	invoice := s.get("invoices", note["invoice"].(string))
+	if amount := toInt64(note["refund_amount"]); amount != 0 {
+		refund, err := s.refund(s.get("charges", invoice["charge"].(string)), amount)
+		if err != nil {
+			return nil, err
+		}
+		note["refund"] = refund["id"]
+	} else if customer := s.get("customers", note["customer"].(string)); customer != nil {
+		customer["account_balance"] = toInt64(customer["account_balance"]) - toInt64(note["credit_amount"])
+	}
+
+	note["id"] = s.newID("cn")
+	s.put("credit_notes", note)
+	s.emit("credit_note.created", note)
+	return note, nil
+}
+
+// newCreditNote returns the credit note for the parameters, without issuing
+// it. The amount credited for each line, and for the whole invoice, is
+// limited to the amount that was not credited by earlier credit notes.
+func (s *Server) newCreditNote(form url.Values) (object, error) {
+	id := form.Get("invoice")
+	if id == "" {
+		return nil, invalidRequest("invoice", "Missing required param: invoice.")
+	}
+	invoice := s.get("invoices", id)
+	if invoice == nil {
+		return nil, notFound("invoice", id)
+	}
+	if invoice["status"] != "paid" {
+		return nil, invalidRequest("invoice", "Credit notes can only be issued for paid invoices, but invoice %s is %s.", id, invoice["status"])
+	}
+	reason := form.Get("reason")
+	if reason != "" && !creditNoteReasons[reason] {
+		return nil, invalidRequest("reason", "Invalid reason: %s", reason)
+	}
+	refund, err := boolParam(form, "refund", false)
+	if err != nil {
+		return nil, err
+	}
+	if refund && invoice["charge"] == nil {
+		return nil, invalidRequest("refund", "Invoice %s was not paid by card, and cannot be refunded.", id)
+	}
+
+	var credited int64
+	creditedLines := make(map[interface{}]int64)
+	for _, note := range s.creditNotes(id) {
+		credited += toInt64(note["amount"])
+		for _, line := range note["lines"].([]object) {
+			creditedLines[line["invoice_line_item"]] += toInt64(line["amount"])
+		}
+	}
+
+	lines := []object{}
+	var amount int64
+	invoiceLines := invoiceLines(invoice["lines"].(object))
+	for i := 0; ; i++ {
+		key := "lines[" + strconv.Itoa(i) + "]"
+		params := hashParam(form, key)
+		if params == nil {
+			break
+		}
+		var line object
+		for _, l := range invoiceLines {
+			if l["id"] != nil && l["id"] == params["invoice_line_item"] {
+				line = l
+			}
+		}
+		if line == nil {
+			return nil, invalidRequest(key+"[invoice_line_item]", "No such invoice line: %s", params["invoice_line_item"])
+		}
+		remaining := toInt64(line["amount"]) - creditedLines[line["id"]]
+		lineAmount := remaining
+		if v := params["amount"]; v != "" {
+			if lineAmount, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, invalidRequest(key+"[amount]", "Invalid integer: %s", v)
+			}
+		}
+		if lineAmount <= 0 || lineAmount > remaining {
+			return nil, invalidRequest(key+"[amount]", "The amount to credit (%d) is greater than the amount of the line that was not credited yet (%d).", lineAmount, remaining)
+		}
+		creditedLines[line["id"]] += lineAmount
+		amount += lineAmount
+		lines = append(lines, object{
+			"invoice_line_item": line["id"],
+			"amount":            lineAmount,
+			"description":       line["description"],
+		})
+	}
+	if len(lines) == 0 {
+		var ok bool
+		if amount, ok, err = amountParam(form, "amount"); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, invalidRequest("amount", "Missing required param: lines or amount.")
+		}
+	}
+	if remaining := toInt64(invoice["total"]) - credited; amount <= 0 || amount > remaining {
+		return nil, invalidRequest("amount", "The amount to credit (%d) is greater than the amount of the invoice that was not credited yet (%d).", amount, remaining)
+	}
+
+	note := object{
+		"id":            nil,
+		"object":        "credit_note",
+		"invoice":       id,
+		"customer":      invoice["customer"],
+		"amount":        amount,
+		"currency":      invoice["currency"],
+		"lines":         lines,
+		"reason":        nullable(reason),
+		"memo":          nullable(form.Get("memo")),
+		"refund_amount": int64(0),
+		"refund":        nil,
+		"credit_amount": int64(0),
+		"created":       now(),
+		"livemode":      false,
+	}
+	if refund {
+		note["refund_amount"] = amount
+	} else {
+		note["credit_amount"] = amount
+	}
+	metadataParam(form, note)
+	return note, nil
+}
+
+func (s *Server) retrieveCreditNote(args []string, form url.Values) (interface{}, error) {
+	note := s.get("credit_notes", args[0])
+	if note == nil {
+		return nil, notFound("credit_note", args[0])
+	}
+	return note, nil
+}
+
+func (s *Server) listCreditNotes(args []string, form url.Values) (interface{}, error) {
+	filter := func(note object) bool {
+		if v := form.Get("invoice"); v != "" && note["invoice"] != v {
+			return false
+		}
+		if v := form.Get("customer"); v != "" && note["customer"] != v {
+			return false
+		}
+		return true
+	}
+	return s.list("credit_notes", s.all("credit_notes", filter), form), nil
+}
+
+// creditNotes returns the credit notes issued against the invoice.
+func (s *Server) creditNotes(invoice string) []object {
+	return s.all("credit_notes", func(note object) bool {
+		return note["invoice"] == invoice
+	})
+}
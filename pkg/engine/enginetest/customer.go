@@ -0,0 +1,169 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+)
+
+func (s *Server) registerCustomers() {
+	s.handle("POST", "customers", s.createCustomer)
+	s.handle("GET", "customers", s.listCustomers)
+	s.handle("GET", "customers/:", s.retrieveCustomer)
+	s.handle("POST", "customers/:", s.updateCustomer)
+	s.handle("DELETE", "customers/:", s.deleteCustomer)
+}
+
+func (s *Server) createCustomer(args []string, form url.Values) (interface{}, error) {
+	customer := object{
+		"id":              s.newID("cus"),
+		"object":          "customer",
+		"created":         now(),
+		"email":           nil,
+		"description":     nil,
+		"account_balance": int64(0),
+		"currency":        nil,
+		"delinquent":      false,
+		"discount":        nil,
+		"default_card":    nil,
+		"livemode":        false,
+		"metadata":        map[string]string{},
+	}
+	if err := s.applyCustomerParams(customer, form); err != nil {
+		return nil, err
+	}
+	s.put("customers", customer)
+	s.emit("customer.created", s.renderCustomer(customer))
+	return s.renderCustomer(customer), nil
+}
+
+func (s *Server) retrieveCustomer(args []string, form url.Values) (interface{}, error) {
+	customer := s.get("customers", args[0])
+	if customer == nil {
+		return nil, notFound("customer", args[0])
+	}
+	return s.renderCustomer(customer), nil
+}
+
+func (s *Server) updateCustomer(args []string, form url.Values) (interface{}, error) {
+	customer := s.get("customers", args[0])
+	if customer == nil {
+		return nil, notFound("customer", args[0])
+	}
+	if err := s.applyCustomerParams(customer, form); err != nil {
+		return nil, err
+	}
+	s.emit("customer.updated", s.renderCustomer(customer))
+	return s.renderCustomer(customer), nil
+}
+
+func (s *Server) deleteCustomer(args []string, form url.Values) (interface{}, error) {
+	customer := s.get("customers", args[0])
+	if customer == nil {
+		return nil, notFound("customer", args[0])
+	}
+	rendered := s.renderCustomer(customer)
+	s.remove("customers", args[0])
+	s.emit("customer.deleted", rendered)
+	return object{"id": args[0], "deleted": true}, nil
+}
+
+func (s *Server) listCustomers(args []string, form url.Values) (interface{}, error) {
+	var customers []object
+	for _, customer := range s.all("customers", func(customer object) bool {
+		return matchRange(form, "created", toInt64(customer["created"]))
+	}) {
+		customers = append(customers, s.renderCustomer(customer))
+	}
+	return s.list("customers", customers, form), nil
+}
+
+// applyCustomerParams validates and applies the parameters used to create or
+// update a customer.
+func (s *Server) applyCustomerParams(customer object, form url.Values) error {
+	coupon, err := s.couponParam(form)
+	if err != nil {
+		return err
+	}
+	var plan object
+	if id := form.Get("plan"); id != "" {
+		if plan = s.get("plans", id); plan == nil {
+			return invalidRequest("plan", "No such plan: %s", id)
+		}
+	}
+	balance, hasBalance, err := amountParam(form, "account_balance")
+	if err != nil {
+		return err
+	}
+	card, err := s.cardParam(form)
+	if err != nil {
+		return err
+	}
+
+	if v := form.Get("email"); v != "" {
+		customer["email"] = v
+	}
+	if v := form.Get("description"); v != "" {
+		customer["description"] = v
+	}
+	if hasBalance {
+		customer["account_balance"] = balance
+	}
+	metadataParam(form, customer)
+	if card != nil {
+		s.attachCard(customer, card)
+	}
+	if coupon != nil {
+		s.applyCoupon(customer, coupon)
+	}
+	if plan != nil {
+		// a plan updates the customer's latest subscription, if there is one
+		var sub object
+		if subs := s.customerSubscriptions(customer["id"].(string)); len(subs) != 0 {
+			sub = subs[0]
+		}
+		if _, err := s.subscribe(customer, sub, plan, form); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderCustomer returns a customer with its cards and subscriptions.
+func (s *Server) renderCustomer(customer object) object {
+	id := customer["id"].(string)
+	c := cloneObject(customer)
+	cards := s.customerCards(id)
+	c["cards"] = object{
+		"object": "list",
+		"count":  len(cards),
+		"url":    "/v1/customers/" + id + "/cards",
+		"data":   cards,
+	}
+	subs := s.customerSubscriptions(id)
+	c["subscriptions"] = object{
+		"object": "list",
+		"count":  len(subs),
+		"url":    "/v1/customers/" + id + "/subscriptions",
+		"data":   subs,
+	}
+	return c
+}
@@ -0,0 +1,164 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+)
+
+// time the merchant has to respond to a dispute, in seconds
+const evidenceWindow = 7 * 24 * 60 * 60
+
+// disputes maps the test card numbers whose charges succeed, but are then
+// disputed, to the reason of the dispute.
+var disputes = map[string]string{
+	"4000000000000259": "fraudulent",
+	"4000000000002685": "product_not_received",
+}
+
+// disputeEvidence are the evidence[...] parameters of a dispute.
+var disputeEvidence = []string{"receipt", "customer_communication", "service_date", "refund_policy"}
+
+func (s *Server) registerDisputes() {
+	s.handle("GET", "disputes", s.listDisputes)
+	s.handle("GET", "disputes/:", s.retrieveDispute)
+	s.handle("POST", "disputes/:", s.updateDispute)
+	s.handle("POST", "disputes/:/close", s.closeDispute)
+}
+
+// dispute disputes the charge, if it was made with a card that is disputed.
+func (s *Server) dispute(charge object) {
+	card, _ := charge["card"].(object)
+	if card == nil {
+		return
+	}
+	reason, ok := disputes[s.numbers[card["id"].(string)]]
+	if !ok {
+		return
+	}
+
+	created := now()
+	evidence := object{}
+	for _, key := range disputeEvidence {
+		evidence[key] = nil
+	}
+	dispute := object{
+		"id":       s.newID("dp"),
+		"object":   "dispute",
+		"amount":   charge["amount"],
+		"currency": charge["currency"],
+		"charge":   charge["id"],
+		"reason":   reason,
+		"status":   "needs_response",
+		"evidence": evidence,
+		"evidence_details": object{
+			"due_by":           created + evidenceWindow,
+			"has_evidence":     false,
+			"past_due":         false,
+			"submission_count": 0,
+		},
+		"is_charge_refundable": false,
+		"created":              created,
+		"metadata":             map[string]string{},
+		"livemode":             false,
+	}
+	s.put("disputes", dispute)
+
+	// the disputed amount is withdrawn from the balance
+	s.transaction("adjustment", dispute, -toInt64(dispute["amount"]), 0, []object{})
+	charge["disputed"] = true
+	charge["dispute"] = dispute["id"]
+	s.emit("charge.dispute.created", dispute)
+}
+
+func (s *Server) retrieveDispute(args []string, form url.Values) (interface{}, error) {
+	dispute := s.get("disputes", args[0])
+	if dispute == nil {
+		return nil, notFound("dispute", args[0])
+	}
+	return dispute, nil
+}
+
+func (s *Server) updateDispute(args []string, form url.Values) (interface{}, error) {
+	dispute := s.get("disputes", args[0])
+	if dispute == nil {
+		return nil, notFound("dispute", args[0])
+	}
+	submit, err := boolParam(form, "submit", true)
+	if err != nil {
+		return nil, err
+	}
+
+	// evidence is submitted by default, but only if there is any
+	params := hashParam(form, "evidence")
+	submit = submit && (params != nil || form.Get("submit") != "")
+	details := dispute["evidence_details"].(object)
+	if params != nil || submit {
+		if dispute["status"] != "needs_response" {
+			return nil, invalidRequest("evidence", "This dispute is %s, and its evidence can no longer be updated.", dispute["status"])
+		}
+		if now() > toInt64(details["due_by"]) {
+			details["past_due"] = true
+			return nil, invalidRequest("evidence", "The evidence for this dispute was due by %d.", details["due_by"])
+		}
+	}
+
+	evidence := dispute["evidence"].(object)
+	for _, key := range disputeEvidence {
+		if v := params[key]; v != "" {
+			evidence[key] = v
+			details["has_evidence"] = true
+		}
+	}
+	if submit {
+		dispute["status"] = "under_review"
+		details["submission_count"] = toInt64(details["submission_count"]) + 1
+	}
+	metadataParam(form, dispute)
+	s.emit("charge.dispute.updated", dispute)
+	return dispute, nil
+}
+
+func (s *Server) closeDispute(args []string, form url.Values) (interface{}, error) {
+	dispute := s.get("disputes", args[0])
+	if dispute == nil {
+		return nil, notFound("dispute", args[0])
+	}
+	if dispute["status"] != "needs_response" {
+		return nil, invalidRequest("dispute", "This dispute is %s, and can no longer be closed.", dispute["status"])
+	}
+	dispute["status"] = "lost"
+	s.emit("charge.dispute.closed", dispute)
+	return dispute, nil
+}
+
+func (s *Server) listDisputes(args []string, form url.Values) (interface{}, error) {
+	filter := func(dispute object) bool {
+		if v := form.Get("charge"); v != "" && dispute["charge"] != v {
+			return false
+		}
+		if v := form.Get("status"); v != "" && dispute["status"] != v {
+			return false
+		}
+		return matchRange(form, "created", toInt64(dispute["created"]))
+	}
+	return s.list("disputes", s.all("disputes", filter), form), nil
+}
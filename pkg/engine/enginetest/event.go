@@ -0,0 +1,82 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+	"strings"
+)
+
+func (s *Server) registerEvents() {
+	s.handle("GET", "events", s.listEvents)
+	s.handle("GET", "events/:", s.retrieveEvent)
+}
+
+func (s *Server) retrieveEvent(args []string, form url.Values) (interface{}, error) {
+	event := s.get("events", args[0])
+	if event == nil {
+		return nil, notFound("event", args[0])
+	}
+	return event, nil
+}
+
+func (s *Server) listEvents(args []string, form url.Values) (interface{}, error) {
+	filter := func(event object) bool {
+		if v := form.Get("type"); v != "" {
+			typ := event["type"].(string)
+			if strings.HasSuffix(v, "*") {
+				if !strings.HasPrefix(typ, strings.TrimSuffix(v, "*")) {
+					return false
+				}
+			} else if typ != v {
+				return false
+			}
+		}
+		return matchRange(form, "created", toInt64(event["created"]))
+	}
+	return s.list("events", s.all("events", filter), form), nil
+}
+
+// emit records an event of the given type, with a snapshot of the object.
+func (s *Server) emit(typ string, o object) {
+	s.put("events", object{
+		"id":               s.newID("evt"),
+		"object":           "event",
+		"type":             typ,
+		"created":          now(),
+		"data":             object{"object": copyObject(o)},
+		"pending_webhooks": 0,
+		"request":          nil,
+		"livemode":         false,
+	})
+}
+
+// Events returns the types of the events recorded by the Server, oldest
+// first.
+func (s *Server) Events() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var types []string
+	for _, id := range s.order["events"] {
+		types = append(types, s.objects["events"][id]["type"].(string))
+	}
+	return types
+}
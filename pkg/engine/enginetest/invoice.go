@@ -0,0 +1,611 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+func (s *Server) registerInvoices() {
+	s.handle("GET", "invoices/upcoming", s.retrieveUpcomingInvoice)
+	s.handle("GET", "invoices", s.listInvoices)
+	s.handle("POST", "invoices", s.createInvoice)
+	s.handle("GET", "invoices/:", s.retrieveInvoice)
+	s.handle("POST", "invoices/:", s.updateInvoice)
+	s.handle("GET", "invoices/:/lines", s.listInvoiceLines)
+	s.handle("POST", "invoices/:/finalize", s.invoiceAction(s.finalizeInvoice))
+	s.handle("POST", "invoices/:/pay", s.invoiceAction(s.payInvoice))
+	s.handle("POST", "invoices/:/void", s.invoiceAction(s.voidInvoice))
+	s.handle("POST", "invoices/:/mark_uncollectible", s.invoiceAction(s.markInvoiceUncollectible))
+}
+
+// createInvoice invoices the customer's pending invoice items as a draft.
+func (s *Server) createInvoice(args []string, form url.Values) (interface{}, error) {
+	id := form.Get("customer")
+	if id == "" {
+		return nil, invalidRequest("customer", "Missing required param: customer.")
+	}
+	customer := s.get("customers", id)
+	if customer == nil {
+		return nil, notFound("customer", id)
+	}
+	invoice := s.upcomingInvoice(customer, nil, nil)
+	if invoice == nil {
+		return nil, invalidRequest("customer", "Nothing to invoice for customer.")
+	}
+
+	date := now()
+	invoice["id"] = s.newID("in")
+	invoice["description"] = nullable(form.Get("description"))
+	invoice["date"], invoice["created"] = date, date
+	invoice["period_start"], invoice["period_end"] = date, date
+	invoice["next_payment_attempt"] = date + 60*60
+	metadataParam(form, invoice)
+	lines := invoice["lines"].(object)
+	lines["url"] = "/v1/invoices/" + invoice["id"].(string) + "/lines"
+	for _, item := range append(lines["invoiceitems"].([]object), lines["prorations"].([]object)...) {
+		item["invoice"] = invoice["id"]
+	}
+	s.put("invoices", invoice)
+	s.emit("invoice.created", invoice)
+	return invoice, nil
+}
+
+func (s *Server) retrieveInvoice(args []string, form url.Values) (interface{}, error) {
+	invoice := s.get("invoices", args[0])
+	if invoice == nil {
+		return nil, notFound("invoice", args[0])
+	}
+	return invoice, nil
+}
+
+func (s *Server) listInvoiceLines(args []string, form url.Values) (interface{}, error) {
+	invoice := s.get("invoices", args[0])
+	if invoice == nil {
+		return nil, notFound("invoice", args[0])
+	}
+	return s.list("invoices/"+args[0]+"/lines", invoiceLines(invoice["lines"].(object)), form), nil
+}
+
+func (s *Server) updateInvoice(args []string, form url.Values) (interface{}, error) {
+	invoice := s.get("invoices", args[0])
+	if invoice == nil {
+		return nil, notFound("invoice", args[0])
+	}
+	if v := form.Get("description"); v != "" {
+		invoice["description"] = v
+	}
+	metadataParam(form, invoice)
+
+	settled := invoice["status"] == "paid" || invoice["status"] == "void"
+	if v := form.Get("closed"); v != "" {
+		closed, err := boolParam(form, "closed", false)
+		if err != nil {
+			return nil, err
+		}
+		if !closed && settled {
+			return nil, invalidRequest("closed", "You cannot reopen a %s invoice.", invoice["status"])
+		}
+		invoice["closed"] = closed
+		invoice["next_payment_attempt"] = nil
+		if !closed {
+			invoice["next_payment_attempt"] = now()
+		}
+	}
+	if v := form.Get("forgiven"); v != "" {
+		forgiven, err := boolParam(form, "forgiven", false)
+		if err != nil {
+			return nil, err
+		}
+		if !forgiven && invoice["forgiven"] == true {
+			return nil, invalidRequest("forgiven", "You cannot unforgive an invoice.")
+		}
+		if forgiven && invoice["forgiven"] != true {
+			if invoice["status"] == "draft" {
+				s.finalizeInvoice(invoice)
+			}
+			if _, err := s.markInvoiceUncollectible(invoice); err != nil {
+				return nil, err
+			}
+		}
+	}
+	s.emit("invoice.updated", invoice)
+	return invoice, nil
+}
+
+// invoiceAction returns a handler that applies the action to the invoice in
+// the path.
+func (s *Server) invoiceAction(action func(invoice object) (object, error)) handler {
+	return func(args []string, form url.Values) (interface{}, error) {
+		invoice := s.get("invoices", args[0])
+		if invoice == nil {
+			return nil, notFound("invoice", args[0])
+		}
+		return action(invoice)
+	}
+}
+
+// finalizeInvoice opens a draft invoice for payment, applying the customer's
+// account balance to the amount due. An invoice with nothing due is paid
+// right away.
+func (s *Server) finalizeInvoice(invoice object) (object, error) {
+	if invoice["status"] != "draft" {
+		return nil, invalidRequest("invoice", "This invoice is already finalized.")
+	}
+	customer := s.get("customers", invoice["customer"].(string))
+	if customer == nil {
+		return nil, notFound("customer", invoice["customer"].(string))
+	}
+	balance := toInt64(customer["account_balance"])
+	due, ending := toInt64(invoice["total"])+balance, int64(0)
+	if due < 0 {
+		due, ending = 0, due
+	}
+	customer["account_balance"] = ending
+	invoice["starting_balance"] = balance
+	invoice["ending_balance"] = ending
+	invoice["amount_due"] = due
+	invoice["status"] = "open"
+	s.emit("invoice.finalized", invoice)
+
+	if due == 0 {
+		s.settleInvoice(invoice)
+	}
+	return invoice, nil
+}
+
+// payInvoice charges the amount due on the invoice to the customer's default
+// card, finalizing a draft invoice first.
+func (s *Server) payInvoice(invoice object) (object, error) {
+	switch invoice["status"] {
+	case "paid":
+		return nil, invalidRequest("invoice", "Invoice is already paid.")
+	case "void":
+		return nil, invalidRequest("invoice", "You cannot pay a void invoice.")
+	case "draft":
+		if _, err := s.finalizeInvoice(invoice); err != nil {
+			return nil, err
+		}
+		if invoice["status"] == "paid" {
+			return invoice, nil
+		}
+	}
+
+	customer := s.get("customers", invoice["customer"].(string))
+	if customer == nil {
+		return nil, notFound("customer", invoice["customer"].(string))
+	}
+	var card object
+	if id, _ := customer["default_card"].(string); id != "" {
+		card = s.get("cards", id)
+	}
+	if card == nil {
+		return nil, invalidRequest("card", "Cannot charge a customer that has no active card.")
+	}
+	invoice["attempted"] = true
+	invoice["attempt_count"] = toInt64(invoice["attempt_count"]) + 1
+	if err := s.chargeCard(card); err != nil {
+		s.emit("invoice.payment_failed", invoice)
+		return nil, err
+	}
+
+	charge := s.newCharge(toInt64(invoice["amount_due"]), invoice["currency"].(string), card, customer)
+	charge["invoice"] = invoice["id"]
+	s.put("charges", charge)
+	s.emit("charge.succeeded", charge)
+	s.chargeTransaction(charge)
+	invoice["charge"] = charge["id"]
+	s.settleInvoice(invoice)
+	return invoice, nil
+}
+
+// settleInvoice marks the invoice as paid.
+func (s *Server) settleInvoice(invoice object) {
+	invoice["status"] = "paid"
+	invoice["paid"] = true
+	invoice["closed"] = true
+	invoice["forgiven"] = false
+	invoice["next_payment_attempt"] = nil
+	s.emit("invoice.payment_succeeded", invoice)
+}
+
+func (s *Server) voidInvoice(invoice object) (object, error) {
+	if invoice["status"] != "open" && invoice["status"] != "uncollectible" {
+		return nil, invalidRequest("invoice", "You can only void an open or uncollectible invoice, but this invoice is %s.", invoice["status"])
+	}
+	invoice["status"] = "void"
+	invoice["closed"] = true
+	invoice["next_payment_attempt"] = nil
+	s.emit("invoice.voided", invoice)
+	return invoice, nil
+}
+
+func (s *Server) markInvoiceUncollectible(invoice object) (object, error) {
+	if invoice["status"] != "open" {
+		return nil, invalidRequest("invoice", "You can only mark an open invoice as uncollectible, but this invoice is %s.", invoice["status"])
+	}
+	invoice["status"] = "uncollectible"
+	invoice["forgiven"] = true
+	invoice["closed"] = true
+	invoice["next_payment_attempt"] = nil
+	s.emit("invoice.marked_uncollectible", invoice)
+	return invoice, nil
+}
+
+func (s *Server) retrieveUpcomingInvoice(args []string, form url.Values) (interface{}, error) {
+	id := form.Get("customer")
+	if id == "" {
+		return nil, invalidRequest("customer", "Missing required param: customer.")
+	}
+	customer := s.get("customers", id)
+	if customer == nil {
+		return nil, notFound("customer", id)
+	}
+
+	subs := s.customerSubscriptions(id)
+	var prorations []object
+	if v := form.Get("subscription"); v != "" {
+		sub := s.get("subscriptions", v)
+		if sub == nil || sub["customer"] != id {
+			return nil, invalidRequest("subscription", "No such subscription: %s", v)
+		}
+		preview, items, err := s.previewSubscription(customer, sub, form)
+		if err != nil {
+			return nil, err
+		}
+		subs, prorations = []object{preview}, items
+	} else if form.Get("subscription_plan") != "" {
+		preview, _, err := s.previewSubscription(customer, nil, form)
+		if err != nil {
+			return nil, err
+		}
+		subs = []object{preview}
+	}
+	coupon, err := s.couponParam(form)
+	if err != nil {
+		return nil, err
+	}
+	if coupon != nil {
+		customer = cloneObject(customer)
+		customer["discount"] = s.newDiscount(customer, coupon)
+	}
+
+	invoice := s.upcomingInvoice(customer, subs, prorations)
+	if invoice == nil {
+		return nil, &apiError{status: 404, typ: "invalid_request_error", message: "No upcoming invoices for customer: " + id}
+	}
+	return invoice, nil
+}
+
+func (s *Server) listInvoices(args []string, form url.Values) (interface{}, error) {
+	filter := func(invoice object) bool {
+		if v := form.Get("customer"); v != "" && invoice["customer"] != v {
+			return false
+		}
+		if v := form.Get("subscription"); v != "" && invoice["subscription"] != v {
+			return false
+		}
+		if v := form.Get("currency"); v != "" && invoice["currency"] != v {
+			return false
+		}
+		if v := form.Get("paid"); v != "" && strconv.FormatBool(invoice["paid"] == true) != v {
+			return false
+		}
+		if v := form.Get("plan"); v != "" && !invoiceHasPlan(invoice, v) {
+			return false
+		}
+		return matchRange(form, "created", toInt64(invoice["created"]))
+	}
+	return s.list("invoices", s.all("invoices", filter), form), nil
+}
+
+// previewSubscription returns a copy of the subscription with the changes
+// proposed by the subscription_* parameters of an upcoming invoice request,
+// and the proration invoice items for the changes. A nil subscription
+// previews a new subscription to subscription_plan.
+func (s *Server) previewSubscription(customer, sub object, form url.Values) (object, []object, error) {
+	date := now()
+	if sub == nil {
+		sub = object{
+			"id":                   nil,
+			"customer":             customer["id"],
+			"status":               "active",
+			"quantity":             int64(1),
+			"current_period_start": date,
+			"current_period_end":   date,
+		}
+	} else {
+		sub = cloneObject(sub)
+	}
+
+	plan, _ := sub["plan"].(object)
+	if id := form.Get("subscription_plan"); id != "" {
+		if plan = s.get("plans", id); plan == nil {
+			return nil, nil, invalidRequest("subscription_plan", "No such plan: %s", id)
+		}
+	}
+	quantity, err := intParam(form, "subscription_quantity", toInt64(sub["quantity"]))
+	if err != nil {
+		return nil, nil, err
+	}
+	if quantity < 1 {
+		return nil, nil, invalidRequest("subscription_quantity", "Invalid quantity: must be positive.")
+	}
+	start, end := toInt64(sub["current_period_start"]), toInt64(sub["current_period_end"])
+	date, err = intParam(form, "subscription_proration_date", date)
+	if err != nil {
+		return nil, nil, err
+	}
+	if date < start || date > end {
+		return nil, nil, invalidRequest("subscription_proration_date", "The proration date must be within the current period of the subscription.")
+	}
+	prorate, err := boolParam(form, "subscription_prorate", true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a trial postpones billing until it ends, without any prorations
+	if v := form.Get("subscription_trial_end"); v != "" {
+		trialEnd, err := intParam(form, "subscription_trial_end", 0)
+		if err != nil && v != "now" {
+			return nil, nil, err
+		}
+		if trialEnd > now() {
+			sub["status"] = "trialing"
+			sub["trial_end"] = trialEnd
+			sub["current_period_end"] = trialEnd
+			prorate = false
+		}
+	}
+
+	var prorations []object
+	previous, _ := sub["plan"].(object)
+	previousQuantity := toInt64(sub["quantity"])
+	changed := previous != nil && (previous["id"] != plan["id"] || previousQuantity != quantity)
+	if changed && prorate && sub["status"] != "trialing" && end > start {
+		prorate := func(plan object, quantity int64, sign int64, description string) {
+			amount := float64(priceFor(plan, quantity)) * float64(end-date) / float64(end-start)
+			prorations = append(prorations, object{
+				"id":           nil,
+				"object":       "invoiceitem",
+				"amount":       sign * int64(math.Round(amount)),
+				"currency":     plan["currency"],
+				"customer":     customer["id"],
+				"date":         date,
+				"description":  description,
+				"invoice":      nil,
+				"proration":    true,
+				"period":       object{"start": date, "end": end},
+				"plan":         plan,
+				"quantity":     quantity,
+				"subscription": sub["id"],
+				"livemode":     false,
+			})
+		}
+		prorate(previous, previousQuantity, -1, "Unused time on "+previous["name"].(string))
+
+		// a new interval restarts the billing period at the proration date,
+		// so the new plan is billed in full from then on
+		if previous["interval"] == plan["interval"] && previous["interval_count"] == plan["interval_count"] {
+			prorate(plan, quantity, 1, "Remaining time on "+plan["name"].(string))
+		} else {
+			sub["current_period_start"] = date
+			sub["current_period_end"] = date
+		}
+	}
+
+	sub["plan"] = plan
+	sub["quantity"] = quantity
+	return sub, prorations, nil
+}
+
+// upcomingInvoice returns the invoice the customer will be billed at the end
+// of the current billing period for the subscriptions, plus any prorations,
+// or nil if there is nothing to bill.
+func (s *Server) upcomingInvoice(customer object, subs []object, prorations []object) object {
+	id := customer["id"].(string)
+	var items []object
+	for _, item := range s.pendingInvoiceItems(id) {
+		if item["proration"] == true {
+			prorations = append(prorations, item)
+		} else {
+			items = append(items, item)
+		}
+	}
+
+	// the upcoming invoice bills the subscriptions that renew first
+	var subscriptions []object
+	var periodStart, periodEnd int64
+	var subscription interface{}
+	currency := customer["currency"]
+	for _, sub := range subs {
+		start := toInt64(sub["current_period_end"])
+		if sub["cancel_at_period_end"] == true || (periodStart != 0 && start > periodStart) {
+			continue
+		}
+		if start != periodStart {
+			subscriptions = nil
+		}
+		plan := sub["plan"].(object)
+		periodStart = start
+		periodEnd = addInterval(start, plan["interval"].(string), toInt64(plan["interval_count"]))
+		currency = plan["currency"]
+		subscription = sub["id"]
+
+		// licensed plans are billed for the next period, in advance, and
+		// metered plans for the usage of the current period, in arrears
+		line := object{
+			"id":           sub["id"],
+			"subscription": sub["id"],
+			"period":       object{"start": periodStart, "end": periodEnd},
+			"plan":         plan,
+			"quantity":     sub["quantity"],
+		}
+		if plan["usage_type"] == "metered" {
+			usageStart := toInt64(sub["current_period_start"])
+			line["period"] = object{"start": usageStart, "end": start}
+			line["quantity"] = s.usage(sub, usageStart, start)
+		}
+		line["amount"] = priceFor(plan, toInt64(line["quantity"]))
+		subscriptions = append(subscriptions, line)
+	}
+	if len(items) == 0 && len(prorations) == 0 && len(subscriptions) == 0 {
+		return nil
+	}
+	if periodStart == 0 {
+		periodStart, periodEnd = now(), now()
+	}
+	if currency == nil {
+		currency = append(items, prorations...)[0]["currency"]
+	}
+
+	// the discount only applies to the discountable items
+	var subtotal, discountable int64
+	for _, item := range append(items, prorations...) {
+		subtotal += toInt64(item["amount"])
+		if item["discountable"] != false {
+			discountable += toInt64(item["amount"])
+		}
+	}
+	for _, line := range subscriptions {
+		subtotal += toInt64(line["amount"])
+		discountable += toInt64(line["amount"])
+	}
+	total := subtotal - discountable + discounted(customer, discountable)
+	balance := toInt64(customer["account_balance"])
+	due := total + balance
+	if due < 0 {
+		due = 0
+	}
+
+	// the invoice embeds the first page of its lines
+	lines := object{
+		"invoiceitems":  items,
+		"prorations":    prorations,
+		"subscriptions": subscriptions,
+	}
+	for k, v := range s.list("invoices/upcoming/lines", invoiceLines(lines), url.Values{}) {
+		lines[k] = v
+	}
+
+	invoice := object{
+		"id":                   nil,
+		"object":               "invoice",
+		"status":               "draft",
+		"customer":             id,
+		"currency":             currency,
+		"lines":                lines,
+		"subtotal":             subtotal,
+		"total":                total,
+		"amount_due":           due,
+		"starting_balance":     balance,
+		"ending_balance":       nil,
+		"discount":             customer["discount"],
+		"date":                 periodStart,
+		"created":              periodStart,
+		"period_start":         periodStart,
+		"period_end":           periodEnd,
+		"next_payment_attempt": periodStart,
+		"attempt_count":        0,
+		"attempted":            false,
+		"closed":               false,
+		"forgiven":             false,
+		"paid":                 false,
+		"description":          nil,
+		"metadata":             map[string]string{},
+		"charge":               nil,
+		"subscription":         subscription,
+		"livemode":             false,
+	}
+	if len(subscriptions) > 1 {
+		invoice["subscription"] = nil
+	}
+	return invoice
+}
+
+// invoiceLines returns the lines of an invoice as a single list: the invoice
+// items, then the prorations and then the subscriptions.
+func invoiceLines(lines object) []object {
+	var data []object
+	for _, item := range append(lines["invoiceitems"].([]object), lines["prorations"].([]object)...) {
+		period, _ := item["period"].(object)
+		if period == nil {
+			period = object{"start": item["date"], "end": item["date"]}
+		}
+		quantity := toInt64(item["quantity"])
+		if quantity == 0 {
+			quantity = 1
+		}
+		data = append(data, object{
+			"id":           item["id"],
+			"object":       "line_item",
+			"type":         "invoiceitem",
+			"amount":       item["amount"],
+			"currency":     item["currency"],
+			"description":  item["description"],
+			"period":       period,
+			"proration":    item["proration"],
+			"quantity":     quantity,
+			"plan":         item["plan"],
+			"subscription": item["subscription"],
+			"invoice_item": item["id"],
+			"discountable": item["discountable"] != false,
+			"tax_amounts":  []object{},
+			"livemode":     false,
+		})
+	}
+	for _, line := range lines["subscriptions"].([]object) {
+		plan := line["plan"].(object)
+		data = append(data, object{
+			"id":           line["id"],
+			"object":       "line_item",
+			"type":         "subscription",
+			"amount":       line["amount"],
+			"currency":     plan["currency"],
+			"description":  fmt.Sprintf("%d × %s", toInt64(line["quantity"]), plan["name"]),
+			"period":       line["period"],
+			"proration":    false,
+			"quantity":     line["quantity"],
+			"plan":         plan,
+			"subscription": line["subscription"],
+			"invoice_item": nil,
+			"discountable": true,
+			"tax_amounts":  []object{},
+			"livemode":     false,
+		})
+	}
+	return data
+}
+
+// invoiceHasPlan reports whether the invoice has a line for the plan.
+func invoiceHasPlan(invoice object, plan string) bool {
+	lines, _ := invoice["lines"].(object)
+	subscriptions, _ := lines["subscriptions"].([]object)
+	for _, line := range subscriptions {
+		if p, _ := line["plan"].(object); p != nil && p["id"] == plan {
+			return true
+		}
+	}
+	return false
+}
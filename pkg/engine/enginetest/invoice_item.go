@@ -0,0 +1,196 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+	"strconv"
+)
+
+func (s *Server) registerInvoiceItems() {
+	s.handle("POST", "invoiceitems", s.createInvoiceItem)
+	s.handle("GET", "invoiceitems", s.listInvoiceItems)
+	s.handle("GET", "invoiceitems/:", s.retrieveInvoiceItem)
+	s.handle("POST", "invoiceitems/:", s.updateInvoiceItem)
+	s.handle("DELETE", "invoiceitems/:", s.deleteInvoiceItem)
+}
+
+func (s *Server) createInvoiceItem(args []string, form url.Values) (interface{}, error) {
+	id := form.Get("customer")
+	if id == "" {
+		return nil, invalidRequest("customer", "Missing required param: customer.")
+	}
+	if s.get("customers", id) == nil {
+		return nil, notFound("customer", id)
+	}
+	currency, err := currencyParam(form)
+	if err != nil {
+		return nil, err
+	}
+	var invoice interface{}
+	if v := form.Get("invoice"); v != "" {
+		if s.get("invoices", v) == nil {
+			return nil, notFound("invoice", v)
+		}
+		invoice = v
+	}
+	var subscription interface{}
+	if v := form.Get("subscription"); v != "" {
+		if sub := s.get("subscriptions", v); sub == nil || sub["customer"] != id {
+			return nil, invalidRequest("subscription", "No such subscription: %s", v)
+		}
+		subscription = v
+	}
+
+	date := now()
+	item := object{
+		"id":           s.newID("ii"),
+		"object":       "invoiceitem",
+		"currency":     currency,
+		"customer":     id,
+		"date":         date,
+		"description":  nullable(form.Get("description")),
+		"invoice":      invoice,
+		"quantity":     int64(1),
+		"period":       object{"start": date, "end": date},
+		"subscription": subscription,
+		"discountable": true,
+		"proration":    false,
+		"livemode":     false,
+	}
+	if err := applyInvoiceItemParams(item, form); err != nil {
+		return nil, err
+	}
+	if item["amount"] == nil {
+		return nil, invalidRequest("amount", "Missing required param: amount.")
+	}
+	s.put("invoiceitems", item)
+	return item, nil
+}
+
+// applyInvoiceItemParams sets the amount and the other optional parameters
+// shared by creating and updating an invoice item. The amount is either given
+// or calculated from the unit_amount and quantity.
+func applyInvoiceItemParams(item object, form url.Values) error {
+	amount, hasAmount, err := amountParam(form, "amount")
+	if err != nil {
+		return err
+	}
+	unitAmount, hasUnitAmount, err := amountParam(form, "unit_amount")
+	if err != nil {
+		return err
+	}
+	if hasAmount && hasUnitAmount {
+		return invalidRequest("unit_amount", "You may only specify one of these parameters: amount, unit_amount.")
+	}
+	quantity, err := intParam(form, "quantity", toInt64(item["quantity"]))
+	if err != nil {
+		return err
+	}
+	if quantity < 1 {
+		return invalidRequest("quantity", "Invalid quantity: must be positive.")
+	}
+	switch {
+	case hasAmount && form.Get("quantity") != "" && quantity != 1:
+		return invalidRequest("quantity", "You cannot specify a quantity with an amount. Use unit_amount instead.")
+	case hasAmount:
+		item["amount"], item["unit_amount"], item["quantity"] = amount, amount, int64(1)
+	case hasUnitAmount || item["unit_amount"] != nil:
+		if !hasUnitAmount {
+			unitAmount = toInt64(item["unit_amount"])
+		}
+		item["amount"], item["unit_amount"], item["quantity"] = unitAmount*quantity, unitAmount, quantity
+	}
+
+	if period := hashParam(form, "period"); period != nil {
+		start, err := strconv.ParseInt(period["start"], 10, 64)
+		if err != nil {
+			return invalidRequest("period[start]", "Invalid integer: %s", period["start"])
+		}
+		end, err := strconv.ParseInt(period["end"], 10, 64)
+		if err != nil || end < start {
+			return invalidRequest("period[end]", "The period must end after it starts.")
+		}
+		item["period"] = object{"start": start, "end": end}
+	}
+	discountable, err := boolParam(form, "discountable", item["discountable"] == true)
+	if err != nil {
+		return err
+	}
+	item["discountable"] = discountable
+	if v := form.Get("description"); v != "" {
+		item["description"] = v
+	}
+	metadataParam(form, item)
+	return nil
+}
+
+func (s *Server) retrieveInvoiceItem(args []string, form url.Values) (interface{}, error) {
+	item := s.get("invoiceitems", args[0])
+	if item == nil {
+		return nil, notFound("invoiceitem", args[0])
+	}
+	return item, nil
+}
+
+func (s *Server) updateInvoiceItem(args []string, form url.Values) (interface{}, error) {
+	item := s.get("invoiceitems", args[0])
+	if item == nil {
+		return nil, notFound("invoiceitem", args[0])
+	}
+	if item["invoice"] != nil {
+		return nil, invalidRequest("invoice", "Invoice item %s has already been invoiced, and can no longer be updated.", args[0])
+	}
+	if err := applyInvoiceItemParams(item, form); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *Server) deleteInvoiceItem(args []string, form url.Values) (interface{}, error) {
+	if s.get("invoiceitems", args[0]) == nil {
+		return nil, notFound("invoiceitem", args[0])
+	}
+	s.remove("invoiceitems", args[0])
+	return object{"id": args[0], "deleted": true}, nil
+}
+
+func (s *Server) listInvoiceItems(args []string, form url.Values) (interface{}, error) {
+	filter := func(item object) bool {
+		if v := form.Get("customer"); v != "" && item["customer"] != v {
+			return false
+		}
+		return matchRange(form, "created", toInt64(item["date"]))
+	}
+	return s.list("invoiceitems", s.all("invoiceitems", filter), form), nil
+}
+
+// pendingInvoiceItems returns the customer's invoice items that are not yet
+// part of an invoice, oldest first.
+func (s *Server) pendingInvoiceItems(customer string) []object {
+	items := s.all("invoiceitems", func(item object) bool {
+		return item["customer"] == customer && item["invoice"] == nil
+	})
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items
+}
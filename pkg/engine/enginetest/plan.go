@@ -0,0 +1,307 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+func (s *Server) registerPlans() {
+	s.handle("POST", "plans", s.createPlan)
+	s.handle("GET", "plans", s.listPlans)
+	s.handle("GET", "plans/:", s.retrievePlan)
+	s.handle("POST", "plans/:", s.updatePlan)
+	s.handle("DELETE", "plans/:", s.deletePlan)
+}
+
+func (s *Server) createPlan(args []string, form url.Values) (interface{}, error) {
+	id := form.Get("id")
+	if id == "" {
+		return nil, invalidRequest("id", "Missing required param: id.")
+	}
+	amount, ok, err := amountParam(form, "amount")
+	if err != nil {
+		return nil, err
+	}
+	scheme := form.Get("billing_scheme")
+	var tiersMode interface{}
+	var tiers []object
+	switch scheme {
+	case "", "per_unit":
+		scheme = "per_unit"
+		if !ok || amount < 0 {
+			return nil, invalidRequest("amount", "Missing required param: amount.")
+		}
+	case "tiered":
+		if ok {
+			return nil, invalidRequest("amount", "Amount cannot be set for tiered plans.")
+		}
+		mode := form.Get("tiers_mode")
+		if mode != "graduated" && mode != "volume" {
+			return nil, invalidRequest("tiers_mode", "Invalid tiers_mode: %s.", mode)
+		}
+		if tiers, err = tiersParam(form); err != nil {
+			return nil, err
+		}
+		tiersMode = mode
+	default:
+		return nil, invalidRequest("billing_scheme", "Invalid billing_scheme: %s.", scheme)
+	}
+	currency, err := currencyParam(form)
+	if err != nil {
+		return nil, err
+	}
+	interval := form.Get("interval")
+	if _, ok := intervals[interval]; !ok {
+		return nil, invalidRequest("interval", "Invalid interval: %s.", interval)
+	}
+	count, err := intParam(form, "interval_count", 1)
+	if err != nil {
+		return nil, err
+	}
+	if count < 1 {
+		return nil, invalidRequest("interval_count", "Invalid interval_count: must be positive.")
+	}
+	trialDays, err := intParam(form, "trial_period_days", 0)
+	if err != nil {
+		return nil, err
+	}
+	usageType := form.Get("usage_type")
+	var aggregateUsage interface{}
+	switch usageType {
+	case "", "licensed":
+		usageType = "licensed"
+		if form.Get("aggregate_usage") != "" {
+			return nil, invalidRequest("aggregate_usage", "Aggregate usage is only supported for metered plans.")
+		}
+	case "metered":
+		aggregateUsage = "sum"
+		if v := form.Get("aggregate_usage"); v != "" {
+			if !aggregateUsages[v] {
+				return nil, invalidRequest("aggregate_usage", "Invalid aggregate_usage: %s.", v)
+			}
+			aggregateUsage = v
+		}
+	default:
+		return nil, invalidRequest("usage_type", "Invalid usage_type: %s.", usageType)
+	}
+	if s.get("plans", id) != nil {
+		return nil, invalidRequest("id", "Plan already exists.")
+	}
+
+	plan := object{
+		"id":                id,
+		"object":            "plan",
+		"name":              form.Get("name"),
+		"amount":            amount,
+		"currency":          currency,
+		"interval":          interval,
+		"interval_count":    count,
+		"trial_period_days": nil,
+		"billing_scheme":    scheme,
+		"tiers_mode":        tiersMode,
+		"tiers":             tiers,
+		"nickname":          nil,
+		"product":           nil,
+		"active":            true,
+		"metadata":          map[string]string{},
+		"usage_type":        usageType,
+		"aggregate_usage":   aggregateUsage,
+		"livemode":          false,
+	}
+	if trialDays != 0 {
+		plan["trial_period_days"] = trialDays
+	}
+	if err := s.applyPlanParams(plan, form); err != nil {
+		return nil, err
+	}
+	s.put("plans", plan)
+	s.emit("plan.created", plan)
+	return plan, nil
+}
+
+func (s *Server) retrievePlan(args []string, form url.Values) (interface{}, error) {
+	plan := s.get("plans", args[0])
+	if plan == nil {
+		return nil, notFound("plan", args[0])
+	}
+	return plan, nil
+}
+
+func (s *Server) updatePlan(args []string, form url.Values) (interface{}, error) {
+	plan := s.get("plans", args[0])
+	if plan == nil {
+		return nil, notFound("plan", args[0])
+	}
+	if v := form.Get("name"); v != "" {
+		plan["name"] = v
+	}
+	if err := s.applyPlanParams(plan, form); err != nil {
+		return nil, err
+	}
+	s.emit("plan.updated", plan)
+	return plan, nil
+}
+
+func (s *Server) deletePlan(args []string, form url.Values) (interface{}, error) {
+	plan := s.get("plans", args[0])
+	if plan == nil {
+		return nil, notFound("plan", args[0])
+	}
+	s.remove("plans", args[0])
+	s.emit("plan.deleted", plan)
+	return object{"id": args[0], "deleted": true}, nil
+}
+
+func (s *Server) listPlans(args []string, form url.Values) (interface{}, error) {
+	return s.list("plans", s.all("plans", nil), form), nil
+}
+
+// applyPlanParams applies the parameters that can be sent both to create and
+// to update a plan.
+func (s *Server) applyPlanParams(plan object, form url.Values) error {
+	active, err := boolParam(form, "active", plan["active"] == true)
+	if err != nil {
+		return err
+	}
+	if id := form.Get("product"); id != "" {
+		if s.get("products", id) == nil {
+			return invalidRequest("product", "No such product: %s", id)
+		}
+		plan["product"] = id
+	}
+	if v := form.Get("nickname"); v != "" {
+		plan["nickname"] = v
+	}
+	plan["active"] = active
+	metadataParam(form, plan)
+	return nil
+}
+
+// tiersParam returns the tiers of a tiered plan, sent in the nested form
+// syntax, i.e. tiers[0][up_to]=10. The last tier must be up to "inf".
+func tiersParam(form url.Values) ([]object, error) {
+	var tiers []object
+	var below int64
+	for i := 0; ; i++ {
+		prefix := "tiers[" + strconv.Itoa(i) + "]"
+		upTo := form.Get(prefix + "[up_to]")
+		if upTo == "" {
+			break
+		}
+		if len(tiers) != 0 && tiers[len(tiers)-1]["up_to"] == nil {
+			return nil, invalidRequest("tiers", "Only the last tier can be up to inf.")
+		}
+		tier := object{"up_to": nil}
+		if upTo != "inf" {
+			n, err := strconv.ParseInt(upTo, 10, 64)
+			if err != nil || n <= below {
+				return nil, invalidRequest("tiers", "Invalid up_to for tier %d: tiers must be in increasing order.", i)
+			}
+			tier["up_to"], below = n, n
+		}
+		for _, key := range []string{"unit_amount", "flat_amount"} {
+			amount, _, err := amountParam(form, prefix+"["+key+"]")
+			if err != nil {
+				return nil, err
+			}
+			tier[key] = amount
+		}
+		tiers = append(tiers, tier)
+	}
+	if len(tiers) == 0 || tiers[len(tiers)-1]["up_to"] != nil {
+		return nil, invalidRequest("tiers", "The last tier must be up to inf.")
+	}
+	return tiers, nil
+}
+
+// priceFor returns the price of a quantity of a plan for one period.
+func priceFor(plan object, quantity int64) int64 {
+	if plan["billing_scheme"] != "tiered" {
+		return toInt64(plan["amount"]) * quantity
+	}
+	var price, below int64
+	for _, tier := range plan["tiers"].([]object) {
+		upTo := toInt64(tier["up_to"])
+		last := tier["up_to"] == nil || quantity <= upTo
+		if plan["tiers_mode"] == "volume" {
+			if last {
+				return toInt64(tier["unit_amount"])*quantity + toInt64(tier["flat_amount"])
+			}
+			continue
+		}
+		if quantity > below {
+			units := quantity - below
+			if !last {
+				units = upTo - below
+			}
+			price += toInt64(tier["unit_amount"])*units + toInt64(tier["flat_amount"])
+		}
+		if last {
+			break
+		}
+		below = upTo
+	}
+	return price
+}
+
+// aggregateUsages are the ways the usage records of a metered plan can be
+// combined for a period.
+var aggregateUsages = map[string]bool{"sum": true, "last_during_period": true, "last_ever": true, "max": true}
+
+// intervals maps each plan interval to its length, in either months or
+// seconds.
+var intervals = map[string]struct {
+	months  int
+	seconds time.Duration
+}{
+	"second":  {0, time.Second},
+	"minute":  {0, time.Minute},
+	"hour":    {0, time.Hour},
+	"day":     {0, 24 * time.Hour},
+	"week":    {0, 7 * 24 * time.Hour},
+	"month":   {1, 0},
+	"quarter": {3, 0},
+	"year":    {12, 0},
+	"decade":  {120, 0},
+	"century": {1200, 0},
+}
+
+// addInterval returns the UTC timestamp count intervals after start. Adding
+// months clamps to the end of shorter months, so 31 January plus one month
+// is 28 (or 29) February.
+func addInterval(start int64, interval string, count int64) int64 {
+	t := time.Unix(start, 0).UTC()
+	length := intervals[interval]
+	if length.months == 0 {
+		return t.Add(length.seconds * time.Duration(count)).Unix()
+	}
+
+	months := length.months * int(count)
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1).Unix()
+}
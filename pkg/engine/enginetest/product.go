@@ -0,0 +1,133 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+	"strconv"
+)
+
+func (s *Server) registerProducts() {
+	s.handle("POST", "products", s.createProduct)
+	s.handle("GET", "products", s.listProducts)
+	s.handle("GET", "products/:", s.retrieveProduct)
+	s.handle("POST", "products/:", s.updateProduct)
+	s.handle("DELETE", "products/:", s.deleteProduct)
+}
+
+func (s *Server) createProduct(args []string, form url.Values) (interface{}, error) {
+	id := form.Get("id")
+	if id == "" {
+		id = s.newID("prod")
+	} else if s.get("products", id) != nil {
+		return nil, invalidRequest("id", "Product already exists.")
+	}
+	if form.Get("name") == "" {
+		return nil, invalidRequest("name", "Missing required param: name.")
+	}
+
+	product := object{
+		"id":          id,
+		"object":      "product",
+		"name":        nil,
+		"description": nil,
+		"active":      true,
+		"images":      []string{},
+		"unit_label":  nil,
+		"metadata":    map[string]string{},
+		"created":     now(),
+		"updated":     now(),
+		"livemode":    false,
+	}
+	if err := applyProductParams(product, form); err != nil {
+		return nil, err
+	}
+	s.put("products", product)
+	s.emit("product.created", product)
+	return product, nil
+}
+
+func (s *Server) retrieveProduct(args []string, form url.Values) (interface{}, error) {
+	product := s.get("products", args[0])
+	if product == nil {
+		return nil, notFound("product", args[0])
+	}
+	return product, nil
+}
+
+func (s *Server) updateProduct(args []string, form url.Values) (interface{}, error) {
+	product := s.get("products", args[0])
+	if product == nil {
+		return nil, notFound("product", args[0])
+	}
+	if err := applyProductParams(product, form); err != nil {
+		return nil, err
+	}
+	product["updated"] = now()
+	s.emit("product.updated", product)
+	return product, nil
+}
+
+func (s *Server) deleteProduct(args []string, form url.Values) (interface{}, error) {
+	product := s.get("products", args[0])
+	if product == nil {
+		return nil, notFound("product", args[0])
+	}
+	plans := s.all("plans", func(plan object) bool { return plan["product"] == args[0] })
+	if len(plans) != 0 {
+		return nil, invalidRequest("", "Product %s cannot be deleted, because it has plans.", args[0])
+	}
+	s.remove("products", args[0])
+	s.emit("product.deleted", product)
+	return object{"id": args[0], "deleted": true}, nil
+}
+
+func (s *Server) listProducts(args []string, form url.Values) (interface{}, error) {
+	return s.list("products", s.all("products", nil), form), nil
+}
+
+// applyProductParams applies the parameters that can be sent both to create
+// and to update a product.
+func applyProductParams(product object, form url.Values) error {
+	active, err := boolParam(form, "active", product["active"] == true)
+	if err != nil {
+		return err
+	}
+	if v := form.Get("name"); v != "" {
+		product["name"] = v
+	}
+	if v := form.Get("description"); v != "" {
+		product["description"] = v
+	}
+	if v := form.Get("unit_label"); v != "" {
+		product["unit_label"] = v
+	}
+	if form.Get("images[0]") != "" {
+		var images []string
+		for i := 0; form.Get("images["+strconv.Itoa(i)+"]") != ""; i++ {
+			images = append(images, form.Get("images["+strconv.Itoa(i)+"]"))
+		}
+		product["images"] = images
+	}
+	product["active"] = active
+	metadataParam(form, product)
+	return nil
+}
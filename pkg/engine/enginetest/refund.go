@@ -0,0 +1,102 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+)
+
+// refundReasons are the valid reasons for a refund.
+var refundReasons = map[string]bool{
+	"duplicate":             true,
+	"fraudulent":            true,
+	"requested_by_customer": true,
+}
+
+func (s *Server) registerRefunds() {
+	s.handle("POST", "refunds", s.createRefund)
+	s.handle("GET", "refunds", s.listRefunds)
+	s.handle("GET", "refunds/:", s.retrieveRefund)
+	s.handle("POST", "refunds/:", s.updateRefund)
+}
+
+func (s *Server) createRefund(args []string, form url.Values) (interface{}, error) {
+	id := form.Get("charge")
+	if id == "" {
+		return nil, invalidRequest("charge", "Missing required param: charge.")
+	}
+	charge := s.get("charges", id)
+	if charge == nil {
+		return nil, notFound("charge", id)
+	}
+	amount, ok, err := amountParam(form, "amount")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		amount = toInt64(charge["amount"]) - toInt64(charge["amount_refunded"])
+	}
+	reason := form.Get("reason")
+	if reason != "" && !refundReasons[reason] {
+		return nil, invalidRequest("reason", "Invalid reason: %s", reason)
+	}
+
+	// the server charges no application fees, so there is none to refund
+	if _, err := boolParam(form, "refund_application_fee", false); err != nil {
+		return nil, err
+	}
+
+	refund, err := s.refund(charge, amount)
+	if err != nil {
+		return nil, err
+	}
+	refund["reason"] = nullable(reason)
+	metadataParam(form, refund)
+	return refund, nil
+}
+
+func (s *Server) retrieveRefund(args []string, form url.Values) (interface{}, error) {
+	refund := s.get("refunds", args[0])
+	if refund == nil {
+		return nil, notFound("refund", args[0])
+	}
+	return refund, nil
+}
+
+func (s *Server) updateRefund(args []string, form url.Values) (interface{}, error) {
+	refund := s.get("refunds", args[0])
+	if refund == nil {
+		return nil, notFound("refund", args[0])
+	}
+	metadataParam(form, refund)
+	s.emit("charge.refund.updated", refund)
+	return refund, nil
+}
+
+func (s *Server) listRefunds(args []string, form url.Values) (interface{}, error) {
+	filter := func(refund object) bool {
+		if v := form.Get("charge"); v != "" && refund["charge"] != v {
+			return false
+		}
+		return matchRange(form, "created", toInt64(refund["created"]))
+	}
+	return s.list("refunds", s.all("refunds", filter), form), nil
+}
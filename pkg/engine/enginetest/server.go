@@ -0,0 +1,524 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey is the secret API key accepted by every Server.
+const APIKey = "sk_test_enginetest"
+
+// object is the JSON representation of an API object.
+type object map[string]interface{}
+
+// apiError is an error response of the API.
+type apiError struct {
+	status  int
+	typ     string
+	message string
+	code    string
+	param   string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// invalidRequest returns a 400 invalid_request_error for the given param.
+func invalidRequest(param, format string, args ...interface{}) *apiError {
+	return &apiError{status: http.StatusBadRequest, typ: "invalid_request_error", message: fmt.Sprintf(format, args...), param: param}
+}
+
+// notFound returns a 404 invalid_request_error for a missing object.
+func notFound(kind, id string) *apiError {
+	return &apiError{status: http.StatusNotFound, typ: "invalid_request_error", message: fmt.Sprintf("No such %s: %s", kind, id), param: "id"}
+}
+
+// cardError returns a 402 card_error with the given code.
+func cardError(code, message string) *apiError {
+	return &apiError{status: http.StatusPaymentRequired, typ: "card_error", message: message, code: code, param: "card"}
+}
+
+// handler serves a single route. args holds the path parameters of the route
+// in order, and form the request parameters.
+type handler func(args []string, form url.Values) (interface{}, error)
+
+type route struct {
+	method  string
+	pattern []string
+	handler handler
+}
+
+// Server is a fake Bhojpur Subscription API backed by in-memory state.
+type Server struct {
+	*httptest.Server
+
+	// APIKey is the API key the Server accepts.
+	APIKey string
+
+	mu      sync.Mutex
+	routes  []route
+	seq     map[string]int
+	objects map[string]map[string]object
+	order   map[string][]string
+	numbers map[string]string
+}
+
+// NewServer starts and returns a new Server. The caller should call Close
+// when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		APIKey:  APIKey,
+		seq:     make(map[string]int),
+		objects: make(map[string]map[string]object),
+		order:   make(map[string][]string),
+		numbers: make(map[string]string),
+	}
+	s.registerCustomers()
+	s.registerCards()
+	s.registerTokens()
+	s.registerCharges()
+	s.registerRefunds()
+	s.registerDisputes()
+	s.registerBalance()
+	s.registerCoupons()
+	s.registerPlans()
+	s.registerProducts()
+	s.registerSubscriptions()
+	s.registerUsageRecords()
+	s.registerInvoices()
+	s.registerInvoiceItems()
+	s.registerCreditNotes()
+	s.registerEvents()
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Configure points a client at the Server, using setter functions such as
+// engine.SetUrl and engine.SetKey.
+func (s *Server) Configure(setURL, setKey func(string)) {
+	setURL(s.URL)
+	setKey(s.APIKey)
+}
+
+// Reset discards all of the objects stored by the Server.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq = make(map[string]int)
+	s.objects = make(map[string]map[string]object)
+	s.order = make(map[string][]string)
+	s.numbers = make(map[string]string)
+}
+
+// handle registers the handler for the method and path pattern, where a path
+// segment of ":" matches any value, i.e. "customers/:/cards".
+func (s *Server) handle(method, pattern string, h handler) {
+	s.routes = append(s.routes, route{method, strings.Split(pattern, "/"), h})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if key, _, _ := r.BasicAuth(); key != s.APIKey {
+		writeError(w, &apiError{status: http.StatusUnauthorized, typ: "invalid_request_error", message: "Invalid API Key provided: " + key})
+		return
+	}
+
+	form, err := parseForm(r)
+	if err != nil {
+		writeError(w, invalidRequest("", "Invalid request body: %s", err))
+		return
+	}
+
+	// the engine package escapes path parameters with url.QueryEscape
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	for i, segment := range path {
+		if unescaped, err := url.QueryUnescape(segment); err == nil {
+			path[i] = unescaped
+		}
+	}
+
+	for _, route := range s.routes {
+		args, ok := route.match(r.Method, path)
+		if !ok {
+			continue
+		}
+
+		body, err := s.serve(route.handler, args, form)
+		if err != nil {
+			if e, ok := err.(*apiError); ok {
+				writeError(w, e)
+			} else {
+				writeError(w, &apiError{status: http.StatusInternalServerError, typ: "api_error", message: err.Error()})
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+		return
+	}
+
+	writeError(w, &apiError{status: http.StatusNotFound, typ: "invalid_request_error", message: fmt.Sprintf("Unrecognized request URL (%s: %s).", r.Method, r.URL.Path)})
+}
+
+// serve calls the handler, and encodes its response, while holding the lock
+// on the Server's state, since handlers return the stored objects themselves.
+// A panicking handler is reported as an error, so that the lock is released.
+func (s *Server) serve(h handler, args []string, form url.Values) (body []byte, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("enginetest: handler panic: %v", r)
+		}
+	}()
+	v, err := h(args, form)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func (r route) match(method string, path []string) ([]string, bool) {
+	if r.method != method || len(r.pattern) != len(path) {
+		return nil, false
+	}
+	var args []string
+	for i, segment := range r.pattern {
+		switch {
+		case segment == ":":
+			args = append(args, path[i])
+		case segment != path[i]:
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+func writeError(w http.ResponseWriter, e *apiError) {
+	detail := object{"type": e.typ, "message": e.message}
+	if e.code != "" {
+		detail["code"] = e.code
+	}
+	if e.param != "" {
+		detail["param"] = e.param
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(object{"error": detail})
+}
+
+// parseForm returns the query string parameters merged with the form encoded
+// body. Unlike http.Request.ParseForm, the body of a DELETE is parsed too.
+func parseForm(r *http.Request) (url.Values, error) {
+	form := r.URL.Query()
+	if r.Method == "GET" {
+		return form, nil
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range values {
+		form[k] = append(form[k], v...)
+	}
+	return form, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Storage
+
+// newID returns a new, unique ID with the given prefix, i.e. "cus_1".
+func (s *Server) newID(prefix string) string {
+	s.seq[prefix]++
+	return prefix + "_" + strconv.Itoa(s.seq[prefix])
+}
+
+// put stores an object in the collection, keeping the order in which the
+// objects were first stored.
+func (s *Server) put(collection string, o object) {
+	id := o["id"].(string)
+	if s.objects[collection] == nil {
+		s.objects[collection] = make(map[string]object)
+	}
+	if _, ok := s.objects[collection][id]; !ok {
+		s.order[collection] = append(s.order[collection], id)
+	}
+	s.objects[collection][id] = o
+}
+
+// get returns the object with the given ID, or nil.
+func (s *Server) get(collection, id string) object {
+	return s.objects[collection][id]
+}
+
+// remove deletes the object with the given ID from the collection.
+func (s *Server) remove(collection, id string) {
+	delete(s.objects[collection], id)
+	ids := s.order[collection]
+	for i := range ids {
+		if ids[i] == id {
+			s.order[collection] = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+}
+
+// all returns the objects of a collection matching the filter, most recently
+// created first.
+func (s *Server) all(collection string, filter func(object) bool) []object {
+	ids := s.order[collection]
+	var objects []object
+	for i := len(ids) - 1; i >= 0; i-- {
+		o := s.objects[collection][ids[i]]
+		if filter == nil || filter(o) {
+			objects = append(objects, o)
+		}
+	}
+	return objects
+}
+
+// list returns a page of objects, using either the count and offset or the
+// limit, starting_after and ending_before parameters.
+func (s *Server) list(path string, objects []object, form url.Values) object {
+	index := func(id string) int {
+		for i, o := range objects {
+			if o["id"] == id {
+				return i
+			}
+		}
+		return -1
+	}
+
+	limit := 10
+	if n, err := strconv.Atoi(form.Get("limit")); err == nil && n > 0 {
+		limit = n
+	} else if n, err := strconv.Atoi(form.Get("count")); err == nil && n > 0 {
+		limit = n
+	}
+
+	lo, hi, more := 0, len(objects), false
+	if before := form.Get("ending_before"); before != "" {
+		if hi = index(before); hi < 0 {
+			hi = 0
+		}
+		if more = hi > limit; more {
+			lo = hi - limit
+		}
+	} else {
+		if after := form.Get("starting_after"); after != "" {
+			lo = index(after) + 1
+		} else if n, err := strconv.Atoi(form.Get("offset")); err == nil && n > 0 {
+			lo = n
+		}
+		if lo > hi {
+			lo = hi
+		}
+		if more = hi-lo > limit; more {
+			hi = lo + limit
+		}
+	}
+
+	data := make([]object, hi-lo)
+	copy(data, objects[lo:hi])
+	return object{
+		"object":      "list",
+		"url":         "/v1/" + path,
+		"has_more":    more,
+		"total_count": len(objects),
+		"data":        data,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Request Parameters
+
+// now returns the current UTC timestamp.
+func now() int64 {
+	return time.Now().Unix()
+}
+
+// amountParam parses an amount in the smallest unit of its currency, which
+// must be an integer.
+func amountParam(form url.Values, key string) (int64, bool, error) {
+	v := form.Get(key)
+	if v == "" {
+		return 0, false, nil
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, false, invalidRequest(key, "Invalid integer: %s", v)
+	}
+	return i, true, nil
+}
+
+// intParam parses an integer parameter, returning def if it is missing.
+func intParam(form url.Values, key string, def int64) (int64, error) {
+	v := form.Get(key)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, invalidRequest(key, "Invalid integer: %s", v)
+	}
+	return i, nil
+}
+
+// boolParam parses a boolean parameter, returning def if it is missing.
+func boolParam(form url.Values, key string, def bool) (bool, error) {
+	v := form.Get(key)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, invalidRequest(key, "Invalid boolean: %s", v)
+	}
+	return b, nil
+}
+
+// hashParam returns the values of a parameter sent in the nested form syntax,
+// i.e. metadata[order]=1234, keyed by the name in brackets.
+func hashParam(form url.Values, key string) map[string]string {
+	var hash map[string]string
+	prefix := key + "["
+	for k, v := range form {
+		if strings.HasPrefix(k, prefix) && strings.HasSuffix(k, "]") {
+			if hash == nil {
+				hash = make(map[string]string)
+			}
+			hash[k[len(prefix):len(k)-1]] = v[0]
+		}
+	}
+	return hash
+}
+
+// metadataParam merges the metadata parameters into the metadata of an
+// object. An empty value removes the key.
+func metadataParam(form url.Values, o object) {
+	metadata, _ := o["metadata"].(map[string]string)
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	for k, v := range hashParam(form, "metadata") {
+		if v == "" {
+			delete(metadata, k)
+		} else {
+			metadata[k] = v
+		}
+	}
+	o["metadata"] = metadata
+}
+
+// matchRange reports whether the value is within the range sent in the nested
+// form syntax, i.e. created[gte]=1514764800.
+func matchRange(form url.Values, key string, value int64) bool {
+	for op, v := range hashParam(form, key) {
+		bound, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch op {
+		case "gt":
+			if value <= bound {
+				return false
+			}
+		case "gte":
+			if value < bound {
+				return false
+			}
+		case "lt":
+			if value >= bound {
+				return false
+			}
+		case "lte":
+			if value > bound {
+				return false
+			}
+		}
+	}
+	if v := form.Get(key); v != "" {
+		if exact, err := strconv.ParseInt(v, 10, 64); err == nil && value != exact {
+			return false
+		}
+	}
+	return true
+}
+
+// toInt64 converts a number stored in an object to an int64.
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+// copyObject returns a deep copy of an object, as it would be encoded.
+func copyObject(o object) object {
+	data, _ := json.Marshal(o)
+	c := object{}
+	json.Unmarshal(data, &c)
+	return c
+}
+
+// cloneObject returns a shallow copy of an object.
+func cloneObject(o object) object {
+	c := make(object, len(o))
+	for k, v := range o {
+		c[k] = v
+	}
+	return c
+}
+
+// currencies supported by the Server
+var currencies = []string{"aud", "cad", "cny", "eur", "gbp", "hkd", "inr", "jpy", "usd"}
+
+// currencyParam validates a required currency parameter.
+func currencyParam(form url.Values) (string, error) {
+	currency := strings.ToLower(form.Get("currency"))
+	if currency == "" {
+		return "", invalidRequest("currency", "Missing required param: currency.")
+	}
+	if i := sort.SearchStrings(currencies, currency); i == len(currencies) || currencies[i] != currency {
+		return "", invalidRequest("currency", "Invalid currency: %s. Bhojpur Subscription currently supports these currencies: %s", currency, strings.Join(currencies, ", "))
+	}
+	return currency, nil
+}
@@ -0,0 +1,194 @@
+package enginetest_test
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bhojpur/subscription/pkg/engine"
+	"github.com/bhojpur/subscription/pkg/engine/enginetest"
+)
+
+// TestServerAuth will test that the Server rejects requests that do not use
+// its API key.
+func TestServerAuth(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+
+	client := engine.New("sk_test_wrong", engine.WithURL(server.URL), engine.WithMaxRetries(0))
+	_, err := client.Customers.List()
+	if err == nil {
+		t.Fatal("Expected non-null Error when using the wrong API key.")
+	}
+	if e, ok := err.(*engine.Error); !ok || e.Code != 401 {
+		t.Errorf("Expected 401 Error, got %v", err)
+	}
+}
+
+// TestServerState will test that the Server keeps objects between requests,
+// records events for them, and forgets everything on Reset.
+func TestServerState(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	client := engine.New(server.APIKey, engine.WithURL(server.URL))
+
+	customer, err := client.Customers.Create(&engine.CustomerParams{Email: "test@example.com"})
+	if err != nil {
+		t.Fatalf("Expected Customer, got Error %s", err.Error())
+	}
+	if _, err := client.Customers.Retrieve(customer.ID); err != nil {
+		t.Errorf("Expected Customer %s, got Error %s", customer.ID, err.Error())
+	}
+	if want := []string{engine.EventCustomerCreated}; !reflect.DeepEqual(server.Events(), want) {
+		t.Errorf("Expected Events %v, got %v", want, server.Events())
+	}
+
+	server.Reset()
+	if _, err := client.Customers.Retrieve(customer.ID); err == nil {
+		t.Errorf("Expected non-null Error when retrieving Customer %s after Reset", customer.ID)
+	}
+	if len(server.Events()) != 0 {
+		t.Errorf("Expected no Events after Reset, got %v", server.Events())
+	}
+}
+
+// TestServerUpcomingInvoice will test that the upcoming invoice includes the
+// customer's pending invoice items.
+func TestServerUpcomingInvoice(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	client := engine.New(server.APIKey, engine.WithURL(server.URL))
+
+	customer, _ := client.Customers.Create(&engine.CustomerParams{})
+	if _, err := client.Invoices.RetrieveCustomer(customer.ID); err == nil {
+		t.Error("Expected non-null Error when there is nothing to invoice.")
+	}
+
+	client.InvoiceItems.Create(&engine.InvoiceItemParams{Customer: customer.ID, Amount: engine.Money{Amount: 1000, Currency: engine.USD}})
+	client.InvoiceItems.Create(&engine.InvoiceItemParams{Customer: customer.ID, Amount: engine.Money{Amount: 250, Currency: engine.USD}})
+	invoice, err := client.Invoices.RetrieveCustomer(customer.ID)
+	if err != nil {
+		t.Fatalf("Expected upcoming Invoice, got Error %s", err.Error())
+	}
+	if invoice.Total.Amount != 1250 {
+		t.Errorf("Expected Invoice Total %v, got %v", 1250, invoice.Total.Amount)
+	}
+	if len(invoice.Lines.InvoiceItems) != 2 {
+		t.Errorf("Expected %d Invoice Items, got %d", 2, len(invoice.Lines.InvoiceItems))
+	}
+}
+
+// TestServerDeletedCustomer will test that the Server reports an error, and
+// keeps serving, when an invoice refers to a customer that was deleted.
+func TestServerDeletedCustomer(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	client := engine.New(server.APIKey, engine.WithURL(server.URL))
+
+	customer, _ := client.Customers.Create(&engine.CustomerParams{})
+	client.InvoiceItems.Create(&engine.InvoiceItemParams{Customer: customer.ID, Amount: engine.Money{Amount: 1000, Currency: engine.USD}})
+	invoice, err := client.Invoices.Create(customer.ID, nil)
+	if err != nil {
+		t.Fatalf("Expected Invoice, got Error %s", err.Error())
+	}
+	client.Customers.Delete(customer.ID)
+
+	if _, err := client.Invoices.Finalize(invoice.ID); err == nil {
+		t.Error("Expected non-null Error when finalizing the Invoice of a deleted Customer.")
+	}
+	if _, err := client.Invoices.Pay(invoice.ID); err == nil {
+		t.Error("Expected non-null Error when paying the Invoice of a deleted Customer.")
+	}
+	if _, err := client.Invoices.Retrieve(invoice.ID); err != nil {
+		t.Errorf("Expected Invoice, got Error %s", err.Error())
+	}
+}
+
+// TestServerAmounts will test that the Server only accepts amounts given as
+// integers in the smallest unit of the currency.
+func TestServerAmounts(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+
+	tests := []struct {
+		amount string
+		status int
+	}{
+		{"200", http.StatusOK},
+		{"2E+02", http.StatusBadRequest},
+		{"200.0", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		form := url.Values{"amount": {test.amount}, "currency": {engine.USD}, "card[number]": {"4242424242424242"}, "card[exp_month]": {"1"}, "card[exp_year]": {"2099"}}
+		req, _ := http.NewRequest("POST", server.URL+"/v1/charges", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(server.APIKey, "")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected response, got Error %s", err.Error())
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("Expected status %d for amount %s, got %d", test.status, test.amount, resp.StatusCode)
+		}
+	}
+}
+
+// TestServerConcurrent will test that objects can be updated and retrieved
+// concurrently, which the race detector checks.
+func TestServerConcurrent(t *testing.T) {
+	server := enginetest.NewServer()
+	defer server.Close()
+	client := engine.New(server.APIKey, engine.WithURL(server.URL))
+
+	charge, err := client.Charges.Create(&engine.ChargeParams{
+		Amount: engine.Money{Amount: 1000, Currency: engine.USD},
+		Card:   &engine.CardParams{Number: "4242424242424242", ExpMonth: 1, ExpYear: 2099},
+	})
+	if err != nil {
+		t.Fatalf("Expected Charge, got Error %s", err.Error())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			params := engine.ChargeParams{Metadata: map[string]string{"attempt" + strconv.Itoa(i): "1"}}
+			if _, err := client.Charges.Update(charge.ID, &params); err != nil {
+				t.Errorf("Expected Charge update, got Error %s", err.Error())
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Charges.Retrieve(charge.ID); err != nil {
+				t.Errorf("Expected Charge, got Error %s", err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,238 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+)
+
+func (s *Server) registerSubscriptions() {
+	s.handle("POST", "subscriptions", s.createSubscription)
+	s.handle("GET", "subscriptions", s.listSubscriptions)
+	s.handle("GET", "subscriptions/:", s.retrieveSubscription)
+	s.handle("POST", "subscriptions/:", s.updateSubscription)
+	s.handle("DELETE", "subscriptions/:", s.cancelSubscription)
+}
+
+func (s *Server) createSubscription(args []string, form url.Values) (interface{}, error) {
+	id := form.Get("customer")
+	if id == "" {
+		return nil, invalidRequest("customer", "Missing required param: customer.")
+	}
+	customer := s.get("customers", id)
+	if customer == nil {
+		return nil, notFound("customer", id)
+	}
+	plan := s.get("plans", form.Get("plan"))
+	if plan == nil {
+		return nil, invalidRequest("plan", "No such plan: %s", form.Get("plan"))
+	}
+	if plan["active"] != true {
+		return nil, invalidRequest("plan", "The plan %s is inactive, and cannot be subscribed to.", plan["id"])
+	}
+	if err := s.applySubscriptionParams(customer, form); err != nil {
+		return nil, err
+	}
+	return s.subscribe(customer, nil, plan, form)
+}
+
+func (s *Server) retrieveSubscription(args []string, form url.Values) (interface{}, error) {
+	sub := s.get("subscriptions", args[0])
+	if sub == nil {
+		return nil, notFound("subscription", args[0])
+	}
+	return sub, nil
+}
+
+func (s *Server) updateSubscription(args []string, form url.Values) (interface{}, error) {
+	sub := s.get("subscriptions", args[0])
+	if sub == nil {
+		return nil, notFound("subscription", args[0])
+	}
+	if sub["status"] == "canceled" {
+		return nil, invalidRequest("", "No such subscription: %s, as it has been canceled.", args[0])
+	}
+	plan := sub["plan"].(object)
+	if id := form.Get("plan"); id != "" {
+		if plan = s.get("plans", id); plan == nil {
+			return nil, invalidRequest("plan", "No such plan: %s", id)
+		}
+	}
+	customer := s.get("customers", sub["customer"].(string))
+	if err := s.applySubscriptionParams(customer, form); err != nil {
+		return nil, err
+	}
+	return s.subscribe(customer, sub, plan, form)
+}
+
+func (s *Server) cancelSubscription(args []string, form url.Values) (interface{}, error) {
+	sub := s.get("subscriptions", args[0])
+	if sub == nil {
+		return nil, notFound("subscription", args[0])
+	}
+	if sub["status"] == "canceled" {
+		return nil, invalidRequest("", "No such subscription: %s, as it has been canceled.", args[0])
+	}
+	atPeriodEnd, err := boolParam(form, "at_period_end", false)
+	if err != nil {
+		return nil, err
+	}
+	s.cancel(sub, atPeriodEnd)
+	return sub, nil
+}
+
+func (s *Server) listSubscriptions(args []string, form url.Values) (interface{}, error) {
+	status := form.Get("status")
+	filter := func(sub object) bool {
+		if v := form.Get("customer"); v != "" && sub["customer"] != v {
+			return false
+		}
+		if v := form.Get("plan"); v != "" && sub["plan"].(object)["id"] != v {
+			return false
+		}
+		switch status {
+		case "all":
+			return true
+		case "":
+			// canceled subscriptions are only listed when asked for
+			return sub["status"] != "canceled"
+		default:
+			return sub["status"] == status
+		}
+	}
+	return s.list("subscriptions", s.all("subscriptions", filter), form), nil
+}
+
+// applySubscriptionParams applies the coupon and card, if any, of a request
+// to create or update a subscription to the customer.
+func (s *Server) applySubscriptionParams(customer object, form url.Values) error {
+	coupon, err := s.couponParam(form)
+	if err != nil {
+		return err
+	}
+	card, err := s.cardParam(form)
+	if err != nil {
+		return err
+	}
+
+	if card != nil {
+		s.attachCard(customer, card)
+	}
+	if coupon != nil {
+		s.applyCoupon(customer, coupon)
+	}
+	return nil
+}
+
+// subscribe subscribes a customer to a plan, updating the subscription sub,
+// or creating a new subscription if sub is nil.
+func (s *Server) subscribe(customer, sub, plan object, form url.Values) (object, error) {
+	quantity, err := intParam(form, "quantity", 1)
+	if err != nil {
+		return nil, err
+	}
+	if sub != nil && form.Get("quantity") == "" {
+		quantity = toInt64(sub["quantity"])
+	}
+	if quantity < 1 {
+		return nil, invalidRequest("quantity", "Invalid quantity: must be positive.")
+	}
+	trialEnd, err := intParam(form, "trial_end", 0)
+	if err != nil && form.Get("trial_end") != "now" {
+		return nil, err
+	}
+
+	start := now()
+	event := "customer.subscription.updated"
+	if sub == nil {
+		event = "customer.subscription.created"
+		sub = object{
+			"id":                   s.newID("sub"),
+			"object":               "subscription",
+			"customer":             customer["id"],
+			"start":                start,
+			"ended_at":             nil,
+			"canceled_at":          nil,
+			"trial_start":          nil,
+			"trial_end":            nil,
+			"current_period_start": start,
+			"current_period_end":   nil,
+			"status":               "active",
+			"metadata":             map[string]string{},
+		}
+		// new subscriptions get the trial period of the plan by default
+		if trialEnd == 0 && form.Get("trial_end") != "now" {
+			if days := toInt64(plan["trial_period_days"]); days != 0 {
+				trialEnd = addInterval(start, "day", days)
+			}
+		}
+	}
+
+	// the billing period restarts when the plan interval changes
+	previous, _ := sub["plan"].(object)
+	if previous == nil || previous["interval"] != plan["interval"] || previous["interval_count"] != plan["interval_count"] {
+		sub["current_period_start"] = start
+		sub["current_period_end"] = addInterval(start, plan["interval"].(string), toInt64(plan["interval_count"]))
+	}
+
+	sub["plan"] = plan
+	sub["quantity"] = quantity
+	sub["cancel_at_period_end"] = false
+	if form.Get("trial_end") == "now" && sub["status"] == "trialing" {
+		sub["status"] = "active"
+		sub["trial_end"] = start
+		sub["current_period_start"] = start
+		sub["current_period_end"] = addInterval(start, plan["interval"].(string), toInt64(plan["interval_count"]))
+	}
+	if trialEnd > start {
+		sub["status"] = "trialing"
+		sub["trial_start"] = start
+		sub["trial_end"] = trialEnd
+		sub["current_period_start"] = start
+		sub["current_period_end"] = trialEnd
+	}
+	metadataParam(form, sub)
+	s.put("subscriptions", sub)
+	s.emit(event, sub)
+	return sub, nil
+}
+
+// cancel cancels a subscription, either immediately or at the end of the
+// current billing period.
+func (s *Server) cancel(sub object, atPeriodEnd bool) {
+	if atPeriodEnd {
+		sub["cancel_at_period_end"] = true
+		s.emit("customer.subscription.updated", sub)
+		return
+	}
+	sub["status"] = "canceled"
+	sub["canceled_at"] = now()
+	sub["ended_at"] = now()
+	s.emit("customer.subscription.deleted", sub)
+}
+
+// customerSubscriptions returns the customer's subscriptions that have not
+// been canceled, newest first.
+func (s *Server) customerSubscriptions(id string) []object {
+	return s.all("subscriptions", func(sub object) bool {
+		return sub["customer"] == id && sub["status"] != "canceled"
+	})
+}
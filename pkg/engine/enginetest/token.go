@@ -0,0 +1,71 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+)
+
+func (s *Server) registerTokens() {
+	s.handle("POST", "tokens", s.createToken)
+	s.handle("GET", "tokens/:", s.retrieveToken)
+}
+
+func (s *Server) createToken(args []string, form url.Values) (interface{}, error) {
+	card, err := s.newCard(form)
+	if err != nil {
+		return nil, err
+	}
+	token := object{
+		"id":       s.newID("tok"),
+		"object":   "token",
+		"amount":   0,
+		"currency": nil,
+		"created":  now(),
+		"used":     false,
+		"livemode": false,
+		"type":     "card",
+		"card":     card,
+	}
+	s.put("tokens", token)
+	return token, nil
+}
+
+func (s *Server) retrieveToken(args []string, form url.Values) (interface{}, error) {
+	token := s.get("tokens", args[0])
+	if token == nil {
+		return nil, notFound("token", args[0])
+	}
+	return token, nil
+}
+
+// useToken marks a token as used, returning its card.
+func (s *Server) useToken(id string) (object, error) {
+	token := s.get("tokens", id)
+	if token == nil {
+		return nil, notFound("token", id)
+	}
+	if token["used"] == true {
+		return nil, invalidRequest("card", "You cannot use a Bhojpur token more than once: %s.", id)
+	}
+	token["used"] = true
+	return token["card"].(object), nil
+}
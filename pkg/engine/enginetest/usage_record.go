@@ -0,0 +1,158 @@
+package enginetest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+func (s *Server) registerUsageRecords() {
+	s.handle("POST", "subscriptions/:/usage_records", s.createUsageRecord)
+	s.handle("GET", "subscriptions/:/usage_record_summaries", s.listUsageRecordSummaries)
+}
+
+func (s *Server) createUsageRecord(args []string, form url.Values) (interface{}, error) {
+	sub := s.get("subscriptions", args[0])
+	if sub == nil {
+		return nil, notFound("subscription", args[0])
+	}
+	if sub["plan"].(object)["usage_type"] != "metered" {
+		return nil, invalidRequest("", "Usage records can only be created for subscriptions to metered plans.")
+	}
+	if form.Get("quantity") == "" {
+		return nil, invalidRequest("quantity", "Missing required param: quantity.")
+	}
+	quantity, err := intParam(form, "quantity", 0)
+	if err != nil {
+		return nil, err
+	}
+	if quantity < 0 {
+		return nil, invalidRequest("quantity", "Invalid quantity: must not be negative.")
+	}
+	timestamp, err := intParam(form, "timestamp", now())
+	if err != nil {
+		return nil, err
+	}
+	action := form.Get("action")
+	if action == "" {
+		action = "increment"
+	}
+	if action != "increment" && action != "set" {
+		return nil, invalidRequest("action", "Invalid action: %s.", action)
+	}
+
+	// usage reported at the same timestamp updates the same record
+	for _, record := range s.usageRecords(args[0]) {
+		if toInt64(record["timestamp"]) == timestamp {
+			if action == "increment" {
+				quantity += toInt64(record["quantity"])
+			}
+			record["quantity"] = quantity
+			return record, nil
+		}
+	}
+
+	record := object{
+		"id":           s.newID("mbur"),
+		"object":       "usage_record",
+		"quantity":     quantity,
+		"subscription": args[0],
+		"timestamp":    timestamp,
+		"livemode":     false,
+	}
+	s.put("usage_records", record)
+	return record, nil
+}
+
+func (s *Server) listUsageRecordSummaries(args []string, form url.Values) (interface{}, error) {
+	sub := s.get("subscriptions", args[0])
+	if sub == nil {
+		return nil, notFound("subscription", args[0])
+	}
+
+	// one summary for each billing period, up to the current one
+	plan := sub["plan"].(object)
+	anchor := toInt64(sub["start"])
+	end := toInt64(sub["current_period_end"])
+	var summaries []object
+	for n := int64(0); ; n++ {
+		start := addInterval(anchor, plan["interval"].(string), n*toInt64(plan["interval_count"]))
+		if start >= end {
+			break
+		}
+		next := addInterval(anchor, plan["interval"].(string), (n+1)*toInt64(plan["interval_count"]))
+		if next > end {
+			next = end
+		}
+		summaries = append([]object{{
+			"id":           "sis_" + args[0] + "_" + strconv.FormatInt(n, 10),
+			"object":       "usage_record_summary",
+			"invoice":      nil,
+			"period":       object{"start": start, "end": next},
+			"subscription": args[0],
+			"total_usage":  s.usage(sub, start, next),
+			"livemode":     false,
+		}}, summaries...)
+	}
+	return s.list("subscriptions/"+args[0]+"/usage_record_summaries", summaries, form), nil
+}
+
+// usageRecords returns the usage records of the subscription, oldest first.
+func (s *Server) usageRecords(subscription string) []object {
+	records := s.all("usage_records", func(record object) bool {
+		return record["subscription"] == subscription
+	})
+	sort.SliceStable(records, func(i, j int) bool {
+		return toInt64(records[i]["timestamp"]) < toInt64(records[j]["timestamp"])
+	})
+	return records
+}
+
+// usage returns the usage of a subscription to a metered plan within the
+// period [start, end), combined using the plan's aggregate_usage.
+func (s *Server) usage(sub object, start, end int64) int64 {
+	var total int64
+	for _, record := range s.usageRecords(sub["id"].(string)) {
+		timestamp, quantity := toInt64(record["timestamp"]), toInt64(record["quantity"])
+		if timestamp >= end {
+			break
+		}
+		switch sub["plan"].(object)["aggregate_usage"] {
+		case "last_ever":
+			total = quantity
+		case "last_during_period":
+			if timestamp >= start {
+				total = quantity
+			}
+		case "max":
+			if timestamp >= start && quantity > total {
+				total = quantity
+			}
+		default:
+			if timestamp >= start {
+				total += quantity
+			}
+		}
+	}
+	return total
+}
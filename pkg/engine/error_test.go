@@ -25,14 +25,6 @@ import (
 	"time"
 )
 
-func init() {
-	// In order to execute Unit Test, you must set your Bhojpur Subscription API Key
-	// as environment variable, BHOJPUR_API_KEY=xxxx
-	if err := SetKeyEnv(); err != nil {
-		panic(err)
-	}
-}
-
 var (
 	// These cards will be successfully charged.
 	goodCards = []string{
@@ -64,9 +56,8 @@ var (
 	}
 	// Charge with only the required fields
 	charge = ChargeParams{
-		Desc:     "Litti Chokha",
-		Amount:   300,
-		Currency: INR,
+		Desc:   "Litti Chokha",
+		Amount: Money{Amount: 300, Currency: INR},
 		Card: &CardParams{
 			Name: "Pramila Kumari",
 			//Number:   "", // This gets changed per-test
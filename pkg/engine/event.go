@@ -0,0 +1,405 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event Types
+const (
+	EventChargeSucceeded                  = "charge.succeeded"
+	EventChargeCaptured                   = "charge.captured"
+	EventChargeFailed                     = "charge.failed"
+	EventChargeRefunded                   = "charge.refunded"
+	EventChargeRefundUpdated              = "charge.refund.updated"
+	EventChargeUpdated                    = "charge.updated"
+	EventChargeDisputeCreated             = "charge.dispute.created"
+	EventChargeDisputeUpdated             = "charge.dispute.updated"
+	EventChargeDisputeClosed              = "charge.dispute.closed"
+	EventCreditNoteCreated                = "credit_note.created"
+	EventCustomerCreated                  = "customer.created"
+	EventCustomerUpdated                  = "customer.updated"
+	EventCustomerDeleted                  = "customer.deleted"
+	EventCustomerSubscriptionCreated      = "customer.subscription.created"
+	EventCustomerSubscriptionUpdated      = "customer.subscription.updated"
+	EventCustomerSubscriptionDeleted      = "customer.subscription.deleted"
+	EventCustomerSubscriptionTrialWillEnd = "customer.subscription.trial_will_end"
+	EventInvoiceCreated                   = "invoice.created"
+	EventInvoiceUpdated                   = "invoice.updated"
+	EventInvoicePaymentSucceeded          = "invoice.payment_succeeded"
+	EventInvoicePaymentFailed             = "invoice.payment_failed"
+	EventInvoiceFinalized                 = "invoice.finalized"
+	EventInvoiceVoided                    = "invoice.voided"
+	EventInvoiceMarkedUncollectible       = "invoice.marked_uncollectible"
+	EventPlanCreated                      = "plan.created"
+	EventPlanUpdated                      = "plan.updated"
+	EventPlanDeleted                      = "plan.deleted"
+	EventProductCreated                   = "product.created"
+	EventProductUpdated                   = "product.updated"
+	EventProductDeleted                   = "product.deleted"
+)
+
+// SignatureHeader is the http header carrying the signature of a webhook
+// request sent by Bhojpur Subscription.
+const SignatureHeader = "Bhojpur-Signature"
+
+// DefaultTolerance is the maximum age of a webhook request accepted by
+// ConstructEvent, which protects against replay attacks.
+const DefaultTolerance = 5 * time.Minute
+
+// Errors returned when verifying the signature of a webhook request.
+var (
+	ErrInvalidSignatureHeader = errors.New("webhook has an invalid signature header")
+	ErrNoValidSignature       = errors.New("webhook has no valid signature")
+	ErrTooOld                 = errors.New("webhook timestamp is outside the tolerance zone")
+)
+
+// Event represents something that happened in your account, such as a charge
+// succeeding or a subscription being canceled.
+type Event struct {
+	ID              string    `json:"id"`
+	Type            string    `json:"type"`
+	Created         int64     `json:"created"`
+	Data            EventData `json:"data"`
+	PendingWebhooks int       `json:"pending_webhooks"`
+	Request         String    `json:"request"`
+	Livemode        bool      `json:"livemode"`
+}
+
+// EventData holds the API object an Event relates to.
+type EventData struct {
+	// Object is the API object decoded into its type, based on its "object"
+	// attribute: a *Charge, *Invoice, *Customer, *Subscription, *Plan, *Product,
+	// *Refund, *Dispute or *CreditNote. Objects of any other type are decoded
+	// into a map[string]interface{}.
+	Object interface{}
+
+	// ObjectType is the "object" attribute of the API object, i.e. "invoice".
+	ObjectType string
+
+	// Raw is the JSON encoding of the API object.
+	Raw json.RawMessage
+
+	// PreviousAttributes holds the prior values of the attributes that were
+	// changed, for "*.updated" events.
+	PreviousAttributes map[string]interface{}
+}
+
+func (self *EventData) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Object             json.RawMessage        `json:"object"`
+		PreviousAttributes map[string]interface{} `json:"previous_attributes"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var kind struct {
+		Object string `json:"object"`
+	}
+	if err := json.Unmarshal(raw.Object, &kind); err != nil {
+		return err
+	}
+
+	var object interface{}
+	switch kind.Object {
+	case "charge":
+		object = &Charge{}
+	case "invoice":
+		object = &Invoice{}
+	case "customer":
+		object = &Customer{}
+	case "subscription":
+		object = &Subscription{}
+	case "plan":
+		object = &Plan{}
+	case "product":
+		object = &Product{}
+	case "refund":
+		object = &Refund{}
+	case "dispute":
+		object = &Dispute{}
+	case "credit_note":
+		object = &CreditNote{}
+	default:
+		object = &map[string]interface{}{}
+	}
+	if err := json.Unmarshal(raw.Object, object); err != nil {
+		return err
+	}
+	if m, ok := object.(*map[string]interface{}); ok {
+		object = *m
+	}
+
+	self.Object = object
+	self.ObjectType = kind.Object
+	self.Raw = raw.Object
+	self.PreviousAttributes = raw.PreviousAttributes
+	return nil
+}
+
+// EventListParams encapsulates options for filtering a list of Events. The
+// paging options of the embedded ListParams are only used by Iter.
+type EventListParams struct {
+	ListParams
+
+	// (Optional) Only return events of this type, i.e. "invoice.payment_failed".
+	// A "*" wildcard matches several types, i.e. "invoice.*".
+	Type string
+
+	// (Optional) Only return events created within this range of UTC
+	// timestamps.
+	Created *RangeQuery
+}
+
+// listEventsResp is the wrapper for a list of Events, so that we can cleanly
+// parse the JSON.
+type listEventsResp struct {
+	ListMeta
+	Data []*Event `json:"data"`
+}
+
+// EventClient encapsulates operations for querying events using the Bhojpur
+// Subscription REST API. Together with WebhookMux.Dispatch it can be used to
+// replay events that were missed while a webhook endpoint was unavailable.
+type EventClient struct {
+	client *Client
+}
+
+// Retrieves the Event with the given ID.
+func (self *EventClient) Retrieve(id string) (*Event, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *EventClient) RetrieveCtx(ctx context.Context, id string) (*Event, error) {
+	event := Event{}
+	path := "/v1/events/" + url.QueryEscape(id)
+	err := self.client.query(ctx, "GET", path, nil, &event)
+	return &event, err
+}
+
+// Returns a list of your Events.
+func (self *EventClient) List() ([]*Event, error) {
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *EventClient) ListCtx(ctx context.Context) ([]*Event, error) {
+	return self.list(ctx, nil, 10, 0)
+}
+
+// Returns a list of your Events at the specified range.
+func (self *EventClient) ListN(count int, offset int) ([]*Event, error) {
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *EventClient) ListNCtx(ctx context.Context, count int, offset int) ([]*Event, error) {
+	return self.list(ctx, nil, count, offset)
+}
+
+// Returns a list of your Events matching the given filters, at the specified
+// range.
+func (self *EventClient) ListFiltered(params *EventListParams, count int, offset int) ([]*Event, error) {
+	return self.ListFilteredCtx(context.Background(), params, count, offset)
+}
+
+// ListFilteredCtx is like ListFiltered, but uses ctx for the API request.
+func (self *EventClient) ListFilteredCtx(ctx context.Context, params *EventListParams, count int, offset int) ([]*Event, error) {
+	return self.list(ctx, params, count, offset)
+}
+
+func (self *EventClient) list(ctx context.Context, params *EventListParams, count int, offset int) ([]*Event, error) {
+	resp := listEventsResp{}
+
+	// add the count and offset to the list of url values
+	values := url.Values{
+		"count":  {strconv.Itoa(count)},
+		"offset": {strconv.Itoa(offset)},
+	}
+
+	// add the filters, if provided
+	if params != nil {
+		appendEventListParamsToValues(params, &values)
+	}
+
+	err := self.client.query(ctx, "GET", "/v1/events", values, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Iter returns an iterator that lazily pages through all of your Events
+// matching the filters in params, starting at its cursor, if any.
+func (self *EventClient) Iter(params *EventListParams) *EventIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *EventClient) IterCtx(ctx context.Context, params *EventListParams) *EventIter {
+	values := url.Values{}
+	var list *ListParams
+	if params != nil {
+		appendEventListParamsToValues(params, &values)
+		list = &params.ListParams
+	}
+	return &EventIter{newIter(list, values, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listEventsResp{}
+		err := self.client.query(ctx, "GET", "/v1/events", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, event := range resp.Data {
+			items[i] = event
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// EventIter is an iterator over a list of Events.
+type EventIter struct {
+	*Iter
+}
+
+// Current returns the Event at the current position of the iterator.
+func (it *EventIter) Current() *Event {
+	event, _ := it.Iter.Current().(*Event)
+	return event
+}
+
+// ConstructEvent verifies the signature of a webhook request and parses its
+// payload into an Event. The sigHeader is the value of the SignatureHeader
+// http header, and secret is the signing secret of the webhook endpoint.
+// Requests older than DefaultTolerance are rejected.
+func ConstructEvent(payload []byte, sigHeader string, secret string) (*Event, error) {
+	return ConstructEventWithTolerance(payload, sigHeader, secret, DefaultTolerance)
+}
+
+// ConstructEventWithTolerance is like ConstructEvent, but rejects requests
+// older than the given tolerance. A tolerance of zero disables the check.
+func ConstructEventWithTolerance(payload []byte, sigHeader string, secret string, tolerance time.Duration) (*Event, error) {
+	timestamp, signatures, err := parseSignatureHeader(sigHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := computeSignature(timestamp, payload, secret)
+	valid := false
+	for _, sig := range signatures {
+		if hmac.Equal(expected, sig) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrNoValidSignature
+	}
+
+	if tolerance > 0 {
+		age := time.Since(time.Unix(timestamp, 0))
+		if age > tolerance || age < -tolerance {
+			return nil, ErrTooOld
+		}
+	}
+
+	event := Event{}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// SignPayload returns the SignatureHeader value Bhojpur Subscription would
+// send with the given payload at time t. This is primarily used for testing
+// webhook handlers.
+func SignPayload(payload []byte, secret string, t time.Time) string {
+	timestamp := t.Unix()
+	sig := computeSignature(timestamp, payload, secret)
+	return "t=" + strconv.FormatInt(timestamp, 10) + ",v1=" + hex.EncodeToString(sig)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helper Function(s)
+
+func appendEventListParamsToValues(params *EventListParams, values *url.Values) {
+	if params.Type != "" {
+		values.Add("type", params.Type)
+	}
+	if params.Created != nil {
+		appendRangeQueryToValues("created", params.Created, values)
+	}
+}
+
+// computeSignature returns the HMAC-SHA256 of "timestamp.payload".
+func computeSignature(timestamp int64, payload []byte, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// parseSignatureHeader parses a header of the form "t=...,v1=...,v1=...",
+// returning the timestamp and every v1 signature.
+func parseSignatureHeader(header string) (int64, [][]byte, error) {
+	var timestamp int64
+	var signatures [][]byte
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			return 0, nil, ErrInvalidSignatureHeader
+		}
+		switch parts[0] {
+		case "t":
+			t, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return 0, nil, ErrInvalidSignatureHeader
+			}
+			timestamp = t
+		case "v1":
+			sig, err := hex.DecodeString(parts[1])
+			if err != nil {
+				// ignore malformed signatures, another one may be valid
+				continue
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+
+	if timestamp == 0 {
+		return 0, nil, ErrInvalidSignatureHeader
+	}
+	if len(signatures) == 0 {
+		return 0, nil, ErrNoValidSignature
+	}
+	return timestamp, signatures, nil
+}
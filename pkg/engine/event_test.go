@@ -0,0 +1,174 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Sample webhook payload for an invoice.payment_failed Event.
+var (
+	whsecret = "whsec_test"
+
+	invoiceEvent = []byte(`{
+		"id": "evt_1",
+		"type": "invoice.payment_failed",
+		"created": 1522022400,
+		"data": {
+			"object": {
+				"object": "invoice",
+				"id": "in_1",
+				"customer": "cus_1",
+				"amount_due": 2000,
+				"paid": false
+			},
+			"previous_attributes": {"attempt_count": 1}
+		}
+	}`)
+)
+
+// TestConstructEvent will test that a correctly signed payload is parsed into
+// an Event, with its data decoded into the matching API object.
+func TestConstructEvent(t *testing.T) {
+	header := SignPayload(invoiceEvent, whsecret, time.Now())
+	event, err := ConstructEvent(invoiceEvent, header, whsecret)
+	if err != nil {
+		t.Fatalf("Expected Event, got Error %s", err.Error())
+	}
+	if event.Type != EventInvoicePaymentFailed {
+		t.Errorf("Expected Event Type %s, got %s", EventInvoicePaymentFailed, event.Type)
+	}
+	if event.Data.ObjectType != "invoice" {
+		t.Errorf("Expected Object Type invoice, got %s", event.Data.ObjectType)
+	}
+	invoice, ok := event.Data.Object.(*Invoice)
+	if !ok {
+		t.Fatalf("Expected *Invoice, got %T", event.Data.Object)
+	}
+	if invoice.ID != "in_1" || invoice.Customer != "cus_1" {
+		t.Errorf("Expected Invoice in_1 for cus_1, got %s for %s", invoice.ID, invoice.Customer)
+	}
+	if event.Data.PreviousAttributes["attempt_count"] != 1.0 {
+		t.Errorf("Expected previous attempt_count 1, got %v", event.Data.PreviousAttributes["attempt_count"])
+	}
+}
+
+// TestConstructEventInvalid will test that tampered, unsigned, wrongly signed
+// and expired payloads are all rejected.
+func TestConstructEventInvalid(t *testing.T) {
+	now := time.Now()
+	tampered := append([]byte{}, invoiceEvent...)
+	tampered[len(tampered)-2] = ' '
+
+	tests := []struct {
+		name    string
+		payload []byte
+		header  string
+		err     error
+	}{
+		{"tampered", tampered, SignPayload(invoiceEvent, whsecret, now), ErrNoValidSignature},
+		{"wrong secret", invoiceEvent, SignPayload(invoiceEvent, "whsec_other", now), ErrNoValidSignature},
+		{"no header", invoiceEvent, "", ErrInvalidSignatureHeader},
+		{"no signature", invoiceEvent, "t=1522022400", ErrNoValidSignature},
+		{"too old", invoiceEvent, SignPayload(invoiceEvent, whsecret, now.Add(-time.Hour)), ErrTooOld},
+	}
+	for _, test := range tests {
+		if _, err := ConstructEvent(test.payload, test.header, whsecret); err != test.err {
+			t.Errorf("%s: Expected Error %v, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+// TestReplayEvents will test that Events listed with a type and created
+// filter can be replayed through the handlers of a WebhookMux.
+func TestReplayEvents(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte(`{"object":"list","has_more":false,"data":[` + string(invoiceEvent) + `]}`))
+	}))
+	defer server.Close()
+
+	var replayed []string
+	mux := NewWebhookMux(whsecret)
+	mux.Handle(EventInvoicePaymentFailed, func(ctx context.Context, e *Event) error {
+		replayed = append(replayed, e.Data.Object.(*Invoice).ID)
+		return nil
+	})
+
+	client := New("sk_test", WithURL(server.URL))
+	it := client.Events.Iter(&EventListParams{
+		Type:    "invoice.*",
+		Created: &RangeQuery{GTE: 1522022400},
+	})
+	for it.Next() {
+		if err := mux.Dispatch(context.Background(), it.Current()); err != nil {
+			t.Errorf("Expected Event replay, got Error %s", err.Error())
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Expected Event List, got Error %s", err.Error())
+	}
+
+	if want := "created%5Bgte%5D=1522022400&type=invoice.%2A"; query != want {
+		t.Errorf("Expected query %s, got %s", want, query)
+	}
+	if len(replayed) != 1 || replayed[0] != "in_1" {
+		t.Errorf("Expected replayed Invoice in_1, got %v", replayed)
+	}
+}
+
+// TestEventObjectTypes will test that the data of an Event is decoded into the
+// API object of its type, or a map for unknown types.
+func TestEventObjectTypes(t *testing.T) {
+	tests := []struct {
+		object string
+		typ    string
+	}{
+		{`{"object": "dispute", "id": "dp_1", "evidence_details": {"due_by": 1522627200}}`, "*engine.Dispute"},
+		{`{"object": "refund", "id": "re_1"}`, "*engine.Refund"},
+		{`{"object": "credit_note", "id": "cn_1"}`, "*engine.CreditNote"},
+		{`{"object": "product", "id": "prod_1"}`, "*engine.Product"},
+		{`{"object": "coupon", "id": "co_1"}`, "map[string]interface {}"},
+	}
+	for _, test := range tests {
+		event := Event{}
+		if err := json.Unmarshal([]byte(`{"id": "evt_1", "data": {"object": `+test.object+`}}`), &event); err != nil {
+			t.Errorf("Expected Event, got Error %s", err.Error())
+			continue
+		}
+		if typ := fmt.Sprintf("%T", event.Data.Object); typ != test.typ {
+			t.Errorf("Expected %s, got %s", test.typ, typ)
+		}
+	}
+
+	event := Event{}
+	json.Unmarshal([]byte(`{"id": "evt_1", "data": {"object": `+tests[0].object+`}}`), &event)
+	if dispute := event.Data.Object.(*Dispute); dispute.EvidenceDetails == nil || dispute.EvidenceDetails.DueBy != 1522627200 {
+		t.Errorf("Expected Dispute evidence due by %d, got %+v", 1522627200, dispute.EvidenceDetails)
+	}
+}
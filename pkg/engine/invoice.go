@@ -21,46 +21,126 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
+	"encoding/json"
 	"net/url"
 	"strconv"
 )
 
+// Invoice Statuses
+const (
+	InvoiceDraft         = "draft"
+	InvoiceOpen          = "open"
+	InvoicePaid          = "paid"
+	InvoiceVoid          = "void"
+	InvoiceUncollectible = "uncollectible"
+)
+
 // Invoice represents statements of what a customer owes for a particular
 // billing period, including subscriptions, invoice items, and any automatic
 // proration adjustments if necessary.
 type Invoice struct {
-	ID              string        `json:"id"`
-	AmountDue       float64       `json:"amount_due"`
-	AttemptCount    int           `json:"attempt_count"`
-	Attempted       bool          `json:"attempted"`
-	Closed          bool          `json:"closed"`
-	Paid            bool          `json:"paid"`
-	PeriodEnd       int64         `json:"period_end"`
-	PeriodStart     int64         `json:"period_start"`
-	Subtotal        float64       `json:"subtotal"`
-	Total           float64       `json:"total"`
-	Charge          String        `json:"charge"`
-	Customer        string        `json:"customer"`
-	Date            int64         `json:"date"`
-	Discount        *Discount     `json:"discount"`
-	Lines           *InvoiceLines `json:"lines"`
-	StartingBalance float64       `json:"starting_balance"`
-	EndingBalance   float64       `json:"ending_balance"`
-	NextPayment     float64       `json:"next_payment_attempt"`
-	Livemode        bool          `json:"livemode"`
-}
-
-// InvoiceLines represents an individual line items that is part of an invoice.
+	ID              string            `json:"id"`
+	Status          string            `json:"status"`
+	AmountDue       Money             `json:"amount_due"`
+	AttemptCount    int               `json:"attempt_count"`
+	Attempted       bool              `json:"attempted"`
+	Closed          bool              `json:"closed"`
+	Forgiven        bool              `json:"forgiven"`
+	Paid            bool              `json:"paid"`
+	PeriodEnd       int64             `json:"period_end"`
+	PeriodStart     int64             `json:"period_start"`
+	Subtotal        Money             `json:"subtotal"`
+	Total           Money             `json:"total"`
+	Charge          String            `json:"charge"`
+	Currency        string            `json:"currency"`
+	Customer        string            `json:"customer"`
+	Subscription    String            `json:"subscription"`
+	Date            int64             `json:"date"`
+	Desc            String            `json:"description"`
+	Discount        *Discount         `json:"discount"`
+	Lines           *InvoiceLines     `json:"lines"`
+	StartingBalance Money             `json:"starting_balance"`
+	EndingBalance   Money             `json:"ending_balance"`
+	NextPayment     float64           `json:"next_payment_attempt"`
+	Metadata        map[string]string `json:"metadata"`
+	Livemode        bool              `json:"livemode"`
+}
+
+func (self *Invoice) UnmarshalJSON(data []byte) error {
+	type invoice Invoice
+	if err := json.Unmarshal(data, (*invoice)(self)); err != nil {
+		return err
+	}
+	setCurrency(self.Currency, &self.AmountDue, &self.Subtotal, &self.Total, &self.StartingBalance, &self.EndingBalance)
+	if self.Lines != nil {
+		for _, line := range self.Lines.Subscriptions {
+			setCurrency(self.Currency, &line.Amount)
+		}
+	}
+	return nil
+}
+
+// InvoiceLines is the list of line items of an invoice. Data holds the first
+// page of lines, and Invoices.LinesIter pages through all of them. The lines
+// are also grouped by kind, without paging.
 type InvoiceLines struct {
+	ListMeta
+	Data          []*InvoiceLine      `json:"data"`
 	InvoiceItems  []*InvoiceItem      `json:"invoiceitems"`
 	Prorations    []*InvoiceItem      `json:"prorations"`
 	Subscriptions []*SubscriptionItem `json:"subscriptions"`
 }
 
+// Invoice Line Types
+const (
+	InvoiceLineInvoiceItem  = "invoiceitem"
+	InvoiceLineSubscription = "subscription"
+)
+
+// InvoiceLine represents a single line item of an invoice, which bills either
+// an invoice item, including prorations, or a subscription for a period.
+type InvoiceLine struct {
+	ID           string       `json:"id"`
+	Type         string       `json:"type"`
+	Amount       Money        `json:"amount"`
+	Currency     string       `json:"currency"`
+	Desc         String       `json:"description"`
+	Period       *Period      `json:"period"`
+	Proration    bool         `json:"proration"`
+	Quantity     int64        `json:"quantity"`
+	Plan         *Plan        `json:"plan"`
+	Subscription String       `json:"subscription"`
+	InvoiceItem  String       `json:"invoice_item"`
+	Discountable bool         `json:"discountable"`
+	TaxAmounts   []*TaxAmount `json:"tax_amounts"`
+	Livemode     bool         `json:"livemode"`
+}
+
+func (self *InvoiceLine) UnmarshalJSON(data []byte) error {
+	type invoiceLine InvoiceLine
+	if err := json.Unmarshal(data, (*invoiceLine)(self)); err != nil {
+		return err
+	}
+	setCurrency(self.Currency, &self.Amount)
+	for _, tax := range self.TaxAmounts {
+		setCurrency(self.Currency, &tax.Amount)
+	}
+	return nil
+}
+
+// TaxAmount is the amount of tax charged on an invoice line at a tax rate.
+type TaxAmount struct {
+	Amount    Money  `json:"amount"`
+	Inclusive bool   `json:"inclusive"`
+	TaxRate   string `json:"tax_rate"`
+}
+
 type SubscriptionItem struct {
-	Amount float64 `json:"amount"`
-	Period *Period `json:"period"`
-	Plan   *Plan   `json:"plan"`
+	Amount   Money   `json:"amount"`
+	Period   *Period `json:"period"`
+	Plan     *Plan   `json:"plan"`
+	Quantity int64   `json:"quantity"`
 }
 
 type Period struct {
@@ -68,50 +148,295 @@ type Period struct {
 	End   int64 `json:"end"`
 }
 
-// InvoiceClient encapsulates operations for querying invoices using the
-// Bhojpur Subscription REST API.
-type InvoiceClient struct{}
+// InvoiceParams encapsulates options for creating and updating Invoices.
+type InvoiceParams struct {
+	// (Optional) An arbitrary string which you can attach to the invoice.
+	Desc string
+
+	// (Optional) Whether the invoice is closed, which stops any further
+	// attempts to pay it automatically. Only used by Update.
+	Closed *bool
+
+	// (Optional) Forgiving an invoice marks it uncollectible, like
+	// MarkUncollectible. Only used by Update, and it cannot be undone.
+	Forgiven *bool
+
+	// (Optional) Set of key/value pairs to attach to the invoice. A blank
+	// value removes the key on update.
+	Metadata map[string]string
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
+}
+
+// InvoiceListParams encapsulates options for filtering a list of Invoices.
+// The paging options of the embedded ListParams are only used by Iter.
+type InvoiceListParams struct {
+	ListParams
+
+	// (Optional) Only return invoices for the customer with this ID.
+	Customer string
+
+	// (Optional) Only return invoices created within this range of UTC
+	// timestamps.
+	Created *RangeQuery
+
+	// (Optional) Only return invoices that were, or were not, paid.
+	Paid *bool
+
+	// (Optional) Only return invoices in this 3-letter ISO currency.
+	Currency string
+
+	// (Optional) Only return invoices for the subscription with this ID.
+	Subscription string
+
+	// (Optional) Only return invoices with a line for the plan with this ID.
+	Plan string
+}
+
+// InvoiceUpcomingParams encapsulates options for previewing the upcoming
+// invoice of a customer, as it would be after a proposed change to one of its
+// subscriptions.
+type InvoiceUpcomingParams struct {
+	// The ID of the customer whose upcoming invoice to preview.
+	Customer string
+
+	// (Optional) The ID of the subscription to preview the changes to. When
+	// blank, a new subscription to the Plan is previewed instead, if given.
+	Subscription string
+
+	// (Optional) The ID of the plan to change the subscription to.
+	Plan string
+
+	// (Optional) The quantity to change the subscription to.
+	Quantity int64
+
+	// (Optional) The code of a coupon to apply to the customer.
+	Coupon string
+
+	// (Optional) Whether to prorate the changes to the subscription. Defaults
+	// to true.
+	Prorate *bool
+
+	// (Optional) UTC integer timestamp at which to calculate the prorations
+	// for the changes. Defaults to the time of the request.
+	ProrationDate int64
+
+	// (Optional) UTC integer timestamp representing the end of the trial
+	// period of the subscription.
+	TrialEnd int64
+}
+
+// listInvoiceLinesResp is the wrapper for a list of Invoice Lines, so that we
+// can cleanly parse the JSON.
+type listInvoiceLinesResp struct {
+	ListMeta
+	Data []*InvoiceLine `json:"data"`
+}
+
+// listInvoicesResp is the wrapper for a list of Invoices, so that we can cleanly
+// parse the JSON.
+type listInvoicesResp struct {
+	ListMeta
+	Data []*Invoice `json:"data"`
+}
+
+// InvoiceClient encapsulates operations for creating, paying, updating and
+// querying invoices using the Bhojpur Subscription REST API.
+type InvoiceClient struct {
+	client *Client
+}
+
+// Creates a new draft invoice for the customer's pending invoice items, which
+// is finalized and paid automatically, unless it is closed first. Use Pay to
+// bill it immediately. The params are optional, and may be nil.
+func (self *InvoiceClient) Create(customer string, params *InvoiceParams) (*Invoice, error) {
+	return self.CreateCtx(context.Background(), customer, params)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *InvoiceClient) CreateCtx(ctx context.Context, customer string, params *InvoiceParams) (*Invoice, error) {
+	if params == nil {
+		params = &InvoiceParams{}
+	}
+	invoice := Invoice{}
+	values := url.Values{"customer": {customer}}
+	appendInvoiceParamsToValues(params, &values)
+
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/invoices", params.IdempotencyKey, values, &invoice)
+	return &invoice, err
+}
 
 // Retrieves the invoice with the given ID.
 func (self *InvoiceClient) Retrieve(id string) (*Invoice, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *InvoiceClient) RetrieveCtx(ctx context.Context, id string) (*Invoice, error) {
 	invoice := Invoice{}
 	path := "/v1/invoices/" + url.QueryEscape(id)
-	err := query("GET", path, nil, &invoice)
+	err := self.client.query(ctx, "GET", path, nil, &invoice)
+	return &invoice, err
+}
+
+// Updates the invoice with the given ID.
+func (self *InvoiceClient) Update(id string, params *InvoiceParams) (*Invoice, error) {
+	return self.UpdateCtx(context.Background(), id, params)
+}
+
+// UpdateCtx is like Update, but uses ctx for the API request.
+func (self *InvoiceClient) UpdateCtx(ctx context.Context, id string, params *InvoiceParams) (*Invoice, error) {
+	invoice := Invoice{}
+	values := url.Values{}
+	if params.Closed != nil {
+		values.Add("closed", strconv.FormatBool(*params.Closed))
+	}
+	if params.Forgiven != nil {
+		values.Add("forgiven", strconv.FormatBool(*params.Forgiven))
+	}
+	appendInvoiceParamsToValues(params, &values)
+
+	path := "/v1/invoices/" + url.QueryEscape(id)
+	err := self.client.queryIdempotent(ctx, "POST", path, params.IdempotencyKey, values, &invoice)
+	return &invoice, err
+}
+
+// Finalizes the draft invoice with the given ID, so that it is open for
+// payment and can no longer be changed.
+func (self *InvoiceClient) Finalize(id string) (*Invoice, error) {
+	return self.FinalizeCtx(context.Background(), id)
+}
+
+// FinalizeCtx is like Finalize, but uses ctx for the API request.
+func (self *InvoiceClient) FinalizeCtx(ctx context.Context, id string) (*Invoice, error) {
+	return self.action(ctx, id, "finalize")
+}
+
+// Pays the invoice with the given ID immediately, by charging the customer's
+// default card, rather than waiting for the next automatic attempt. A draft
+// invoice is finalized first.
+func (self *InvoiceClient) Pay(id string) (*Invoice, error) {
+	return self.PayCtx(context.Background(), id)
+}
+
+// PayCtx is like Pay, but uses ctx for the API request.
+func (self *InvoiceClient) PayCtx(ctx context.Context, id string) (*Invoice, error) {
+	return self.action(ctx, id, "pay")
+}
+
+// Voids the open invoice with the given ID, for invoices that were issued in
+// error. A voided invoice can no longer be paid.
+func (self *InvoiceClient) Void(id string) (*Invoice, error) {
+	return self.VoidCtx(context.Background(), id)
+}
+
+// VoidCtx is like Void, but uses ctx for the API request.
+func (self *InvoiceClient) VoidCtx(ctx context.Context, id string) (*Invoice, error) {
+	return self.action(ctx, id, "void")
+}
+
+// Marks the open invoice with the given ID as uncollectible, for bad debt
+// that is not expected to be paid. It can still be paid with Pay.
+func (self *InvoiceClient) MarkUncollectible(id string) (*Invoice, error) {
+	return self.MarkUncollectibleCtx(context.Background(), id)
+}
+
+// MarkUncollectibleCtx is like MarkUncollectible, but uses ctx for the API
+// request.
+func (self *InvoiceClient) MarkUncollectibleCtx(ctx context.Context, id string) (*Invoice, error) {
+	return self.action(ctx, id, "mark_uncollectible")
+}
+
+func (self *InvoiceClient) action(ctx context.Context, id string, action string) (*Invoice, error) {
+	invoice := Invoice{}
+	path := "/v1/invoices/" + url.QueryEscape(id) + "/" + action
+	err := self.client.query(ctx, "POST", path, nil, &invoice)
 	return &invoice, err
 }
 
 // Retrieves the upcoming invoice the given customer ID.
 func (self *InvoiceClient) RetrieveCustomer(cid string) (*Invoice, error) {
+	return self.RetrieveCustomerCtx(context.Background(), cid)
+}
+
+// RetrieveCustomerCtx is like RetrieveCustomer, but uses ctx for the API request.
+func (self *InvoiceClient) RetrieveCustomerCtx(ctx context.Context, cid string) (*Invoice, error) {
 	invoice := Invoice{}
 	values := url.Values{"customer": {cid}}
-	err := query("GET", "/v1/invoices/upcoming", values, &invoice)
+	err := self.client.query(ctx, "GET", "/v1/invoices/upcoming", values, &invoice)
+	return &invoice, err
+}
+
+// Upcoming previews the upcoming invoice of a customer, including the
+// prorations for the proposed changes to a subscription in params, without
+// making any changes.
+func (self *InvoiceClient) Upcoming(params *InvoiceUpcomingParams) (*Invoice, error) {
+	return self.UpcomingCtx(context.Background(), params)
+}
+
+// UpcomingCtx is like Upcoming, but uses ctx for the API request.
+func (self *InvoiceClient) UpcomingCtx(ctx context.Context, params *InvoiceUpcomingParams) (*Invoice, error) {
+	invoice := Invoice{}
+	values := url.Values{"customer": {params.Customer}}
+	appendInvoiceUpcomingParamsToValues(params, &values)
+	err := self.client.query(ctx, "GET", "/v1/invoices/upcoming", values, &invoice)
 	return &invoice, err
 }
 
 // Returns a list of Invoices.
 func (self *InvoiceClient) List() ([]*Invoice, error) {
-	return self.list("", 10, 0)
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *InvoiceClient) ListCtx(ctx context.Context) ([]*Invoice, error) {
+	return self.list(ctx, nil, 10, 0)
 }
 
 // Returns a list of Invoices at the specified range.
 func (self *InvoiceClient) ListN(count int, offset int) ([]*Invoice, error) {
-	return self.list("", count, offset)
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *InvoiceClient) ListNCtx(ctx context.Context, count int, offset int) ([]*Invoice, error) {
+	return self.list(ctx, nil, count, offset)
 }
 
 // Returns a list of Invoices with the given Customer ID.
 func (self *InvoiceClient) CustomerList(id string) ([]*Invoice, error) {
-	return self.list(id, 10, 0)
+	return self.CustomerListCtx(context.Background(), id)
+}
+
+// CustomerListCtx is like CustomerList, but uses ctx for the API request.
+func (self *InvoiceClient) CustomerListCtx(ctx context.Context, id string) ([]*Invoice, error) {
+	return self.list(ctx, &InvoiceListParams{Customer: id}, 10, 0)
 }
 
 // Returns a list of Invoices with the given Customer ID, at the specified range.
 func (self *InvoiceClient) CustomerListN(id string, count int, offset int) ([]*Invoice, error) {
-	return self.list(id, count, offset)
+	return self.CustomerListNCtx(context.Background(), id, count, offset)
 }
 
-func (self *InvoiceClient) list(id string, count int, offset int) ([]*Invoice, error) {
-	// define a wrapper function for the Invoice List, so that we can
-	// cleanly parse the JSON
-	type listInvoicesResp struct{ Data []*Invoice }
+// CustomerListNCtx is like CustomerListN, but uses ctx for the API request.
+func (self *InvoiceClient) CustomerListNCtx(ctx context.Context, id string, count int, offset int) ([]*Invoice, error) {
+	return self.list(ctx, &InvoiceListParams{Customer: id}, count, offset)
+}
+
+// Returns a list of Invoices matching the given filters, at the specified
+// range.
+func (self *InvoiceClient) ListFiltered(params *InvoiceListParams, count int, offset int) ([]*Invoice, error) {
+	return self.ListFilteredCtx(context.Background(), params, count, offset)
+}
+
+// ListFilteredCtx is like ListFiltered, but uses ctx for the API request.
+func (self *InvoiceClient) ListFilteredCtx(ctx context.Context, params *InvoiceListParams, count int, offset int) ([]*Invoice, error) {
+	return self.list(ctx, params, count, offset)
+}
+
+func (self *InvoiceClient) list(ctx context.Context, params *InvoiceListParams, count int, offset int) ([]*Invoice, error) {
 	resp := listInvoicesResp{}
 
 	// add the count and offset to the list of url values
@@ -120,14 +445,139 @@ func (self *InvoiceClient) list(id string, count int, offset int) ([]*Invoice, e
 		"offset": {strconv.Itoa(offset)},
 	}
 
-	// query for customer id, if provided
-	if id != "" {
-		values.Add("customer", id)
+	// add the filters, if provided
+	if params != nil {
+		appendInvoiceListParamsToValues(params, &values)
 	}
 
-	err := query("GET", "/v1/invoices", values, &resp)
+	err := self.client.query(ctx, "GET", "/v1/invoices", values, &resp)
 	if err != nil {
 		return nil, err
 	}
 	return resp.Data, nil
 }
+
+// Iter returns an iterator that lazily pages through all of your Invoices
+// matching the filters in params, starting at its cursor, if any.
+func (self *InvoiceClient) Iter(params *InvoiceListParams) *InvoiceIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *InvoiceClient) IterCtx(ctx context.Context, params *InvoiceListParams) *InvoiceIter {
+	values := url.Values{}
+	var list *ListParams
+	if params != nil {
+		appendInvoiceListParamsToValues(params, &values)
+		list = &params.ListParams
+	}
+	return &InvoiceIter{newIter(list, values, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listInvoicesResp{}
+		err := self.client.query(ctx, "GET", "/v1/invoices", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, invoice := range resp.Data {
+			items[i] = invoice
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// InvoiceIter is an iterator over a list of Invoices.
+type InvoiceIter struct {
+	*Iter
+}
+
+// Current returns the Invoice at the current position of the iterator.
+func (it *InvoiceIter) Current() *Invoice {
+	invoice, _ := it.Iter.Current().(*Invoice)
+	return invoice
+}
+
+// LinesIter returns an iterator that lazily pages through all of the line
+// items of the invoice with the given ID, starting at the cursor in params, if
+// any.
+func (self *InvoiceClient) LinesIter(id string, params *ListParams) *InvoiceLineIter {
+	return self.LinesIterCtx(context.Background(), id, params)
+}
+
+// LinesIterCtx is like LinesIter, but uses ctx for every API request.
+func (self *InvoiceClient) LinesIterCtx(ctx context.Context, id string, params *ListParams) *InvoiceLineIter {
+	path := "/v1/invoices/" + url.QueryEscape(id) + "/lines"
+	return &InvoiceLineIter{newIter(params, url.Values{}, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listInvoiceLinesResp{}
+		err := self.client.query(ctx, "GET", path, values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, line := range resp.Data {
+			items[i] = line
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// InvoiceLineIter is an iterator over a list of Invoice Lines.
+type InvoiceLineIter struct {
+	*Iter
+}
+
+// Current returns the Invoice Line at the current position of the iterator.
+func (it *InvoiceLineIter) Current() *InvoiceLine {
+	line, _ := it.Iter.Current().(*InvoiceLine)
+	return line
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helper Function(s)
+
+func appendInvoiceParamsToValues(params *InvoiceParams, values *url.Values) {
+	if params.Desc != "" {
+		values.Add("description", params.Desc)
+	}
+	for k, v := range params.Metadata {
+		values.Add("metadata["+k+"]", v)
+	}
+}
+
+func appendInvoiceListParamsToValues(params *InvoiceListParams, values *url.Values) {
+	if params.Customer != "" {
+		values.Add("customer", params.Customer)
+	}
+	if params.Created != nil {
+		appendRangeQueryToValues("created", params.Created, values)
+	}
+	if params.Paid != nil {
+		values.Add("paid", strconv.FormatBool(*params.Paid))
+	}
+	if params.Currency != "" {
+		values.Add("currency", params.Currency)
+	}
+	if params.Subscription != "" {
+		values.Add("subscription", params.Subscription)
+	}
+	if params.Plan != "" {
+		values.Add("plan", params.Plan)
+	}
+}
+
+func appendInvoiceUpcomingParamsToValues(params *InvoiceUpcomingParams, values *url.Values) {
+	if params.Subscription != "" {
+		values.Add("subscription", params.Subscription)
+	}
+	if params.Plan != "" {
+		values.Add("subscription_plan", params.Plan)
+	}
+	if params.Quantity != 0 {
+		values.Add("subscription_quantity", strconv.FormatInt(params.Quantity, 10))
+	}
+	if params.Coupon != "" {
+		values.Add("coupon", params.Coupon)
+	}
+	if params.Prorate != nil {
+		values.Add("subscription_prorate", strconv.FormatBool(*params.Prorate))
+	}
+	if params.ProrationDate != 0 {
+		values.Add("subscription_proration_date", strconv.FormatInt(params.ProrationDate, 10))
+	}
+	if params.TrialEnd != 0 {
+		values.Add("subscription_trial_end", strconv.FormatInt(params.TrialEnd, 10))
+	}
+}
@@ -21,6 +21,8 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
+	"encoding/json"
 	"net/url"
 	"strconv"
 )
@@ -28,14 +30,30 @@ import (
 // InvoiceItem represents a charge (or credit) that should be applied to the
 // customer at the end of a billing cycle.
 type InvoiceItem struct {
-	ID       string  `json:"id"`
-	Amount   float64 `json:"amount"`
-	Currency string  `json:"currency"`
-	Customer string  `json:"customer"`
-	Date     int64   `json:"date"`
-	Desc     String  `json:"description"`
-	Invoice  String  `json:"invoice"`
-	Livemode bool    `json:"livemode"`
+	ID           string            `json:"id"`
+	Amount       Money             `json:"amount"`
+	Currency     string            `json:"currency"`
+	Customer     string            `json:"customer"`
+	Date         int64             `json:"date"`
+	Desc         String            `json:"description"`
+	Invoice      String            `json:"invoice"`
+	Quantity     int64             `json:"quantity"`
+	UnitAmount   Money             `json:"unit_amount"`
+	Period       *Period           `json:"period"`
+	Subscription String            `json:"subscription"`
+	Discountable bool              `json:"discountable"`
+	Proration    bool              `json:"proration"`
+	Metadata     map[string]string `json:"metadata"`
+	Livemode     bool              `json:"livemode"`
+}
+
+func (self *InvoiceItem) UnmarshalJSON(data []byte) error {
+	type invoiceItem InvoiceItem
+	if err := json.Unmarshal(data, (*invoiceItem)(self)); err != nil {
+		return err
+	}
+	setCurrency(self.Currency, &self.Amount, &self.UnitAmount)
+	return nil
 }
 
 // InvoiceItemParams encapsulates options for creating a new Invoice Items.
@@ -44,13 +62,33 @@ type InvoiceItemParams struct {
 	// billed.
 	Customer string
 
-	// The decimal amount in paisa of the charge to be applied to the upcoming
-	// invoice. If you want to apply a credit to the customer's account, pass a
-	// negative amount.
-	Amount float64
+	// The amount in the smallest currency unit of the charge to be applied to
+	// the upcoming invoice, and its currency. If you want to apply a credit to
+	// the customer's account, pass a negative amount.
+	Amount Money
+
+	// (Optional) The price of a single unit, instead of the Amount, which is
+	// then the UnitAmount times the Quantity.
+	UnitAmount Money
+
+	// (Optional) The number of units billed at the UnitAmount. Defaults to 1.
+	Quantity int64
+
+	// (Optional) The period that the invoice item bills for, such as the
+	// month of an overage. Defaults to the date of the invoice item.
+	Period *Period
+
+	// (Optional) The ID of a subscription of the customer, whose upcoming
+	// invoice the invoice item is added to. Only used by Create.
+	Subscription string
 
-	// 3-letter ISO code for currency. Currently, only 'inr' is supported.
-	Currency string
+	// (Optional) Whether discounts apply to the invoice item. Defaults to
+	// true.
+	Discountable *bool
+
+	// (Optional) Set of key/value pairs to attach to the invoice item. A
+	// blank value removes the key on update.
+	Metadata map[string]string
 
 	// (Optional) An arbitrary string which you can attach to the invoice item.
 	// The description is displayed in the invoice for easy tracking.
@@ -60,63 +98,101 @@ type InvoiceItemParams struct {
 	// When left blank, the invoice item will be added to the next upcoming
 	// scheduled invoice.
 	Invoice string
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
+}
+
+// listInvoiceItemsResp is the wrapper for a list of Invoice Items, so that we can cleanly
+// parse the JSON.
+type listInvoiceItemsResp struct {
+	ListMeta
+	Data []*InvoiceItem `json:"data"`
 }
 
 // InvoiceItemClient encapsulates operations for creating, updating, deleting
 // and querying invoices using the Bhojpur Subscription REST API.
-type InvoiceItemClient struct{}
+type InvoiceItemClient struct {
+	client *Client
+}
 
 // Create adds an arbitrary charge or credit to the customer's upcoming invoice.
 func (self *InvoiceItemClient) Create(params *InvoiceItemParams) (*InvoiceItem, error) {
+	return self.CreateCtx(context.Background(), params)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *InvoiceItemClient) CreateCtx(ctx context.Context, params *InvoiceItemParams) (*InvoiceItem, error) {
 	item := InvoiceItem{}
-	values := url.Values{
-		"amount":   {strconv.FormatFloat(params.Amount, 'E', -1, 64)},
-		"currency": {params.Currency},
-		"customer": {params.Customer},
+	values := url.Values{"customer": {params.Customer}}
+	if params.UnitAmount.IsZero() {
+		values.Add("amount", params.Amount.encode())
+		values.Add("currency", params.Amount.Currency)
+	} else {
+		values.Add("unit_amount", params.UnitAmount.encode())
+		values.Add("currency", params.UnitAmount.Currency)
 	}
 
 	// add optional parameters
-	if len(params.Desc) != 0 {
-		values.Add("description", params.Desc)
-	}
 	if len(params.Invoice) != 0 {
 		values.Add("invoice", params.Invoice)
 	}
+	if len(params.Subscription) != 0 {
+		values.Add("subscription", params.Subscription)
+	}
+	appendInvoiceItemParamsToValues(params, &values)
 
-	err := query("POST", "/v1/invoiceitems", values, &item)
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/invoiceitems", params.IdempotencyKey, values, &item)
 	return &item, err
 }
 
 // Retrieves the Invoice Item with the given ID.
 func (self *InvoiceItemClient) Retrieve(id string) (*InvoiceItem, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *InvoiceItemClient) RetrieveCtx(ctx context.Context, id string) (*InvoiceItem, error) {
 	item := InvoiceItem{}
 	path := "/v1/invoiceitems/" + url.QueryEscape(id)
-	err := query("GET", path, nil, &item)
+	err := self.client.query(ctx, "GET", path, nil, &item)
 	return &item, err
 }
 
-// Update changes the amount or description of an Invoice Item on an upcoming
-// invoice, using the given Invoice Item ID.
+// Update changes the amount, quantity, description or other details of an
+// Invoice Item on an upcoming invoice, using the given Invoice Item ID.
 func (self *InvoiceItemClient) Update(id string, params *InvoiceItemParams) (*InvoiceItem, error) {
+	return self.UpdateCtx(context.Background(), id, params)
+}
+
+// UpdateCtx is like Update, but uses ctx for the API request.
+func (self *InvoiceItemClient) UpdateCtx(ctx context.Context, id string, params *InvoiceItemParams) (*InvoiceItem, error) {
 	item := InvoiceItem{}
 	values := url.Values{}
 
-	if len(params.Desc) != 0 {
-		values.Add("description", params.Desc)
+	if !params.Amount.IsZero() {
+		values.Add("amount", params.Amount.encode())
 	}
-	if params.Amount != 0 {
-		values.Add("invoice", strconv.FormatFloat(params.Amount, 'E', -1, 64))
+	if !params.UnitAmount.IsZero() {
+		values.Add("unit_amount", params.UnitAmount.encode())
 	}
+	appendInvoiceItemParamsToValues(params, &values)
 
-	err := query("POST", "/v1/invoiceitems/"+url.QueryEscape(id), values, &item)
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/invoiceitems/"+url.QueryEscape(id), params.IdempotencyKey, values, &item)
 	return &item, err
 }
 
 // Removes an Invoice Item with the given ID.
 func (self *InvoiceItemClient) Delete(id string) (bool, error) {
+	return self.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx is like Delete, but uses ctx for the API request.
+func (self *InvoiceItemClient) DeleteCtx(ctx context.Context, id string) (bool, error) {
 	resp := DeleteResp{}
 	path := "/v1/invoiceitems/" + url.QueryEscape(id)
-	if err := query("DELETE", path, nil, &resp); err != nil {
+	if err := self.client.query(ctx, "DELETE", path, nil, &resp); err != nil {
 		return false, err
 	}
 	return resp.Deleted, nil
@@ -124,29 +200,46 @@ func (self *InvoiceItemClient) Delete(id string) (bool, error) {
 
 // Returns a list of Invoice Items.
 func (self *InvoiceItemClient) List() ([]*InvoiceItem, error) {
-	return self.list("", 10, 0)
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *InvoiceItemClient) ListCtx(ctx context.Context) ([]*InvoiceItem, error) {
+	return self.list(ctx, "", 10, 0)
 }
 
 // Returns a list of Invoice Items at the specified range.
 func (self *InvoiceItemClient) ListN(count int, offset int) ([]*InvoiceItem, error) {
-	return self.list("", count, offset)
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *InvoiceItemClient) ListNCtx(ctx context.Context, count int, offset int) ([]*InvoiceItem, error) {
+	return self.list(ctx, "", count, offset)
 }
 
 // Returns a list of Invoice Items for the specified Customer ID.
 func (self *InvoiceItemClient) CustomerList(id string) ([]*InvoiceItem, error) {
-	return self.list(id, 10, 0)
+	return self.CustomerListCtx(context.Background(), id)
+}
+
+// CustomerListCtx is like CustomerList, but uses ctx for the API request.
+func (self *InvoiceItemClient) CustomerListCtx(ctx context.Context, id string) ([]*InvoiceItem, error) {
+	return self.list(ctx, id, 10, 0)
 }
 
 // Returns a list of Invoice Items for the specified Customer ID, at the
 // specified range.
 func (self *InvoiceItemClient) CustomerListN(id string, count int, offset int) ([]*InvoiceItem, error) {
-	return self.list(id, count, offset)
+	return self.CustomerListNCtx(context.Background(), id, count, offset)
 }
 
-func (self *InvoiceItemClient) list(id string, count int, offset int) ([]*InvoiceItem, error) {
-	// define a wrapper function for the Invoice Items List, so that we can
-	// cleanly parse the JSON
-	type listInvoiceItemsResp struct{ Data []*InvoiceItem }
+// CustomerListNCtx is like CustomerListN, but uses ctx for the API request.
+func (self *InvoiceItemClient) CustomerListNCtx(ctx context.Context, id string, count int, offset int) ([]*InvoiceItem, error) {
+	return self.list(ctx, id, count, offset)
+}
+
+func (self *InvoiceItemClient) list(ctx context.Context, id string, count int, offset int) ([]*InvoiceItem, error) {
 	resp := listInvoiceItemsResp{}
 
 	// add the count and offset to the list of url values
@@ -160,9 +253,61 @@ func (self *InvoiceItemClient) list(id string, count int, offset int) ([]*Invoic
 		values.Add("customer", id)
 	}
 
-	err := query("GET", "/v1/invoiceitems", values, &resp)
+	err := self.client.query(ctx, "GET", "/v1/invoiceitems", values, &resp)
 	if err != nil {
 		return nil, err
 	}
 	return resp.Data, nil
 }
+
+// Iter returns an iterator that lazily pages through all of your Invoice Items,
+// starting at the cursor given in params, if any.
+func (self *InvoiceItemClient) Iter(params *ListParams) *InvoiceItemIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *InvoiceItemClient) IterCtx(ctx context.Context, params *ListParams) *InvoiceItemIter {
+	return &InvoiceItemIter{newIter(params, url.Values{}, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listInvoiceItemsResp{}
+		err := self.client.query(ctx, "GET", "/v1/invoiceitems", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, item := range resp.Data {
+			items[i] = item
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// InvoiceItemIter is an iterator over a list of Invoice Items.
+type InvoiceItemIter struct {
+	*Iter
+}
+
+// Current returns the InvoiceItem at the current position of the iterator.
+func (it *InvoiceItemIter) Current() *InvoiceItem {
+	item, _ := it.Iter.Current().(*InvoiceItem)
+	return item
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helper Function(s)
+
+func appendInvoiceItemParamsToValues(params *InvoiceItemParams, values *url.Values) {
+	if len(params.Desc) != 0 {
+		values.Add("description", params.Desc)
+	}
+	if params.Quantity != 0 {
+		values.Add("quantity", strconv.FormatInt(params.Quantity, 10))
+	}
+	if params.Period != nil {
+		values.Add("period[start]", strconv.FormatInt(params.Period.Start, 10))
+		values.Add("period[end]", strconv.FormatInt(params.Period.End, 10))
+	}
+	if params.Discountable != nil {
+		values.Add("discountable", strconv.FormatBool(*params.Discountable))
+	}
+	for k, v := range params.Metadata {
+		values.Add("metadata["+k+"]", v)
+	}
+}
@@ -0,0 +1,134 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+)
+
+// TestCreateInvoiceItem will test that an invoice item can be billed as a
+// quantity of a unit amount, for a period.
+func TestCreateInvoiceItem(t *testing.T) {
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+
+	params := InvoiceItemParams{
+		Customer:   cust.ID,
+		UnitAmount: Money{Amount: 250, Currency: INR},
+		Quantity:   4,
+		Period:     &Period{Start: 1609459200, End: 1612137600},
+		Desc:       "overage",
+		Metadata:   map[string]string{"meter": "api_calls"},
+	}
+	item, err := InvoiceItems.Create(&params)
+	if err != nil {
+		t.Errorf("Expected Invoice Item, got Error %s", err.Error())
+		return
+	}
+	if item.Amount.Amount != 1000 || item.UnitAmount.Amount != 250 || item.Quantity != 4 {
+		t.Errorf("Expected 4 × 250 = 1000, got %d × %d = %d", item.Quantity, item.UnitAmount.Amount, item.Amount.Amount)
+	}
+	if item.Amount.Currency != INR || item.UnitAmount.Currency != INR {
+		t.Errorf("Expected amounts in %s, got %v and %v", INR, item.Amount, item.UnitAmount)
+	}
+	if item.Period == nil || *item.Period != *params.Period {
+		t.Errorf("Expected Period %v, got %v", params.Period, item.Period)
+	}
+	if !item.Discountable || item.Metadata["meter"] != "api_calls" || item.Desc != "overage" {
+		t.Errorf("Expected discountable item with metadata, got %+v", item)
+	}
+
+	if _, err := InvoiceItems.Create(&InvoiceItemParams{Customer: cust.ID, Amount: Money{Amount: 100, Currency: INR}, Quantity: 2}); err == nil {
+		t.Error("Expected Error creating an Invoice Item with an amount and a quantity")
+	}
+}
+
+// TestUpdateInvoiceItem will test that the amount, quantity and other details
+// of an invoice item can be updated.
+func TestUpdateInvoiceItem(t *testing.T) {
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+	item, _ := InvoiceItems.Create(&InvoiceItemParams{Customer: cust.ID, Amount: Money{Amount: 500, Currency: INR}})
+
+	item, err := InvoiceItems.Update(item.ID, &InvoiceItemParams{Amount: Money{Amount: 800, Currency: INR}, Desc: "setup fee"})
+	if err != nil {
+		t.Errorf("Expected Invoice Item, got Error %s", err.Error())
+		return
+	}
+	if item.Amount.Amount != 800 || item.Desc != "setup fee" {
+		t.Errorf("Expected setup fee of 800, got %s of %d", item.Desc, item.Amount.Amount)
+	}
+
+	discountable := false
+	item, _ = InvoiceItems.Update(item.ID, &InvoiceItemParams{
+		UnitAmount:   Money{Amount: 300, Currency: INR},
+		Quantity:     3,
+		Discountable: &discountable,
+		Metadata:     map[string]string{"seats": "3"},
+	})
+	if item.Amount.Amount != 900 || item.Quantity != 3 || item.Discountable || item.Metadata["seats"] != "3" {
+		t.Errorf("Expected 3 undiscountable units of 300, got %+v", item)
+	}
+
+	Invoices.Create(cust.ID, nil)
+	if _, err := InvoiceItems.Update(item.ID, &InvoiceItemParams{Quantity: 1}); err == nil {
+		t.Error("Expected Error updating an invoiced Invoice Item")
+	}
+}
+
+// TestInvoiceItemDiscountable will test that the customer's discount only
+// applies to discountable invoice items, and that an invoice item can be
+// added to a subscription.
+func TestInvoiceItemDiscountable(t *testing.T) {
+	Plans.Create(&p1)
+	defer Plans.Delete(p1.ID)
+	Coupons.Create(&c1)
+	defer Coupons.Delete(c1.ID)
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+	sub, _ := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: p1.ID})
+	Customers.Update(cust.ID, &CustomerParams{Coupon: c1.ID})
+
+	discountable := false
+	InvoiceItems.Create(&InvoiceItemParams{Customer: cust.ID, Amount: Money{Amount: 1000, Currency: INR}})
+	item, err := InvoiceItems.Create(&InvoiceItemParams{
+		Customer:     cust.ID,
+		Amount:       Money{Amount: 1000, Currency: INR},
+		Subscription: sub.ID,
+		Discountable: &discountable,
+	})
+	if err != nil {
+		t.Errorf("Expected Invoice Item, got Error %s", err.Error())
+		return
+	}
+	if string(item.Subscription) != sub.ID {
+		t.Errorf("Expected Invoice Item for Subscription %s, got %s", sub.ID, item.Subscription)
+	}
+
+	invoice, _ := Invoices.RetrieveCustomer(cust.ID)
+	want := int64(1+1000) - int64(1+1000)*5/100 + 1000
+	if invoice.Total.Amount != want {
+		t.Errorf("Expected Total %d, got %d", want, invoice.Total.Amount)
+	}
+	if _, err := InvoiceItems.Create(&InvoiceItemParams{Customer: cust.ID, Amount: Money{Amount: 1000, Currency: INR}, Subscription: "sub_missing"}); err == nil {
+		t.Error("Expected Error adding an Invoice Item to a missing Subscription")
+	}
+}
@@ -0,0 +1,294 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+)
+
+// Sample Plans to preview upgrades between.
+var (
+	pBasic = PlanParams{
+		ID:       "plan_basic",
+		Name:     "Basic",
+		Amount:   Money{Amount: 1000, Currency: INR},
+		Interval: IntervalMonth,
+	}
+	pPro = PlanParams{
+		ID:       "plan_pro",
+		Name:     "Pro",
+		Amount:   Money{Amount: 3000, Currency: INR},
+		Interval: IntervalMonth,
+	}
+)
+
+// TestUpcomingInvoice will test that the upcoming invoice can be previewed for
+// a proposed plan or quantity change, with prorations at the given date, and
+// that the subscription itself is not changed.
+func TestUpcomingInvoice(t *testing.T) {
+	Plans.Create(&pBasic)
+	defer Plans.Delete(pBasic.ID)
+	Plans.Create(&pPro)
+	defer Plans.Delete(pPro.ID)
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+
+	sub, err := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: pBasic.ID})
+	if err != nil {
+		t.Errorf("Expected Subscription, got Error %s", err.Error())
+		return
+	}
+	halfway := int64(sub.CurrentPeriodStart) + int64(sub.CurrentPeriodEnd-sub.CurrentPeriodStart)/2
+
+	noProration := false
+	tests := []struct {
+		name       string
+		params     InvoiceUpcomingParams
+		prorations []int64
+		subtotal   int64
+	}{
+		{"upgrade", InvoiceUpcomingParams{Plan: pPro.ID}, []int64{-500, 1500}, 3000 + 1000},
+		{"quantity", InvoiceUpcomingParams{Quantity: 3}, []int64{-500, 1500}, 3000 + 1000},
+		{"unprorated", InvoiceUpcomingParams{Plan: pPro.ID, Prorate: &noProration}, nil, 3000},
+		{"unchanged", InvoiceUpcomingParams{}, nil, 1000},
+	}
+	for _, test := range tests {
+		params := test.params
+		params.Customer = cust.ID
+		params.Subscription = sub.ID
+		params.ProrationDate = halfway
+		invoice, err := Invoices.Upcoming(&params)
+		if err != nil {
+			t.Errorf("Expected %s preview, got Error %s", test.name, err.Error())
+			continue
+		}
+		if len(invoice.Lines.Prorations) != len(test.prorations) {
+			t.Errorf("Expected %d prorations for %s, got %d", len(test.prorations), test.name, len(invoice.Lines.Prorations))
+			continue
+		}
+		for i, item := range invoice.Lines.Prorations {
+			if item.Amount.Amount != test.prorations[i] || !item.Proration {
+				t.Errorf("Expected %s proration %d of %d, got %v", test.name, i, test.prorations[i], item.Amount)
+			}
+		}
+		if invoice.Subtotal.Amount != test.subtotal {
+			t.Errorf("Expected %s Subtotal %d, got %d", test.name, test.subtotal, invoice.Subtotal.Amount)
+		}
+		if string(invoice.Subscription) != sub.ID {
+			t.Errorf("Expected %s preview of Subscription %s, got %s", test.name, sub.ID, invoice.Subscription)
+		}
+	}
+
+	// previewing does not change the subscription
+	sub, _ = Subscriptions.Retrieve(sub.ID)
+	if sub.Plan.ID != pBasic.ID || sub.Quantity != 1 {
+		t.Errorf("Expected unchanged Subscription to %s, got %d of %s", pBasic.ID, sub.Quantity, sub.Plan.ID)
+	}
+}
+
+// TestUpcomingInvoiceNewSubscription will test that the upcoming invoice can
+// be previewed for a new subscription, with a coupon and a trial.
+func TestUpcomingInvoiceNewSubscription(t *testing.T) {
+	Plans.Create(&pPro)
+	defer Plans.Delete(pPro.ID)
+	Coupons.Create(&c1)
+	defer Coupons.Delete(c1.ID)
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+
+	params := InvoiceUpcomingParams{Customer: cust.ID}
+	params.Plan = pPro.ID
+	params.Coupon = c1.ID
+	invoice, err := Invoices.Upcoming(&params)
+	if err != nil {
+		t.Errorf("Expected preview, got Error %s", err.Error())
+		return
+	}
+	if len(invoice.Lines.Subscriptions) != 1 || invoice.Lines.Subscriptions[0].Plan.ID != pPro.ID {
+		t.Errorf("Expected one line for Plan %s, got %d lines", pPro.ID, len(invoice.Lines.Subscriptions))
+	}
+	if lines := invoice.Lines.Data; len(lines) != 1 || lines[0].Type != InvoiceLineSubscription || lines[0].Desc != "1 × Pro" {
+		t.Errorf("Expected a subscription line for 1 × Pro, got %d lines", len(lines))
+	}
+	if invoice.Total.Amount != 3000-150 {
+		t.Errorf("Expected discounted Total %d, got %d", 3000-150, invoice.Total.Amount)
+	}
+
+	params.TrialEnd = invoice.PeriodEnd
+	trial, err := Invoices.Upcoming(&params)
+	if err != nil {
+		t.Errorf("Expected preview with trial, got Error %s", err.Error())
+		return
+	}
+	if trial.PeriodStart != params.TrialEnd {
+		t.Errorf("Expected billing to start at the end of the trial %d, got %d", params.TrialEnd, trial.PeriodStart)
+	}
+
+	// previewing does not subscribe the customer, or redeem the coupon
+	if subs, _ := Subscriptions.CustomerList(cust.ID); len(subs) != 0 {
+		t.Errorf("Expected no Subscriptions, got %d", len(subs))
+	}
+	if coupon, _ := Coupons.Retrieve(c1.ID); coupon.TimesRedeemed != 0 {
+		t.Errorf("Expected Coupon not to be redeemed, got %d redemptions", coupon.TimesRedeemed)
+	}
+}
+
+// TestInvoiceLifecycle will test that pending invoice items can be invoiced,
+// and that the draft invoice is finalized and charged to the customer when
+// paid.
+func TestInvoiceLifecycle(t *testing.T) {
+	cust, _ := Customers.Create(&cust4)
+	defer Customers.Delete(cust.ID)
+	if _, err := Invoices.Create(cust.ID, &InvoiceParams{}); err == nil {
+		t.Error("Expected Error creating an Invoice without pending items")
+	}
+	InvoiceItems.Create(&InvoiceItemParams{Customer: cust.ID, Amount: Money{Amount: 1500, Currency: INR}, Desc: "setup fee"})
+
+	params := InvoiceParams{Desc: "setup", Metadata: map[string]string{"order": "42"}}
+	invoice, err := Invoices.Create(cust.ID, &params)
+	if err != nil {
+		t.Errorf("Expected Invoice, got Error %s", err.Error())
+		return
+	}
+	if invoice.Status != InvoiceDraft || invoice.Paid || invoice.Desc != "setup" || invoice.Metadata["order"] != "42" {
+		t.Errorf("Expected draft Invoice with description and metadata, got %+v", invoice)
+	}
+	if invoice.AmountDue.Amount != 1500 || len(invoice.Lines.InvoiceItems) != 1 {
+		t.Errorf("Expected Invoice for the pending item of 1500, got %d for %d items", invoice.AmountDue.Amount, len(invoice.Lines.InvoiceItems))
+	}
+	if _, err := Invoices.RetrieveCustomer(cust.ID); err == nil {
+		t.Error("Expected invoiced items not to be pending anymore")
+	}
+
+	invoice, err = Invoices.Pay(invoice.ID)
+	if err != nil {
+		t.Errorf("Expected paid Invoice, got Error %s", err.Error())
+		return
+	}
+	if invoice.Status != InvoicePaid || !invoice.Paid || !invoice.Closed || invoice.Charge == "" {
+		t.Errorf("Expected paid Invoice, got status %s, paid %v, charge %q", invoice.Status, invoice.Paid, invoice.Charge)
+	}
+	charge, _ := Charges.Retrieve(string(invoice.Charge))
+	if charge.Amount.Amount != 1500 || string(charge.Invoice) != invoice.ID {
+		t.Errorf("Expected Charge of 1500 for the Invoice, got %d for %s", charge.Amount.Amount, charge.Invoice)
+	}
+	if _, err := Invoices.Pay(invoice.ID); err == nil {
+		t.Error("Expected Error paying an Invoice twice")
+	}
+	if _, err := Invoices.Void(invoice.ID); err == nil {
+		t.Error("Expected Error voiding a paid Invoice")
+	}
+}
+
+// TestInvoiceStatuses will test that an invoice can be finalized, updated,
+// and then voided or marked as uncollectible.
+func TestInvoiceStatuses(t *testing.T) {
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+	create := func() *Invoice {
+		InvoiceItems.Create(&InvoiceItemParams{Customer: cust.ID, Amount: Money{Amount: 700, Currency: INR}})
+		invoice, _ := Invoices.Create(cust.ID, &InvoiceParams{})
+		return invoice
+	}
+
+	invoice := create()
+	if _, err := Invoices.Void(invoice.ID); err == nil {
+		t.Error("Expected Error voiding a draft Invoice")
+	}
+	invoice, err := Invoices.Finalize(invoice.ID)
+	if err != nil || invoice.Status != InvoiceOpen {
+		t.Errorf("Expected open Invoice, got %v", err)
+	}
+	if _, err := Invoices.Finalize(invoice.ID); err == nil {
+		t.Error("Expected Error finalizing an Invoice twice")
+	}
+
+	closed := true
+	invoice, err = Invoices.Update(invoice.ID, &InvoiceParams{Desc: "disputed", Closed: &closed})
+	if err != nil || !invoice.Closed || invoice.Desc != "disputed" || invoice.NextPayment != 0 {
+		t.Errorf("Expected closed Invoice, got %v", err)
+	}
+	invoice, err = Invoices.Void(invoice.ID)
+	if err != nil || invoice.Status != InvoiceVoid {
+		t.Errorf("Expected void Invoice, got %v", err)
+	}
+	if _, err := Invoices.Pay(invoice.ID); err == nil {
+		t.Error("Expected Error paying a void Invoice")
+	}
+
+	invoice = create()
+	if _, err := Invoices.MarkUncollectible(invoice.ID); err == nil {
+		t.Error("Expected Error marking a draft Invoice as uncollectible")
+	}
+	forgiven := true
+	invoice, err = Invoices.Update(invoice.ID, &InvoiceParams{Forgiven: &forgiven})
+	if err != nil || invoice.Status != InvoiceUncollectible || !invoice.Forgiven {
+		t.Errorf("Expected forgiven Invoice to be uncollectible, got %v", err)
+	}
+
+	invoice, _ = Invoices.Finalize(create().ID)
+	invoice, err = Invoices.MarkUncollectible(invoice.ID)
+	if err != nil || invoice.Status != InvoiceUncollectible {
+		t.Errorf("Expected uncollectible Invoice, got %v", err)
+	}
+	if invoice, _ = Invoices.Void(invoice.ID); invoice.Status != InvoiceVoid {
+		t.Errorf("Expected uncollectible Invoice to be voided, got %s", invoice.Status)
+	}
+
+	invoices, _ := Invoices.CustomerList(cust.ID)
+	if len(invoices) != 3 {
+		t.Errorf("Expected 3 Invoices, got %d", len(invoices))
+	}
+}
+
+// TestInvoiceLines will test that the first page of lines is embedded in the
+// invoice, and that LinesIter pages through all of them.
+func TestInvoiceLines(t *testing.T) {
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+	for i := int64(1); i <= 12; i++ {
+		InvoiceItems.Create(&InvoiceItemParams{Customer: cust.ID, Amount: Money{Amount: i * 100, Currency: INR}, Desc: "item"})
+	}
+	invoice, err := Invoices.Create(cust.ID, &InvoiceParams{})
+	if err != nil {
+		t.Errorf("Expected Invoice, got Error %s", err.Error())
+		return
+	}
+	if len(invoice.Lines.Data) != 10 || !invoice.Lines.HasMore || invoice.Lines.TotalCount != 12 {
+		t.Errorf("Expected the first 10 of 12 lines, got %d of %d", len(invoice.Lines.Data), invoice.Lines.TotalCount)
+	}
+
+	var total int64
+	var n int
+	for it := Invoices.LinesIter(invoice.ID, &ListParams{Limit: 5}); it.Next(); n++ {
+		line := it.Current()
+		if line.Type != InvoiceLineInvoiceItem || line.InvoiceItem == "" || line.Desc != "item" || line.Quantity != 1 || !line.Discountable {
+			t.Errorf("Expected invoice item line, got %+v", line)
+		}
+		if line.Amount.Currency != INR || line.Period == nil {
+			t.Errorf("Expected line in INR with a period, got %v", line.Amount)
+		}
+		total += line.Amount.Amount
+	}
+	if n != 12 || total != invoice.Subtotal.Amount {
+		t.Errorf("Expected 12 lines adding up to %d, got %d adding up to %d", invoice.Subtotal.Amount, n, total)
+	}
+}
@@ -0,0 +1,196 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// ListParams encapsulates options for paging through a list of objects using
+// cursors, rather than a count and offset.
+type ListParams struct {
+	// (Optional) The number of objects fetched per page, between 1 and 100.
+	Limit int
+
+	// (Optional) The ID of an object after which the list starts. Pages are
+	// then fetched forward, in the order returned by the API.
+	StartingAfter string
+
+	// (Optional) The ID of an object before which the list starts. Pages are
+	// then fetched backward, towards the most recently created objects. It
+	// cannot be combined with StartingAfter.
+	EndingBefore string
+}
+
+// RangeQuery encapsulates a filter on a range of integer values, such as the
+// created timestamp of an object. Bounds left as zero are not sent.
+type RangeQuery struct {
+	// (Optional) Return values greater than this value.
+	GT int64
+
+	// (Optional) Return values greater than or equal to this value.
+	GTE int64
+
+	// (Optional) Return values less than this value.
+	LT int64
+
+	// (Optional) Return values less than or equal to this value.
+	LTE int64
+}
+
+// ListMeta holds the paging details returned with every list of objects.
+type ListMeta struct {
+	Object     string `json:"object"`
+	URL        string `json:"url"`
+	HasMore    bool   `json:"has_more"`
+	TotalCount int    `json:"total_count"`
+}
+
+// pageQuery retrieves a single page of objects using the given url.Values.
+type pageQuery func(values url.Values) ([]interface{}, ListMeta, error)
+
+// Iter lazily pages through a list of objects. Next advances the iterator,
+// Current returns the object at the current position and Err returns the
+// error, if any, that stopped the iteration:
+//
+//	it := engine.Customers.Iter(nil)
+//	for it.Next() {
+//	    customer := it.Current()
+//	}
+//	if err := it.Err(); err != nil {
+//	    ...
+//	}
+type Iter struct {
+	query    pageQuery
+	values   url.Values
+	backward bool
+	fetched  bool
+	page     []interface{}
+	cur      interface{}
+	meta     ListMeta
+	err      error
+}
+
+func newIter(params *ListParams, values url.Values, query pageQuery) *Iter {
+	it := &Iter{query: query, values: values}
+	if params != nil {
+		if params.StartingAfter != "" && params.EndingBefore != "" {
+			it.fetched = true
+			it.err = errors.New("engine: starting_after and ending_before cannot both be set")
+			return it
+		}
+		appendListParamsToValues(params, &it.values)
+		it.backward = params.EndingBefore != ""
+	}
+	return it
+}
+
+// Next advances the iterator to the next object, fetching the next page when
+// the current one is exhausted. It returns false when the list is exhausted
+// or an error occurred.
+func (it *Iter) Next() bool {
+	if len(it.page) == 0 && it.err == nil && (!it.fetched || it.meta.HasMore) {
+		it.fetch()
+	}
+	if len(it.page) == 0 {
+		it.cur = nil
+		return false
+	}
+	it.cur = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// Current returns the object at the current position of the iterator.
+func (it *Iter) Current() interface{} {
+	return it.cur
+}
+
+// Err returns the error, if any, that stopped the iteration.
+func (it *Iter) Err() error {
+	return it.err
+}
+
+// Meta returns the paging details of the most recently fetched page.
+func (it *Iter) Meta() ListMeta {
+	return it.meta
+}
+
+func (it *Iter) fetch() {
+	it.fetched = true
+	it.page, it.meta, it.err = it.query(it.values)
+	if it.err != nil || len(it.page) == 0 {
+		it.page = nil
+		return
+	}
+
+	// when paging backward the API returns each page newest first, so we
+	// reverse it to keep walking away from the starting cursor
+	if it.backward {
+		for i, j := 0, len(it.page)-1; i < j; i, j = i+1, j-1 {
+			it.page[i], it.page[j] = it.page[j], it.page[i]
+		}
+		it.values.Set("ending_before", objectID(it.page[len(it.page)-1]))
+	} else {
+		it.values.Set("starting_after", objectID(it.page[len(it.page)-1]))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helper Function(s)
+
+func appendListParamsToValues(p *ListParams, values *url.Values) {
+	if p.Limit != 0 {
+		values.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.StartingAfter != "" {
+		values.Set("starting_after", p.StartingAfter)
+	}
+	if p.EndingBefore != "" {
+		values.Set("ending_before", p.EndingBefore)
+	}
+}
+
+// appendRangeQueryToValues encodes a RangeQuery in the nested form syntax the
+// API expects, i.e. created[gte]=1514764800.
+func appendRangeQueryToValues(name string, r *RangeQuery, values *url.Values) {
+	if r.GT != 0 {
+		values.Add(name+"[gt]", strconv.FormatInt(r.GT, 10))
+	}
+	if r.GTE != 0 {
+		values.Add(name+"[gte]", strconv.FormatInt(r.GTE, 10))
+	}
+	if r.LT != 0 {
+		values.Add(name+"[lt]", strconv.FormatInt(r.LT, 10))
+	}
+	if r.LTE != 0 {
+		values.Add(name+"[lte]", strconv.FormatInt(r.LTE, 10))
+	}
+}
+
+// objectID returns the ID field of a pointer to an API object, used as the
+// cursor for the next page.
+func objectID(v interface{}) string {
+	return reflect.Indirect(reflect.ValueOf(v)).FieldByName("ID").String()
+}
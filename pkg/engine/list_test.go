@@ -0,0 +1,211 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// newListServer returns a server listing the Customers cus_1 to cus_n, newest
+// first, honoring the limit, starting_after and ending_before parameters.
+func newListServer(n int, requests *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.RawQuery)
+		q := r.URL.Query()
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		if limit == 0 {
+			limit = 10
+		}
+
+		// customers are listed newest first, so cus_n is at index 0
+		all := make([]*Customer, n)
+		for i := range all {
+			all[i] = &Customer{ID: "cus_" + strconv.Itoa(n-i)}
+		}
+		index := func(id string) int {
+			for i, c := range all {
+				if c.ID == id {
+					return i
+				}
+			}
+			return -1
+		}
+
+		lo, hi, more := 0, len(all), false
+		if before := q.Get("ending_before"); before != "" {
+			hi = index(before)
+			if more = hi > limit; more {
+				lo = hi - limit
+			}
+		} else {
+			if after := q.Get("starting_after"); after != "" {
+				lo = index(after) + 1
+			}
+			if more = hi-lo > limit; more {
+				hi = lo + limit
+			}
+		}
+		json.NewEncoder(w).Encode(listCustomerResp{
+			ListMeta: ListMeta{Object: "list", HasMore: more, TotalCount: n},
+			Data:     all[lo:hi],
+		})
+	}))
+}
+
+// TestIter will test that an iterator walks every page forward using the
+// starting_after cursor, stopping when has_more is false.
+func TestIter(t *testing.T) {
+	var requests []string
+	server := newListServer(5, &requests)
+	defer server.Close()
+
+	client := New("sk_test", WithURL(server.URL))
+	it := client.Customers.Iter(&ListParams{Limit: 2})
+	var got []string
+	for it.Next() {
+		got = append(got, it.Current().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Expected Customer Iter, got Error %s", err.Error())
+	}
+
+	want := []string{"cus_5", "cus_4", "cus_3", "cus_2", "cus_1"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected Customers %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected Customers %v, got %v", want, got)
+			break
+		}
+	}
+	if len(requests) != 3 {
+		t.Errorf("Expected 3 pages, got %d: %v", len(requests), requests)
+	}
+	if it.Meta().TotalCount != 5 {
+		t.Errorf("Expected total count 5, got %d", it.Meta().TotalCount)
+	}
+}
+
+// TestIterBackward will test that an iterator started with ending_before walks
+// towards the most recently created objects.
+func TestIterBackward(t *testing.T) {
+	var requests []string
+	server := newListServer(5, &requests)
+	defer server.Close()
+
+	client := New("sk_test", WithURL(server.URL))
+	it := client.Customers.Iter(&ListParams{Limit: 2, EndingBefore: "cus_1"})
+	var got []string
+	for it.Next() {
+		got = append(got, it.Current().ID)
+	}
+
+	want := []string{"cus_2", "cus_3", "cus_4", "cus_5"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected Customers %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected Customers %v, got %v", want, got)
+			break
+		}
+	}
+}
+
+// TestIterBothCursors will test that an iterator given both starting_after and
+// ending_before stops with an error, without calling the API.
+func TestIterBothCursors(t *testing.T) {
+	var requests []string
+	server := newListServer(5, &requests)
+	defer server.Close()
+
+	client := New("sk_test", WithURL(server.URL))
+	it := client.Customers.Iter(&ListParams{StartingAfter: "cus_4", EndingBefore: "cus_1"})
+	if it.Next() {
+		t.Errorf("Expected no Customers, got %v", it.Current())
+	}
+	if it.Err() == nil {
+		t.Errorf("Expected an error for both cursors, got nil")
+	}
+	if len(requests) != 0 {
+		t.Errorf("Expected no requests, got %v", requests)
+	}
+}
+
+// TestIterError will test that an API error stops the iteration and is
+// returned by Err.
+func TestIterError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"Invalid API Key"}}`))
+	}))
+	defer server.Close()
+
+	client := New("sk_test", WithURL(server.URL))
+	it := client.Charges.Iter(nil)
+	if it.Next() {
+		t.Errorf("Expected no Charges, got %v", it.Current())
+	}
+	if _, ok := it.Err().(*Error); !ok {
+		t.Errorf("Expected *Error, got %v", it.Err())
+	}
+}
+
+// TestListFilters will test that list filters are encoded in the nested form
+// syntax, both for ListFiltered and for Iter.
+func TestListFilters(t *testing.T) {
+	var requests []string
+	server := newListServer(0, &requests)
+	defer server.Close()
+
+	paid, refunded := true, false
+	client := New("sk_test", WithURL(server.URL))
+	client.Charges.ListFiltered(&ChargeListParams{
+		Customer: "cus_1",
+		Created:  &RangeQuery{GTE: 1514764800, LTE: 1517443199},
+		Paid:     &paid,
+		Refunded: &refunded,
+		Currency: INR,
+	}, 20, 40)
+	client.Invoices.Iter(&InvoiceListParams{
+		ListParams:   ListParams{Limit: 5},
+		Subscription: "sub_1",
+		Plan:         "plan1",
+	}).Next()
+
+	want := []string{
+		"count=20&created%5Bgte%5D=1514764800&created%5Blte%5D=1517443199&currency=inr&customer=cus_1&offset=40&paid=true&refunded=false",
+		"limit=5&plan=plan1&subscription=sub_1",
+	}
+	if len(requests) != len(want) {
+		t.Fatalf("Expected %d requests, got %d", len(want), len(requests))
+	}
+	for i := range want {
+		if requests[i] != want[i] {
+			t.Errorf("Expected query %s, got %s", want[i], requests[i])
+		}
+	}
+}
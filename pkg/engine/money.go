@@ -0,0 +1,178 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// zeroDecimalCurrencies are the currencies that have no minor unit, so that
+// their amounts are given in whole units, e.g. 500 JPY is ¥500, not ¥5.
+var zeroDecimalCurrencies = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, JPY: true, "kmf": true,
+	"krw": true, "mga": true, "pyg": true, "rwf": true, "ugx": true, "vnd": true,
+	"vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+// ZeroDecimal reports whether the currency has no minor unit, such as JPY.
+func ZeroDecimal(currency string) bool {
+	return zeroDecimalCurrencies[strings.ToLower(currency)]
+}
+
+// Money is an amount of money in a currency. The Amount is given in the
+// smallest unit of the currency, e.g. paisa for INR or cents for USD, or in
+// whole units for zero-decimal currencies such as JPY.
+//
+// In JSON, Money is encoded as its Amount only, because the API sends the
+// currency in a separate field. Resources that include Money fill in the
+// Currency from that field when they are decoded.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// ParseMoney parses a decimal amount such as "12.34" in the given currency,
+// without any loss of precision. It returns an error if the amount has more
+// decimal places than the currency's minor unit allows.
+func ParseMoney(amount, currency string) (Money, error) {
+	s := strings.TrimSpace(amount)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	digits := minorDigits(currency)
+	if len(frac) > digits {
+		return Money{}, errors.New("engine: too many decimal places in amount " + strconv.Quote(amount) + " for currency " + currency)
+	}
+	if whole == "" && frac == "" {
+		return Money{}, errors.New("engine: invalid amount " + strconv.Quote(amount))
+	}
+	frac += strings.Repeat("0", digits-len(frac))
+
+	n, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil || strings.ContainsAny(whole+frac, "+-") {
+		return Money{}, errors.New("engine: invalid amount " + strconv.Quote(amount))
+	}
+	if negative {
+		n = -n
+	}
+	return Money{Amount: n, Currency: strings.ToLower(currency)}, nil
+}
+
+// Decimal formats the amount in major units, e.g. "12.34" for 1234 paisa, or
+// "500" for 500 JPY.
+func (m Money) Decimal() string {
+	digits := minorDigits(m.Currency)
+	if digits == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	s := strconv.FormatInt(m.Amount, 10)
+	sign := ""
+	if m.Amount < 0 {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+// String formats the amount in major units, followed by the upper case
+// currency code, e.g. "12.34 INR".
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Decimal()
+	}
+	return m.Decimal() + " " + strings.ToUpper(m.Currency)
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Add returns the sum of m and o, which must be in the same currency. A Money
+// without a Currency, such as the zero value, takes the currency of the
+// other. Add returns an error if the currencies differ.
+func (m Money) Add(o Money) (Money, error) {
+	currency := m.Currency
+	switch {
+	case currency == "":
+		currency = o.Currency
+	case o.Currency != "" && !strings.EqualFold(currency, o.Currency):
+		return Money{}, errors.New("engine: cannot add " + o.String() + " to " + m.String())
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: currency}, nil
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatInt(m.Amount, 10)), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	str := string(data)
+	if str == "null" {
+		return nil
+	}
+
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		// tolerate integral amounts sent as floats, e.g. 2000.0
+		var f float64
+		if json.Unmarshal(data, &f) != nil || f != math.Trunc(f) {
+			return err
+		}
+		n = int64(f)
+	}
+
+	m.Amount = n
+	return nil
+}
+
+// encode formats the amount for a request parameter.
+func (m Money) encode() string {
+	return strconv.FormatInt(m.Amount, 10)
+}
+
+// minorDigits returns the number of decimal places of the currency's minor
+// unit.
+func minorDigits(currency string) int {
+	if ZeroDecimal(currency) {
+		return 0
+	}
+	return 2
+}
+
+// setCurrency sets the Currency of amounts decoded from a JSON object, which
+// carries the currency in a separate field.
+func setCurrency(currency string, amounts ...*Money) {
+	for _, m := range amounts {
+		m.Currency = currency
+	}
+}
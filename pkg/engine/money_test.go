@@ -0,0 +1,120 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestParseMoney will test that decimal amounts are parsed into minor units
+// without any loss of precision, and formatted back the same way.
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		amount, currency string
+		want             Money
+		decimal          string
+	}{
+		{"12.34", INR, Money{Amount: 1234, Currency: INR}, "12.34"},
+		{"0.29", USD, Money{Amount: 29, Currency: USD}, "0.29"},
+		{"20", EUR, Money{Amount: 2000, Currency: EUR}, "20.00"},
+		{"1.5", GBP, Money{Amount: 150, Currency: GBP}, "1.50"},
+		{"-0.05", INR, Money{Amount: -5, Currency: INR}, "-0.05"},
+		{"500", "JPY", Money{Amount: 500, Currency: JPY}, "500"},
+		{".99", USD, Money{Amount: 99, Currency: USD}, "0.99"},
+	}
+	for _, test := range tests {
+		m, err := ParseMoney(test.amount, test.currency)
+		if err != nil {
+			t.Errorf("Expected %s %s to parse, got Error %s", test.amount, test.currency, err.Error())
+			continue
+		}
+		if m != test.want {
+			t.Errorf("Expected %s %s to parse as %#v, got %#v", test.amount, test.currency, test.want, m)
+		}
+		if m.Decimal() != test.decimal {
+			t.Errorf("Expected %#v to format as %s, got %s", m, test.decimal, m.Decimal())
+		}
+	}
+
+	for _, amount := range []string{"", ".", "1.234", "1,00", "1.-5", "--1", "abc"} {
+		if _, err := ParseMoney(amount, INR); err == nil {
+			t.Errorf("Expected non-null Error when parsing %q", amount)
+		}
+	}
+	if _, err := ParseMoney("5.5", JPY); err == nil {
+		t.Error("Expected non-null Error when parsing a fractional JPY amount")
+	}
+}
+
+// TestMoneyString will test that Money formats with the currency code.
+func TestMoneyString(t *testing.T) {
+	if s := (Money{Amount: 199900, Currency: INR}).String(); s != "1999.00 INR" {
+		t.Errorf("Expected 1999.00 INR, got %s", s)
+	}
+	if s := (Money{Amount: 1200, Currency: JPY}).String(); s != "1200 JPY" {
+		t.Errorf("Expected 1200 JPY, got %s", s)
+	}
+}
+
+// TestMoneyJSON will test that Money is decoded from integer amounts, and
+// that resources fill in the currency from their own currency field.
+func TestMoneyJSON(t *testing.T) {
+	var charge Charge
+	data := `{"amount": 2000, "amount_refunded": 0, "fee": 88.0, "currency": "jpy",
+		"fee_details": [{"amount": 88, "currency": "jpy", "type": "bhojpur_fee"}]}`
+	if err := json.Unmarshal([]byte(data), &charge); err != nil {
+		t.Fatalf("Expected Charge, got Error %s", err.Error())
+	}
+	if want := (Money{Amount: 2000, Currency: JPY}); charge.Amount != want {
+		t.Errorf("Expected Amount %v, got %v", want, charge.Amount)
+	}
+	if want := (Money{Amount: 88, Currency: JPY}); charge.Fee != want || charge.Details[0].Amount != want {
+		t.Errorf("Expected Fee %v, got %v and %v", want, charge.Fee, charge.Details[0].Amount)
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount": 2E+03}`), &charge); err != nil || charge.Amount.Amount != 2000 {
+		t.Errorf("Expected Amount 2000, got %v (%v)", charge.Amount, err)
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 20.5}`), &charge); err == nil {
+		t.Error("Expected non-null Error when decoding a fractional amount")
+	}
+
+	out, _ := json.Marshal(Money{Amount: 1234, Currency: INR})
+	if string(out) != "1234" {
+		t.Errorf("Expected Money to encode as 1234, got %s", out)
+	}
+}
+
+// TestMoneyAdd will test that amounts in the same currency are added, and
+// that adding amounts in different currencies is an error.
+func TestMoneyAdd(t *testing.T) {
+	sum, err := Money{Amount: 1000, Currency: INR}.Add(Money{Amount: 250, Currency: INR})
+	if want := (Money{Amount: 1250, Currency: INR}); err != nil || sum != want {
+		t.Errorf("Expected %v, got %v (%v)", want, sum, err)
+	}
+	if sum, err = (Money{}).Add(sum); err != nil || sum.Currency != INR || sum.Amount != 1250 {
+		t.Errorf("Expected 12.50 INR, got %v (%v)", sum, err)
+	}
+	if _, err := sum.Add(Money{Amount: 100, Currency: USD}); err == nil {
+		t.Error("Expected Error adding USD to INR")
+	}
+}
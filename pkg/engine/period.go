@@ -0,0 +1,144 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"time"
+)
+
+// intervalMonths is the length in months of each calendar-based plan
+// interval. The other intervals have a fixed length, in intervalDays or
+// intervalDurations.
+var intervalMonths = map[string]int{
+	IntervalMonth:   1,
+	IntervalQuarter: 3,
+	IntervalYear:    12,
+	IntervalDecade:  120,
+	IntervalCentury: 1200,
+}
+
+var intervalDays = map[string]int{
+	IntervalDay:  1,
+	IntervalWeek: 7,
+}
+
+var intervalDurations = map[string]time.Duration{
+	IntervalSecond: time.Second,
+	IntervalMinute: time.Minute,
+	IntervalHour:   time.Hour,
+}
+
+// NextPeriod returns the end of the billing period of the plan that starts
+// at anchor, which is also the start of the next period. It returns the zero
+// Time if the plan's interval is unknown.
+//
+// Calendar arithmetic is done in the location of anchor, so that a daily plan
+// keeps its wall clock time across daylight saving changes. The API works in
+// UTC, so pass a UTC anchor to match Subscription.CurrentPeriodEnd.
+func NextPeriod(anchor time.Time, plan *Plan) time.Time {
+	return addIntervals(anchor, plan, 1)
+}
+
+// Periods returns an iterator over the consecutive billing periods of the
+// plan, starting at anchor. Every period is calculated from anchor, rather
+// than from the end of the previous period, so that a monthly plan anchored
+// on 31 January renews on 28 (or 29) February and then on 31 March.
+func Periods(anchor time.Time, plan *Plan) *PeriodIter {
+	return &PeriodIter{anchor: anchor, plan: plan}
+}
+
+// PeriodIter is an iterator over the billing periods of a plan.
+type PeriodIter struct {
+	anchor     time.Time
+	plan       *Plan
+	n          int
+	start, end time.Time
+}
+
+// Next advances the iterator to the next billing period. It returns false if
+// the plan's interval is unknown; otherwise the periods never run out.
+func (it *PeriodIter) Next() bool {
+	end := addIntervals(it.anchor, it.plan, it.n+1)
+	if end.IsZero() {
+		return false
+	}
+	it.start = addIntervals(it.anchor, it.plan, it.n)
+	it.end = end
+	it.n++
+	return true
+}
+
+// Start returns the start of the current billing period.
+func (it *PeriodIter) Start() time.Time {
+	return it.start
+}
+
+// End returns the end of the current billing period, which is also the start
+// of the next one.
+func (it *PeriodIter) End() time.Time {
+	return it.end
+}
+
+// Period returns the current billing period as UTC timestamps, as they are
+// used by the API.
+func (it *PeriodIter) Period() *Period {
+	return &Period{Start: it.start.Unix(), End: it.end.Unix()}
+}
+
+// addIntervals returns the time n intervals of the plan after anchor, or the
+// zero Time if the plan's interval is unknown.
+func addIntervals(anchor time.Time, plan *Plan, n int) time.Time {
+	count := plan.IntervalCount
+	if count < 1 {
+		count = 1
+	}
+	n *= count
+
+	if months, ok := intervalMonths[plan.Interval]; ok {
+		return addMonths(anchor, months*n)
+	}
+	if days, ok := intervalDays[plan.Interval]; ok {
+		return anchor.AddDate(0, 0, days*n)
+	}
+	if d, ok := intervalDurations[plan.Interval]; ok {
+		return anchor.Add(d * time.Duration(n))
+	}
+	return time.Time{}
+}
+
+// addMonths adds months to t, clamping the day to the end of shorter months
+// instead of overflowing into the next month as time.AddDate does.
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+
+	// the first day of the target month, so that it does not overflow
+	first := time.Date(year, month+time.Month(months), 1, hour, min, sec, t.Nanosecond(), t.Location())
+	if last := daysIn(first.Year(), first.Month()); day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, hour, min, sec, t.Nanosecond(), t.Location())
+}
+
+// daysIn returns the number of days in the month of the year.
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,150 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+	"time"
+)
+
+// TestNextPeriod will test that period ends are clamped to the end of shorter
+// months, account for leap years, and are calculated in the anchor's
+// location.
+func TestNextPeriod(t *testing.T) {
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	date := func(year int, month time.Month, day, hour int, loc *time.Location) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		interval string
+		count    int
+		anchor   time.Time
+		want     time.Time
+	}{
+		{IntervalMonth, 1, date(2021, time.January, 31, 0, time.UTC), date(2021, time.February, 28, 0, time.UTC)},
+		{IntervalMonth, 1, date(2024, time.January, 31, 0, time.UTC), date(2024, time.February, 29, 0, time.UTC)},
+		{IntervalMonth, 1, date(2021, time.December, 15, 9, time.UTC), date(2022, time.January, 15, 9, time.UTC)},
+		{IntervalMonth, 6, date(2021, time.August, 31, 0, time.UTC), date(2022, time.February, 28, 0, time.UTC)},
+		{IntervalQuarter, 1, date(2023, time.November, 30, 0, time.UTC), date(2024, time.February, 29, 0, time.UTC)},
+		{IntervalYear, 1, date(2024, time.February, 29, 0, time.UTC), date(2025, time.February, 28, 0, time.UTC)},
+		{IntervalYear, 4, date(2024, time.February, 29, 0, time.UTC), date(2028, time.February, 29, 0, time.UTC)},
+		{IntervalDecade, 1, date(2020, time.February, 29, 0, time.UTC), date(2030, time.February, 28, 0, time.UTC)},
+		{IntervalCentury, 1, date(2000, time.March, 1, 0, time.UTC), date(2100, time.March, 1, 0, time.UTC)},
+		{IntervalWeek, 2, date(2021, time.December, 25, 0, time.UTC), date(2022, time.January, 8, 0, time.UTC)},
+		{IntervalDay, 0, date(2021, time.February, 28, 0, time.UTC), date(2021, time.March, 1, 0, time.UTC)},
+		{IntervalHour, 36, date(2021, time.February, 28, 0, time.UTC), date(2021, time.March, 1, 12, time.UTC)},
+		{IntervalMinute, 90, date(2021, time.February, 28, 0, time.UTC), date(2021, time.February, 28, 1, time.UTC).Add(30 * time.Minute)},
+		{IntervalSecond, 1, date(2021, time.February, 28, 0, time.UTC), date(2021, time.February, 28, 0, time.UTC).Add(time.Second)},
+
+		// 31 January 23:00 IST is still in January locally, but not in UTC
+		{IntervalMonth, 1, date(2021, time.January, 31, 23, ist), date(2021, time.February, 28, 23, ist)},
+	}
+	for _, test := range tests {
+		plan := &Plan{Interval: test.interval, IntervalCount: test.count}
+		if got := NextPeriod(test.anchor, plan); !got.Equal(test.want) {
+			t.Errorf("Expected %d %s after %v to be %v, got %v", test.count, test.interval, test.anchor, test.want, got)
+		}
+	}
+
+	if got := NextPeriod(time.Now(), &Plan{Interval: "fortnight"}); !got.IsZero() {
+		t.Errorf("Expected zero Time for an unknown interval, got %v", got)
+	}
+}
+
+// TestNextPeriodDaylightSaving will test that daily periods keep their wall
+// clock time across daylight saving changes.
+func TestNextPeriodDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("Time zone database unavailable: %s", err)
+	}
+	anchor := time.Date(2021, time.March, 13, 9, 0, 0, 0, loc)
+	got := NextPeriod(anchor, &Plan{Interval: IntervalDay})
+	if want := time.Date(2021, time.March, 14, 9, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got.Sub(anchor) != 23*time.Hour {
+		t.Errorf("Expected a 23 hour day, got %v", got.Sub(anchor))
+	}
+}
+
+// TestPeriods will test that every period is calculated from the anchor, so
+// that month-end clamping does not carry over into later periods.
+func TestPeriods(t *testing.T) {
+	anchor := time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)
+	it := Periods(anchor, &Plan{Interval: IntervalMonth})
+
+	want := []time.Time{
+		time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, time.March, 31, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, time.April, 30, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, time.May, 31, 0, 0, 0, 0, time.UTC),
+	}
+	start := anchor
+	for i, end := range want {
+		if !it.Next() {
+			t.Fatalf("Expected period %d, got none", i)
+		}
+		if !it.Start().Equal(start) || !it.End().Equal(end) {
+			t.Errorf("Expected period %d from %v to %v, got %v to %v", i, start, end, it.Start(), it.End())
+		}
+		if p := it.Period(); p.Start != start.Unix() || p.End != end.Unix() {
+			t.Errorf("Expected period %d from %d to %d, got %d to %d", i, start.Unix(), end.Unix(), p.Start, p.End)
+		}
+		start = end
+	}
+
+	if Periods(anchor, &Plan{Interval: "fortnight"}).Next() {
+		t.Error("Expected no periods for an unknown interval")
+	}
+}
+
+// TestNextPeriodSubscription will test that NextPeriod agrees with the
+// CurrentPeriodEnd of a Subscription.
+func TestNextPeriodSubscription(t *testing.T) {
+	params := p1
+	params.ID = "plan_quarterly"
+	params.Interval = IntervalMonth
+	params.IntervalCount = 3
+	plan, err := Plans.Create(&params)
+	if err != nil {
+		t.Errorf("Expected Plan %s, got Error %s", params.ID, err.Error())
+		return
+	}
+	defer Plans.Delete(params.ID)
+	if plan.IntervalCount != 3 {
+		t.Errorf("Expected Interval Count %d, got %d", 3, plan.IntervalCount)
+	}
+
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+	sub, err := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: params.ID})
+	if err != nil {
+		t.Errorf("Expected Subscription, got Error %s", err.Error())
+		return
+	}
+
+	anchor := time.Unix(int64(sub.CurrentPeriodStart), 0).UTC()
+	if end := NextPeriod(anchor, plan); end.Unix() != int64(sub.CurrentPeriodEnd) {
+		t.Errorf("Expected period end %d, got %d", sub.CurrentPeriodEnd, end.Unix())
+	}
+}
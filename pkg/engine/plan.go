@@ -21,6 +21,8 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
+	"encoding/json"
 	"net/url"
 	"strconv"
 )
@@ -39,93 +41,297 @@ const (
 	IntervalCentury = "century"
 )
 
+// Plan Usage Types
+const (
+	// UsageLicensed plans bill the quantity of the subscription, in advance.
+	UsageLicensed = "licensed"
+
+	// UsageMetered plans bill the usage reported with usage records, in
+	// arrears.
+	UsageMetered = "metered"
+)
+
+// Plan Aggregate Usage modes, which decide how the usage records of a metered
+// plan are combined into the quantity billed for a period.
+const (
+	AggregateUsageSum              = "sum"
+	AggregateUsageLastDuringPeriod = "last_during_period"
+	AggregateUsageLastEver         = "last_ever"
+	AggregateUsageMax              = "max"
+)
+
+// Plan Billing Schemes
+const (
+	// BillingPerUnit plans charge the Amount for each unit of quantity.
+	BillingPerUnit = "per_unit"
+
+	// BillingTiered plans charge according to their Tiers and TiersMode.
+	BillingTiered = "tiered"
+)
+
+// Plan Tiers Modes
+const (
+	// TiersGraduated prices each unit of quantity according to the tier it
+	// falls in, so that the price of a quantity that spans several tiers is
+	// the sum of the price of each tier.
+	TiersGraduated = "graduated"
+
+	// TiersVolume prices every unit of quantity according to the one tier
+	// that the total quantity falls in.
+	TiersVolume = "volume"
+)
+
 // Plan holds details about pricing information for different products and
 // feature levels on your site. For example, you might have a INR 10/month plan
 // for basic features and a different INR 20/month plan for premium features.
 type Plan struct {
-	ID              string  `json:"id"`
-	Name            string  `json:"name"`
-	Amount          float64 `json:"amount"`
-	Interval        string  `json:"interval"`
-	IntervalCount   int     `json:"interval_count"`
-	Currency        string  `json:"currency"`
-	TrialPeriodDays Int     `json:"trial_period_days"`
-	Livemode        bool    `json:"livemode"`
+	ID              string            `json:"id"`
+	Name            string            `json:"name"`
+	Nickname        String            `json:"nickname"`
+	Product         String            `json:"product"`
+	Active          bool              `json:"active"`
+	Metadata        map[string]string `json:"metadata"`
+	Amount          Money             `json:"amount"`
+	Interval        string            `json:"interval"`
+	IntervalCount   int               `json:"interval_count"`
+	Currency        string            `json:"currency"`
+	TrialPeriodDays Int               `json:"trial_period_days"`
+	UsageType       string            `json:"usage_type"`
+	AggregateUsage  String            `json:"aggregate_usage"`
+	BillingScheme   string            `json:"billing_scheme"`
+	TiersMode       String            `json:"tiers_mode"`
+	Tiers           []*PlanTier       `json:"tiers"`
+	Livemode        bool              `json:"livemode"`
+}
+
+// PlanTier is one pricing tier of a tiered Plan. A tier applies to quantities
+// up to and including UpTo; the last tier has an UpTo of 0, meaning it has no
+// upper bound.
+type PlanTier struct {
+	UpTo       Int64 `json:"up_to"`
+	UnitAmount Money `json:"unit_amount"`
+	FlatAmount Money `json:"flat_amount"`
+}
+
+func (self *Plan) UnmarshalJSON(data []byte) error {
+	type plan Plan
+	if err := json.Unmarshal(data, (*plan)(self)); err != nil {
+		return err
+	}
+	setCurrency(self.Currency, &self.Amount)
+	for _, tier := range self.Tiers {
+		setCurrency(self.Currency, &tier.UnitAmount, &tier.FlatAmount)
+	}
+	return nil
+}
+
+// PriceFor returns the price of the given quantity of the Plan for one
+// billing period, e.g. of a Subscription's Quantity, without calling the API.
+// A quantity beyond the last tier of a tiered Plan, when that tier is bounded,
+// is priced at the last tier.
+func (self *Plan) PriceFor(quantity int64) Money {
+	price := Money{Currency: self.Currency}
+	if self.BillingScheme != BillingTiered {
+		price.Amount = self.Amount.Amount * quantity
+		return price
+	}
+
+	var below int64
+	for i, tier := range self.Tiers {
+		upTo := int64(tier.UpTo)
+		last := upTo == 0 || quantity <= upTo || i == len(self.Tiers)-1
+		switch {
+		case self.TiersMode == TiersVolume && last:
+			price.Amount = tier.UnitAmount.Amount*quantity + tier.FlatAmount.Amount
+		case self.TiersMode != TiersVolume && quantity > below:
+			units := quantity - below
+			if !last {
+				units = upTo - below
+			}
+			price.Amount += tier.UnitAmount.Amount*units + tier.FlatAmount.Amount
+		}
+		if last {
+			break
+		}
+		below = upTo
+	}
+	return price
+}
+
+// listPlanResp is the wrapper for a list of Plans, so that we can cleanly
+// parse the JSON.
+type listPlanResp struct {
+	ListMeta
+	Data []*Plan `json:"data"`
 }
 
 // PlanClient encapsulates operations for creating, updating, deleting and
 // querying plans using the Bhojpur Subscription REST API.
-type PlanClient struct{}
+type PlanClient struct {
+	client *Client
+}
 
-// PlanParams encapsulates options for creating a new Plan.
+// PlanParams encapsulates options for creating a new Plan. When updating a
+// Plan, only its Name, Nickname, Product, Active flag and Metadata can be
+// changed.
 type PlanParams struct {
 	// Unique string of your choice that will be used to identify this plan
 	// when subscribing a customer.
 	ID string
 
-	// A positive integer in paisa (or 0 for a free plan) representing how much
-	// to charge (on a recurring basis)
-	Amount float64
-
-	// 3-letter ISO code for currency. Currently, only 'inr' is supported.
-	Currency string
+	// A positive amount in the smallest currency unit (or 0 for a free plan)
+	// representing how much to charge (on a recurring basis), and the
+	// currency to charge it in.
+	Amount Money
 
-	// Specifies billing frequency. Either month or year.
+	// Specifies billing frequency, one of the Interval constants, e.g. month
+	// or year.
 	Interval string
 
+	// (Optional) The number of intervals between billings, e.g. an Interval
+	// of month and an IntervalCount of 6 bills every six months. Defaults to
+	// 1.
+	IntervalCount int
+
 	// Name of the plan, to be displayed on invoices and in the web interface.
 	Name string
 
+	// (Optional) A brief description of the plan, hidden from customers, such
+	// as "Pro annual".
+	Nickname string
+
+	// (Optional) The ID of the Product this plan is a price of.
+	Product string
+
+	// (Optional) Whether the plan can be used for new subscriptions. Plans are
+	// active when created, unless specified otherwise.
+	Active *bool
+
+	// (Optional) A set of key/value pairs that you can attach to the plan.
+	// When updating, a key with an empty value is removed.
+	Metadata map[string]string
+
 	// (Optional) Specifies a trial period in (an integer number of) days. If
 	// you include a trial period, the customer won't be billed for the first
 	// time until the trial period ends. If the customer cancels before the
 	// trial period is over, she'll never be billed at all.
 	TrialPeriodDays int
+
+	// (Optional) Either BillingPerUnit, the default, to charge the Amount for
+	// each unit, or BillingTiered to charge according to the Tiers. The
+	// Amount is not sent for tiered plans, but its Currency is.
+	BillingScheme string
+
+	// (Optional) Either TiersGraduated or TiersVolume. Required for tiered
+	// plans.
+	TiersMode string
+
+	// (Optional) The pricing tiers of a tiered plan, in increasing order of
+	// UpTo. The last tier must have an UpTo of 0.
+	Tiers []*PlanTier
+
+	// (Optional) Either UsageLicensed, the default, to bill the quantity of
+	// the subscription, or UsageMetered to bill the usage reported with
+	// UsageRecords.
+	UsageType string
+
+	// (Optional) How the usage records of a metered plan are combined for a
+	// period, one of the AggregateUsage modes. Defaults to AggregateUsageSum.
+	AggregateUsage string
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
 }
 
 // Creates a new Plan.
 func (self *PlanClient) Create(params *PlanParams) (*Plan, error) {
+	return self.CreateCtx(context.Background(), params)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *PlanClient) CreateCtx(ctx context.Context, params *PlanParams) (*Plan, error) {
 	plan := Plan{}
 	values := url.Values{
 		"id":       {params.ID},
 		"name":     {params.Name},
-		"amount":   {strconv.FormatFloat(params.Amount, 'E', -1, 64)},
 		"interval": {params.Interval},
-		"currency": {params.Currency},
+		"currency": {params.Amount.Currency},
+	}
+
+	// tiered plans are priced by their tiers, instead of the amount
+	if params.BillingScheme == BillingTiered {
+		values.Add("billing_scheme", params.BillingScheme)
+		values.Add("tiers_mode", params.TiersMode)
+		appendPlanTiersToValues(params.Tiers, &values)
+	} else {
+		values.Add("amount", params.Amount.encode())
+	}
+
+	// interval_count is optional, add if specified
+	if params.IntervalCount != 0 {
+		values.Add("interval_count", strconv.Itoa(params.IntervalCount))
 	}
 
 	// trial_period_days is optional, add if specified
 	if params.TrialPeriodDays != 0 {
 		values.Add("trial_period_days", strconv.Itoa(params.TrialPeriodDays))
 	}
+	if params.UsageType != "" {
+		values.Add("usage_type", params.UsageType)
+	}
+	if params.AggregateUsage != "" {
+		values.Add("aggregate_usage", params.AggregateUsage)
+	}
+	appendPlanParamsToValues(params, &values)
 
-	err := query("POST", "/v1/plans", values, &plan)
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/plans", params.IdempotencyKey, values, &plan)
 	return &plan, err
 }
 
 // Retrieves the plan with the given ID.
 func (self *PlanClient) Retrieve(id string) (*Plan, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *PlanClient) RetrieveCtx(ctx context.Context, id string) (*Plan, error) {
 	plan := Plan{}
 	path := "/v1/plans/" + url.QueryEscape(id)
-	err := query("GET", path, nil, &plan)
+	err := self.client.query(ctx, "GET", path, nil, &plan)
 	return &plan, err
 }
 
-// Updates the name of a plan. Other plan details (price, interval, etc) are,
-// by design, not editable.
-func (self *PlanClient) Update(id string, newName string) (*Plan, error) {
-	values := url.Values{"name": {newName}}
+// Updates the name, nickname, product, active flag or metadata of a plan.
+// Other plan details (price, interval, etc) are, by design, not editable.
+func (self *PlanClient) Update(id string, params *PlanParams) (*Plan, error) {
+	return self.UpdateCtx(context.Background(), id, params)
+}
+
+// UpdateCtx is like Update, but uses ctx for the API request.
+func (self *PlanClient) UpdateCtx(ctx context.Context, id string, params *PlanParams) (*Plan, error) {
+	values := url.Values{}
+	if params.Name != "" {
+		values.Add("name", params.Name)
+	}
+	appendPlanParamsToValues(params, &values)
+
 	plan := Plan{}
 	path := "/v1/plans/" + url.QueryEscape(id)
-	err := query("POST", path, values, &plan)
+	err := self.client.queryIdempotent(ctx, "POST", path, params.IdempotencyKey, values, &plan)
 	return &plan, err
 }
 
 // Deletes a plan with the given ID.
 func (self *PlanClient) Delete(id string) (bool, error) {
+	return self.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx is like Delete, but uses ctx for the API request.
+func (self *PlanClient) DeleteCtx(ctx context.Context, id string) (bool, error) {
 	resp := DeleteResp{}
 	path := "/v1/plans/" + url.QueryEscape(id)
-	if err := query("DELETE", path, nil, &resp); err != nil {
+	if err := self.client.query(ctx, "DELETE", path, nil, &resp); err != nil {
 		return false, err
 	}
 	return resp.Deleted, nil
@@ -133,14 +339,21 @@ func (self *PlanClient) Delete(id string) (bool, error) {
 
 // Returns a list of your Plans.
 func (self *PlanClient) List() ([]*Plan, error) {
-	return self.ListN(10, 0)
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *PlanClient) ListCtx(ctx context.Context) ([]*Plan, error) {
+	return self.ListNCtx(ctx, 10, 0)
 }
 
 // Returns a list of your Plans at the specified range.
 func (self *PlanClient) ListN(count int, offset int) ([]*Plan, error) {
-	// define a wrapper function for the Plan List, so that we can
-	// cleanly parse the JSON
-	type listPlanResp struct{ Data []*Plan }
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *PlanClient) ListNCtx(ctx context.Context, count int, offset int) ([]*Plan, error) {
 	resp := listPlanResp{}
 
 	// add the count and offset to the list of url values
@@ -149,9 +362,76 @@ func (self *PlanClient) ListN(count int, offset int) ([]*Plan, error) {
 		"offset": {strconv.Itoa(offset)},
 	}
 
-	err := query("GET", "/v1/plans", values, &resp)
+	err := self.client.query(ctx, "GET", "/v1/plans", values, &resp)
 	if err != nil {
 		return nil, err
 	}
 	return resp.Data, nil
 }
+
+// Iter returns an iterator that lazily pages through all of your Plans,
+// starting at the cursor given in params, if any.
+func (self *PlanClient) Iter(params *ListParams) *PlanIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *PlanClient) IterCtx(ctx context.Context, params *ListParams) *PlanIter {
+	return &PlanIter{newIter(params, url.Values{}, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listPlanResp{}
+		err := self.client.query(ctx, "GET", "/v1/plans", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, plan := range resp.Data {
+			items[i] = plan
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// PlanIter is an iterator over a list of Plans.
+type PlanIter struct {
+	*Iter
+}
+
+// Current returns the Plan at the current position of the iterator.
+func (it *PlanIter) Current() *Plan {
+	plan, _ := it.Iter.Current().(*Plan)
+	return plan
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helper Function(s)
+
+// appendPlanParamsToValues adds the parameters that can be set both when
+// creating and when updating a plan.
+func appendPlanParamsToValues(params *PlanParams, values *url.Values) {
+	if params.Nickname != "" {
+		values.Add("nickname", params.Nickname)
+	}
+	if params.Product != "" {
+		values.Add("product", params.Product)
+	}
+	if params.Active != nil {
+		values.Add("active", strconv.FormatBool(*params.Active))
+	}
+	for k, v := range params.Metadata {
+		values.Add("metadata["+k+"]", v)
+	}
+}
+
+func appendPlanTiersToValues(tiers []*PlanTier, values *url.Values) {
+	for i, tier := range tiers {
+		prefix := "tiers[" + strconv.Itoa(i) + "]"
+		if tier.UpTo == 0 {
+			values.Add(prefix+"[up_to]", "inf")
+		} else {
+			values.Add(prefix+"[up_to]", strconv.FormatInt(int64(tier.UpTo), 10))
+		}
+		if !tier.UnitAmount.IsZero() {
+			values.Add(prefix+"[unit_amount]", tier.UnitAmount.encode())
+		}
+		if !tier.FlatAmount.IsZero() {
+			values.Add(prefix+"[flat_amount]", tier.FlatAmount.encode())
+		}
+	}
+}
@@ -25,22 +25,13 @@ import (
 	"testing"
 )
 
-func init() {
-	// In order to execute Unit Test, you must set your Bhojpur Subscription API Key
-	// as environment variable, BHOJPUR_API_KEY=xxxx
-	if err := SetKeyEnv(); err != nil {
-		panic(err)
-	}
-}
-
 // Sample Plans to use when creating, deleting, updating Plan data.
 var (
 	// Plan with only the required fields
 	p1 = PlanParams{
 		ID:       "plan1",
 		Name:     "plan 1",
-		Amount:   1,
-		Currency: INR,
+		Amount:   Money{Amount: 1, Currency: INR},
 		Interval: IntervalMonth,
 	}
 
@@ -48,8 +39,7 @@ var (
 	p2 = PlanParams{
 		ID:              "plan9",
 		Name:            "plan 9",
-		Amount:          9,
-		Currency:        INR,
+		Amount:          Money{Amount: 9, Currency: INR},
 		Interval:        IntervalMonth,
 		TrialPeriodDays: 365,
 	}
@@ -80,8 +70,8 @@ func TestCreatePlan(t *testing.T) {
 	if plan.Amount != p1.Amount {
 		t.Errorf("Expected Plan Amount %v, got %v", p1.Amount, plan.Amount)
 	}
-	if plan.Currency != p1.Currency {
-		t.Errorf("Expected Plan Currency %v, got %v", p1.Currency, plan.Currency)
+	if plan.Currency != p1.Amount.Currency {
+		t.Errorf("Expected Plan Currency %v, got %v", p1.Amount.Currency, plan.Currency)
 	}
 
 	// Now try to re-create the existing plan, which should throw an exception
@@ -95,7 +85,7 @@ func TestCreatePlan(t *testing.T) {
 	// Now use an invalid currency, which should throw an exception
 	var p3 PlanParams
 	p3 = p1
-	p3.Currency = "XXX"
+	p3.Amount.Currency = "XXX"
 	_, err = Plans.Create(&p3)
 	if err == nil {
 		t.Error("Expected non-null Error when using an Invalid Currency.")
@@ -125,8 +115,8 @@ func TestRetrievePlan(t *testing.T) {
 	if plan.Amount != p2.Amount {
 		t.Errorf("Expected Plan Amount %v, got %v", p2.Amount, plan.Amount)
 	}
-	if plan.Currency != p2.Currency {
-		t.Errorf("Expected Plan Currency %v, got %v", p2.Currency, plan.Currency)
+	if plan.Currency != p2.Amount.Currency {
+		t.Errorf("Expected Plan Currency %v, got %v", p2.Amount.Currency, plan.Currency)
 	}
 	if plan.TrialPeriodDays != Int(p2.TrialPeriodDays) {
 		t.Errorf("Expected Plan Trial Period %v, got %v",
@@ -141,7 +131,7 @@ func TestUpdatePlan(t *testing.T) {
 	Plans.Create(&p1)
 	defer Plans.Delete(p1.ID)
 
-	plan, err := Plans.Update(p1.ID, "New Name")
+	plan, err := Plans.Update(p1.ID, &PlanParams{Name: "New Name"})
 	if err != nil {
 		t.Errorf("Expected Plan update, got Error %s", err.Error())
 	}
@@ -188,3 +178,124 @@ func TestListPlan(t *testing.T) {
 		t.Errorf("Expected two Plans, got %d", len(plans))
 	}
 }
+
+// Sample tiers, where the price per seat drops past 10 and 100 seats.
+var seatTiers = []*PlanTier{
+	{UpTo: 10, UnitAmount: Money{Amount: 1000}},
+	{UpTo: 100, UnitAmount: Money{Amount: 800}},
+	{UnitAmount: Money{Amount: 500}, FlatAmount: Money{Amount: 2000}},
+}
+
+// TestPlanPriceFor will test that the price of a quantity is calculated
+// locally for per-unit, graduated and volume Plans, including quantities
+// beyond a bounded last tier.
+func TestPlanPriceFor(t *testing.T) {
+	perUnit := &Plan{Amount: Money{Amount: 250, Currency: INR}, Currency: INR}
+	graduated := &Plan{Currency: INR, BillingScheme: BillingTiered, TiersMode: TiersGraduated, Tiers: seatTiers}
+	volume := &Plan{Currency: INR, BillingScheme: BillingTiered, TiersMode: TiersVolume, Tiers: seatTiers}
+	bounded := seatTiers[:2]
+	boundedGraduated := &Plan{Currency: INR, BillingScheme: BillingTiered, TiersMode: TiersGraduated, Tiers: bounded}
+	boundedVolume := &Plan{Currency: INR, BillingScheme: BillingTiered, TiersMode: TiersVolume, Tiers: bounded}
+
+	tests := []struct {
+		plan     *Plan
+		quantity int64
+		amount   int64
+	}{
+		{perUnit, 0, 0},
+		{perUnit, 4, 1000},
+		{graduated, 5, 5000},
+		{graduated, 10, 10000},
+		{graduated, 11, 10800},
+		{graduated, 150, 10000 + 72000 + 25000 + 2000},
+		{volume, 5, 5000},
+		{volume, 100, 80000},
+		{volume, 150, 75000 + 2000},
+		{boundedGraduated, 100, 10000 + 72000},
+		{boundedGraduated, 150, 10000 + 112000},
+		{boundedVolume, 100, 80000},
+		{boundedVolume, 150, 120000},
+	}
+	for _, test := range tests {
+		price := test.plan.PriceFor(test.quantity)
+		if want := (Money{Amount: test.amount, Currency: INR}); price != want {
+			t.Errorf("Expected price %v for %d of %s plan, got %v", want, test.quantity, test.plan.TiersMode, price)
+		}
+	}
+}
+
+// TestCreateTieredPlan will test that the tiers of a Plan are sent in the
+// nested form syntax, and that the upcoming invoice is priced by them.
+func TestCreateTieredPlan(t *testing.T) {
+	params := PlanParams{
+		ID:            "plan_seats",
+		Name:          "seats",
+		Amount:        Money{Currency: INR},
+		Interval:      IntervalMonth,
+		BillingScheme: BillingTiered,
+		TiersMode:     TiersGraduated,
+		Tiers:         seatTiers,
+	}
+	plan, err := Plans.Create(&params)
+	if err != nil {
+		t.Errorf("Expected Plan %s, got Error %s", params.ID, err.Error())
+		return
+	}
+	defer Plans.Delete(params.ID)
+
+	if plan.BillingScheme != BillingTiered || plan.TiersMode != TiersGraduated {
+		t.Errorf("Expected graduated tiered Plan, got %s and %s", plan.BillingScheme, plan.TiersMode)
+	}
+	if len(plan.Tiers) != 3 || plan.Tiers[1].UpTo != 100 || plan.Tiers[2].UpTo != 0 {
+		t.Errorf("Expected Tiers up to 10, 100 and inf, got %d Tiers", len(plan.Tiers))
+	} else if plan.Tiers[2].FlatAmount != (Money{Amount: 2000, Currency: INR}) {
+		t.Errorf("Expected last Tier Flat Amount %v, got %v", "20.00 INR", plan.Tiers[2].FlatAmount)
+	}
+
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+	sub, _ := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: params.ID, Quantity: 150})
+
+	invoice, err := Invoices.RetrieveCustomer(cust.ID)
+	if err != nil {
+		t.Errorf("Expected upcoming Invoice, got Error %s", err.Error())
+		return
+	}
+	if want := plan.PriceFor(sub.Quantity); invoice.Subtotal != want {
+		t.Errorf("Expected Subtotal %v, got %v", want, invoice.Subtotal)
+	}
+}
+
+// TestUpdatePlanProduct will test that we can group a Plan under a Product,
+// and change its nickname, active flag and metadata.
+func TestUpdatePlanProduct(t *testing.T) {
+	Plans.Create(&p1)
+	defer Plans.Delete(p1.ID)
+	Products.Create(&prod1)
+	defer Products.Delete(prod1.ID)
+
+	active := false
+	params := PlanParams{
+		Nickname: "Cloud monthly",
+		Product:  prod1.ID,
+		Active:   &active,
+		Metadata: map[string]string{"tier": "starter"},
+	}
+	plan, err := Plans.Update(p1.ID, &params)
+	if err != nil {
+		t.Errorf("Expected Plan update, got Error %s", err.Error())
+		return
+	}
+	if plan.Name != p1.Name {
+		t.Errorf("Expected Plan Name %s, got %s", p1.Name, plan.Name)
+	}
+	if string(plan.Product) != prod1.ID || string(plan.Nickname) != params.Nickname {
+		t.Errorf("Expected Plan %s of Product %s, got %s of %s", params.Nickname, prod1.ID, plan.Nickname, plan.Product)
+	}
+	if plan.Active {
+		t.Errorf("Expected Plan to be inactive")
+	}
+	if plan.Metadata["tier"] != "starter" {
+		t.Errorf("Expected Plan Metadata %v, got %v", params.Metadata, plan.Metadata)
+	}
+}
@@ -0,0 +1,242 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Product represents a good or service in your catalog, which is sold on a
+// recurring basis through one or more Plans, e.g. a monthly and an annual
+// plan.
+type Product struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Desc      String            `json:"description"`
+	Active    bool              `json:"active"`
+	Images    []string          `json:"images"`
+	UnitLabel String            `json:"unit_label"`
+	Metadata  map[string]string `json:"metadata"`
+	Created   int64             `json:"created"`
+	Updated   int64             `json:"updated"`
+	Livemode  bool              `json:"livemode"`
+}
+
+// listProductResp is the wrapper for a list of Products, so that we can
+// cleanly parse the JSON.
+type listProductResp struct {
+	ListMeta
+	Data []*Product `json:"data"`
+}
+
+// ProductClient encapsulates operations for creating, updating, deleting and
+// querying products using the Bhojpur Subscription REST API.
+type ProductClient struct {
+	client *Client
+}
+
+// ProductParams encapsulates options for creating or updating a Product.
+type ProductParams struct {
+	// (Optional) Unique string of your choice that will be used to identify
+	// this product. Only used when creating a product.
+	ID string
+
+	// The name of the product, displayed to customers. Required when creating
+	// a product.
+	Name string
+
+	// (Optional) An arbitrary string describing the product.
+	Desc string
+
+	// (Optional) Whether the product is available for purchase. Products are
+	// active when created, unless specified otherwise.
+	Active *bool
+
+	// (Optional) A list of URLs of images of the product. When updating, the
+	// list replaces the existing images.
+	Images []string
+
+	// (Optional) A label for one unit of the product, such as "seat", shown on
+	// invoices.
+	UnitLabel string
+
+	// (Optional) A set of key/value pairs that you can attach to the product.
+	// When updating, a key with an empty value is removed.
+	Metadata map[string]string
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
+}
+
+// Creates a new Product.
+func (self *ProductClient) Create(params *ProductParams) (*Product, error) {
+	return self.CreateCtx(context.Background(), params)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *ProductClient) CreateCtx(ctx context.Context, params *ProductParams) (*Product, error) {
+	product := Product{}
+	values := url.Values{"name": {params.Name}}
+
+	// product id is optional, add if specified
+	if len(params.ID) != 0 {
+		values.Add("id", params.ID)
+	}
+	appendProductParamsToValues(params, &values)
+
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/products", params.IdempotencyKey, values, &product)
+	return &product, err
+}
+
+// Retrieves the product with the given ID.
+func (self *ProductClient) Retrieve(id string) (*Product, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *ProductClient) RetrieveCtx(ctx context.Context, id string) (*Product, error) {
+	product := Product{}
+	path := "/v1/products/" + url.QueryEscape(id)
+	err := self.client.query(ctx, "GET", path, nil, &product)
+	return &product, err
+}
+
+// Updates the product with the given ID. Only the fields that are specified
+// in params are changed.
+func (self *ProductClient) Update(id string, params *ProductParams) (*Product, error) {
+	return self.UpdateCtx(context.Background(), id, params)
+}
+
+// UpdateCtx is like Update, but uses ctx for the API request.
+func (self *ProductClient) UpdateCtx(ctx context.Context, id string, params *ProductParams) (*Product, error) {
+	product := Product{}
+	values := url.Values{}
+	if len(params.Name) != 0 {
+		values.Add("name", params.Name)
+	}
+	appendProductParamsToValues(params, &values)
+
+	path := "/v1/products/" + url.QueryEscape(id)
+	err := self.client.queryIdempotent(ctx, "POST", path, params.IdempotencyKey, values, &product)
+	return &product, err
+}
+
+// Deletes the product with the given ID. A product can only be deleted once
+// it has no plans.
+func (self *ProductClient) Delete(id string) (bool, error) {
+	return self.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx is like Delete, but uses ctx for the API request.
+func (self *ProductClient) DeleteCtx(ctx context.Context, id string) (bool, error) {
+	resp := DeleteResp{}
+	path := "/v1/products/" + url.QueryEscape(id)
+	if err := self.client.query(ctx, "DELETE", path, nil, &resp); err != nil {
+		return false, err
+	}
+	return resp.Deleted, nil
+}
+
+// Returns a list of your products.
+func (self *ProductClient) List() ([]*Product, error) {
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *ProductClient) ListCtx(ctx context.Context) ([]*Product, error) {
+	return self.ListNCtx(ctx, 10, 0)
+}
+
+// Returns a list of your products at the specified range.
+func (self *ProductClient) ListN(count int, offset int) ([]*Product, error) {
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *ProductClient) ListNCtx(ctx context.Context, count int, offset int) ([]*Product, error) {
+	resp := listProductResp{}
+
+	// add the count and offset to the list of url values
+	values := url.Values{
+		"count":  {strconv.Itoa(count)},
+		"offset": {strconv.Itoa(offset)},
+	}
+
+	err := self.client.query(ctx, "GET", "/v1/products", values, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Iter returns an iterator that lazily pages through all of your Products,
+// starting at the cursor given in params, if any.
+func (self *ProductClient) Iter(params *ListParams) *ProductIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *ProductClient) IterCtx(ctx context.Context, params *ListParams) *ProductIter {
+	return &ProductIter{newIter(params, url.Values{}, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listProductResp{}
+		err := self.client.query(ctx, "GET", "/v1/products", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, product := range resp.Data {
+			items[i] = product
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// ProductIter is an iterator over a list of Products.
+type ProductIter struct {
+	*Iter
+}
+
+// Current returns the Product at the current position of the iterator.
+func (it *ProductIter) Current() *Product {
+	product, _ := it.Iter.Current().(*Product)
+	return product
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helper Function(s)
+
+func appendProductParamsToValues(params *ProductParams, values *url.Values) {
+	if len(params.Desc) != 0 {
+		values.Add("description", params.Desc)
+	}
+	if params.Active != nil {
+		values.Add("active", strconv.FormatBool(*params.Active))
+	}
+	for i, image := range params.Images {
+		values.Add("images["+strconv.Itoa(i)+"]", image)
+	}
+	if len(params.UnitLabel) != 0 {
+		values.Add("unit_label", params.UnitLabel)
+	}
+	for k, v := range params.Metadata {
+		values.Add("metadata["+k+"]", v)
+	}
+}
@@ -0,0 +1,129 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+)
+
+// Sample Products to use when creating, deleting, updating Product data.
+var (
+	// Product with only the required fields.
+	prod1 = ProductParams{
+		ID:   "prod_test1",
+		Name: "Bhojpur Cloud",
+	}
+
+	// Product with all required + optional fields.
+	prod2 = ProductParams{
+		ID:        "prod_test2",
+		Name:      "Bhojpur Seats",
+		Desc:      "Per-seat licensing",
+		Images:    []string{"https://example.com/seats.png"},
+		UnitLabel: "seat",
+		Metadata:  map[string]string{"team": "billing"},
+	}
+)
+
+// TestCreateProduct will test that we can successfully Create a Product,
+// parse the JSON response, and that all values are populated as expected.
+func TestCreateProduct(t *testing.T) {
+	product, err := Products.Create(&prod2)
+	if err != nil {
+		t.Errorf("Expected Product %s, got Error %s", prod2.ID, err.Error())
+		return
+	}
+	defer Products.Delete(prod2.ID)
+
+	if product.ID != prod2.ID {
+		t.Errorf("Expected Product ID %s, got %s", prod2.ID, product.ID)
+	}
+	if product.Name != prod2.Name || string(product.Desc) != prod2.Desc {
+		t.Errorf("Expected Product %s (%s), got %s (%s)", prod2.Name, prod2.Desc, product.Name, product.Desc)
+	}
+	if !product.Active {
+		t.Errorf("Expected Product to be active")
+	}
+	if len(product.Images) != 1 || product.Images[0] != prod2.Images[0] {
+		t.Errorf("Expected Product Images %v, got %v", prod2.Images, product.Images)
+	}
+	if string(product.UnitLabel) != prod2.UnitLabel {
+		t.Errorf("Expected Product Unit Label %s, got %s", prod2.UnitLabel, product.UnitLabel)
+	}
+	if product.Metadata["team"] != "billing" {
+		t.Errorf("Expected Product Metadata %v, got %v", prod2.Metadata, product.Metadata)
+	}
+}
+
+// TestUpdateProduct will test that we can successfully update a Product, and
+// that only the given fields are changed.
+func TestUpdateProduct(t *testing.T) {
+	Products.Create(&prod1)
+	defer Products.Delete(prod1.ID)
+
+	active := false
+	product, err := Products.Update(prod1.ID, &ProductParams{Desc: "Hosting", Active: &active})
+	if err != nil {
+		t.Errorf("Expected Product update, got Error %s", err.Error())
+		return
+	}
+	if product.Name != prod1.Name {
+		t.Errorf("Expected Product Name %s, got %s", prod1.Name, product.Name)
+	}
+	if product.Desc != "Hosting" || product.Active {
+		t.Errorf("Expected inactive Product with Description %s, got %s", "Hosting", product.Desc)
+	}
+}
+
+// TestListProducts will test that we can list Products.
+func TestListProducts(t *testing.T) {
+	Products.Create(&prod1)
+	defer Products.Delete(prod1.ID)
+	Products.Create(&prod2)
+	defer Products.Delete(prod2.ID)
+
+	products, err := Products.List()
+	if err != nil {
+		t.Errorf("Expected Products, got Error %s", err.Error())
+	}
+	if len(products) < 2 {
+		t.Errorf("Expected at least %d Products, got %d", 2, len(products))
+	}
+}
+
+// TestDeleteProductWithPlans will test that a Product cannot be deleted while
+// it has Plans.
+func TestDeleteProductWithPlans(t *testing.T) {
+	Products.Create(&prod1)
+	defer Products.Delete(prod1.ID)
+
+	params := p1
+	params.Product = prod1.ID
+	Plans.Create(&params)
+
+	if _, err := Products.Delete(prod1.ID); err == nil {
+		t.Error("Expected non-null Error when deleting a Product with Plans.")
+	}
+	Plans.Delete(p1.ID)
+	if ok, err := Products.Delete(prod1.ID); !ok || err != nil {
+		t.Errorf("Expected Product deletion, got %v (%v)", ok, err)
+	}
+}
@@ -0,0 +1,123 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"math"
+)
+
+// Proration rounding options, for ProrationParams.Rounding.
+const (
+	ProrateBySecond = "second"
+	ProrateByDay    = "day"
+)
+
+// ProrationParams describes a change to a Subscription, for Prorate.
+type ProrationParams struct {
+	// (Optional) The plan to switch the subscription to. When left nil, the
+	// subscription keeps its current plan.
+	Plan *Plan
+
+	// (Optional) The new quantity of the plan. When left blank, the
+	// subscription keeps its current quantity.
+	Quantity int64
+
+	// The time of the change, as a UTC timestamp. It must be within the
+	// subscription's current billing period.
+	Date int64
+
+	// (Optional) How to measure the unused part of the billing period, either
+	// ProrateBySecond (the default, which is what the API does) or
+	// ProrateByDay, which counts the day of the change as unused.
+	Rounding string
+}
+
+// Prorate calculates, without calling the API, the proration invoice items
+// that changing the subscription as described by params produces: a credit
+// for the unused time on the current plan and quantity, followed by a debit
+// for the remaining time on the new ones. Each amount is the price of a full
+// period multiplied by the unused fraction of the current period, rounded to
+// the nearest unit of the currency.
+//
+// No items are returned if nothing changes, if the change is at the end of
+// the period, or if the subscription is in its trial period, since trials are
+// not billed. Metered plans, which are billed for usage in arrears, and
+// changes to a plan in another currency cannot be prorated.
+func Prorate(sub *Subscription, params *ProrationParams) ([]*InvoiceItem, error) {
+	if sub.Plan == nil {
+		return nil, errors.New("engine: subscription has no plan to prorate")
+	}
+	plan, quantity := params.Plan, params.Quantity
+	if plan == nil {
+		plan = sub.Plan
+	}
+	if quantity == 0 {
+		quantity = sub.Quantity
+	}
+	if quantity < 1 {
+		return nil, errors.New("engine: invalid quantity to prorate")
+	}
+	if sub.Plan.UsageType == UsageMetered || plan.UsageType == UsageMetered {
+		return nil, errors.New("engine: metered plans are billed in arrears, and cannot be prorated")
+	}
+	if plan.Currency != sub.Plan.Currency {
+		return nil, errors.New("engine: cannot prorate between plans in " + sub.Plan.Currency + " and " + plan.Currency)
+	}
+
+	start, end := int64(sub.CurrentPeriodStart), int64(sub.CurrentPeriodEnd)
+	if params.Date < start || params.Date > end {
+		return nil, errors.New("engine: proration date is outside the current period of the subscription")
+	}
+	if plan.ID == sub.Plan.ID && quantity == sub.Quantity || sub.Status == SubscriptionTrialing || params.Date == end {
+		return nil, nil
+	}
+
+	unused, total := float64(end-params.Date), float64(end-start)
+	switch params.Rounding {
+	case ProrateBySecond, "":
+	case ProrateByDay:
+		// whole days, counting the day of the change as unused and a partial
+		// last day as a whole one
+		const day = 24 * 60 * 60
+		total = math.Ceil(total / day)
+		unused = total - math.Floor(float64(params.Date-start)/day)
+	default:
+		return nil, errors.New("engine: invalid proration rounding " + params.Rounding)
+	}
+
+	item := func(plan *Plan, quantity, sign int64, desc string) *InvoiceItem {
+		amount := plan.PriceFor(quantity)
+		amount.Amount = sign * int64(math.Round(float64(amount.Amount)*unused/total))
+		return &InvoiceItem{
+			Amount:    amount,
+			Currency:  amount.Currency,
+			Customer:  sub.Customer,
+			Date:      params.Date,
+			Desc:      String(desc),
+			Proration: true,
+		}
+	}
+	return []*InvoiceItem{
+		item(sub.Plan, sub.Quantity, -1, "Unused time on "+sub.Plan.Name),
+		item(plan, quantity, 1, "Remaining time on "+plan.Name),
+	}, nil
+}
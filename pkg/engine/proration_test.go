@@ -0,0 +1,140 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+	"time"
+)
+
+// TestProrate will test that the credit and debit for a plan or quantity
+// change are calculated from the unused part of the period, by the second or
+// by the day.
+func TestProrate(t *testing.T) {
+	basic := &Plan{ID: "basic", Name: "Basic", Amount: Money{Amount: 3000, Currency: INR}, Currency: INR, Interval: IntervalMonth}
+	pro := &Plan{ID: "pro", Name: "Pro", Amount: Money{Amount: 6000, Currency: INR}, Currency: INR, Interval: IntervalMonth}
+	proUSD := &Plan{ID: "pro-usd", Name: "Pro", Amount: Money{Amount: 9900, Currency: USD}, Currency: USD, Interval: IntervalMonth}
+	metered := &Plan{ID: "metered", Name: "Metered", Amount: Money{Amount: 10, Currency: INR}, Currency: INR, Interval: IntervalMonth, UsageType: UsageMetered}
+	start := time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)
+	sub := &Subscription{
+		Customer:           "cus_1",
+		Status:             SubscriptionActive,
+		Plan:               basic,
+		Quantity:           1,
+		CurrentPeriodStart: Int64(start.Unix()),
+		CurrentPeriodEnd:   Int64(NextPeriod(start, basic).Unix()),
+	}
+	// noon on the 11th, which is 19.5 of 30 days before the end of the period
+	date := start.AddDate(0, 0, 10).Add(12 * time.Hour).Unix()
+
+	tests := []struct {
+		params ProrationParams
+		credit int64
+		debit  int64
+	}{
+		{ProrationParams{Plan: pro, Date: date}, -1950, 3900},
+		{ProrationParams{Plan: pro, Date: date, Rounding: ProrateByDay}, -2000, 4000},
+		{ProrationParams{Quantity: 3, Date: date}, -1950, 5850},
+		{ProrationParams{Plan: pro, Quantity: 2, Date: start.Unix(), Rounding: ProrateByDay}, -3000, 12000},
+	}
+	for _, test := range tests {
+		items, err := Prorate(sub, &test.params)
+		if err != nil {
+			t.Errorf("Expected prorations for %+v, got Error %s", test.params, err.Error())
+			continue
+		}
+		if len(items) != 2 {
+			t.Errorf("Expected a credit and a debit for %+v, got %d items", test.params, len(items))
+			continue
+		}
+		if items[0].Amount.Amount != test.credit || items[1].Amount.Amount != test.debit {
+			t.Errorf("Expected %d and %d for %+v, got %d and %d", test.credit, test.debit, test.params, items[0].Amount.Amount, items[1].Amount.Amount)
+		}
+		if items[0].Desc != "Unused time on Basic" || !items[1].Proration || items[1].Amount.Currency != INR {
+			t.Errorf("Expected proration items, got %+v", items[1])
+		}
+	}
+
+	if items, _ := Prorate(sub, &ProrationParams{Plan: basic, Date: date}); len(items) != 0 {
+		t.Errorf("Expected no prorations without a change, got %d", len(items))
+	}
+	if items, err := Prorate(sub, &ProrationParams{Plan: pro, Date: int64(sub.CurrentPeriodEnd)}); err != nil || len(items) != 0 {
+		t.Errorf("Expected no prorations at the end of the period, got %d (%v)", len(items), err)
+	}
+	for _, params := range []ProrationParams{
+		{Plan: pro, Date: start.Unix() - 1},
+		{Plan: pro, Date: date, Rounding: "hour"},
+		{Plan: metered, Date: date},
+		{Plan: proUSD, Date: date},
+	} {
+		if _, err := Prorate(sub, &params); err == nil {
+			t.Errorf("Expected Error for %+v, got none", params)
+		}
+	}
+
+	// a metered subscription is not prorated, even to change its quantity
+	sub.Plan = metered
+	if _, err := Prorate(sub, &ProrationParams{Quantity: 2, Date: date}); err == nil {
+		t.Error("Expected Error prorating a metered Subscription, got none")
+	}
+}
+
+// TestProrateMatchesUpcoming will test that the offline calculation agrees
+// with the prorations on the upcoming invoice.
+func TestProrateMatchesUpcoming(t *testing.T) {
+	Plans.Create(&pBasic)
+	defer Plans.Delete(pBasic.ID)
+	Plans.Create(&pPro)
+	defer Plans.Delete(pPro.ID)
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+
+	sub, err := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: pBasic.ID})
+	if err != nil {
+		t.Errorf("Expected Subscription, got Error %s", err.Error())
+		return
+	}
+	pro, _ := Plans.Retrieve(pPro.ID)
+	date := int64(sub.CurrentPeriodStart) + 7*24*60*60 + 1234
+
+	params := InvoiceUpcomingParams{Customer: cust.ID, Subscription: sub.ID, ProrationDate: date}
+	params.Plan = pro.ID
+	params.Quantity = 2
+	invoice, err := Invoices.Upcoming(&params)
+	if err != nil {
+		t.Errorf("Expected preview, got Error %s", err.Error())
+		return
+	}
+	items, err := Prorate(sub, &ProrationParams{Plan: pro, Quantity: 2, Date: date})
+	if err != nil {
+		t.Errorf("Expected prorations, got Error %s", err.Error())
+		return
+	}
+	if len(items) != len(invoice.Lines.Prorations) {
+		t.Errorf("Expected %d prorations, got %d", len(invoice.Lines.Prorations), len(items))
+		return
+	}
+	for i, item := range invoice.Lines.Prorations {
+		if items[i].Amount != item.Amount || items[i].Desc != item.Desc {
+			t.Errorf("Expected %s of %v, got %s of %v", item.Desc, item.Amount, items[i].Desc, items[i].Amount)
+		}
+	}
+}
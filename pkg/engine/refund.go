@@ -0,0 +1,268 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+)
+
+// Refund Reasons
+const (
+	RefundDuplicate           = "duplicate"
+	RefundFraudulent          = "fraudulent"
+	RefundRequestedByCustomer = "requested_by_customer"
+)
+
+// Refund represents a full or partial refund of a Charge. A charge may be
+// refunded several times, until its whole amount is refunded.
+type Refund struct {
+	ID                 string            `json:"id"`
+	Amount             Money             `json:"amount"`
+	Currency           string            `json:"currency"`
+	Charge             string            `json:"charge"`
+	Reason             String            `json:"reason"`
+	BalanceTransaction String            `json:"balance_transaction"`
+	Created            int64             `json:"created"`
+	Metadata           map[string]string `json:"metadata"`
+	Livemode           bool              `json:"livemode"`
+}
+
+func (self *Refund) UnmarshalJSON(data []byte) error {
+	type refund Refund
+	if err := json.Unmarshal(data, (*refund)(self)); err != nil {
+		return err
+	}
+	setCurrency(self.Currency, &self.Amount)
+	return nil
+}
+
+// RefundList is the list of the refunds of a Charge, most recent first.
+type RefundList struct {
+	ListMeta
+	Data []*Refund `json:"data"`
+}
+
+// RefundParams encapsulates options for creating and updating a Refund.
+type RefundParams struct {
+	// The ID of the charge to refund. Only used by Create.
+	Charge string
+
+	// (Optional) The amount to refund, in the currency of the charge. Defaults
+	// to the amount of the charge that was not refunded yet. Only used by
+	// Create.
+	Amount Money
+
+	// (Optional) The reason for the refund, one of RefundDuplicate,
+	// RefundFraudulent or RefundRequestedByCustomer. Only used by Create.
+	Reason string
+
+	// (Optional) Whether to refund the application fee of the charge too, in
+	// proportion to the amount refunded. Only used by Create.
+	RefundApplicationFee bool
+
+	// (Optional) Set of key/value pairs to attach to the refund. A blank value
+	// removes the key on update.
+	Metadata map[string]string
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
+}
+
+// RefundListParams encapsulates options for filtering a list of Refunds. The
+// paging options of the embedded ListParams are only used by Iter.
+type RefundListParams struct {
+	ListParams
+
+	// (Optional) Only return refunds of the charge with this ID.
+	Charge string
+}
+
+// listRefundsResp is the wrapper for a list of Refunds, so that we can cleanly
+// parse the JSON.
+type listRefundsResp struct {
+	ListMeta
+	Data []*Refund `json:"data"`
+}
+
+// RefundClient encapsulates operations for creating, updating and querying
+// refunds using the Bhojpur Subscription REST API.
+type RefundClient struct {
+	client *Client
+}
+
+// Creates a new Refund of a charge.
+func (self *RefundClient) Create(params *RefundParams) (*Refund, error) {
+	return self.CreateCtx(context.Background(), params)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *RefundClient) CreateCtx(ctx context.Context, params *RefundParams) (*Refund, error) {
+	refund := Refund{}
+	values := url.Values{"charge": {params.Charge}}
+	if !params.Amount.IsZero() {
+		values.Add("amount", params.Amount.encode())
+	}
+	if params.Reason != "" {
+		values.Add("reason", params.Reason)
+	}
+	if params.RefundApplicationFee {
+		values.Add("refund_application_fee", "true")
+	}
+	appendRefundParamsToValues(params, &values)
+
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/refunds", params.IdempotencyKey, values, &refund)
+	return &refund, err
+}
+
+// Retrieves the Refund with the given ID.
+func (self *RefundClient) Retrieve(id string) (*Refund, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *RefundClient) RetrieveCtx(ctx context.Context, id string) (*Refund, error) {
+	refund := Refund{}
+	path := "/v1/refunds/" + url.QueryEscape(id)
+	err := self.client.query(ctx, "GET", path, nil, &refund)
+	return &refund, err
+}
+
+// Updates the metadata of the Refund with the given ID.
+func (self *RefundClient) Update(id string, params *RefundParams) (*Refund, error) {
+	return self.UpdateCtx(context.Background(), id, params)
+}
+
+// UpdateCtx is like Update, but uses ctx for the API request.
+func (self *RefundClient) UpdateCtx(ctx context.Context, id string, params *RefundParams) (*Refund, error) {
+	refund := Refund{}
+	values := url.Values{}
+	appendRefundParamsToValues(params, &values)
+
+	path := "/v1/refunds/" + url.QueryEscape(id)
+	err := self.client.queryIdempotent(ctx, "POST", path, params.IdempotencyKey, values, &refund)
+	return &refund, err
+}
+
+// Returns a list of your Refunds.
+func (self *RefundClient) List() ([]*Refund, error) {
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *RefundClient) ListCtx(ctx context.Context) ([]*Refund, error) {
+	return self.list(ctx, nil, 10, 0)
+}
+
+// Returns a list of your Refunds at the specified range.
+func (self *RefundClient) ListN(count int, offset int) ([]*Refund, error) {
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *RefundClient) ListNCtx(ctx context.Context, count int, offset int) ([]*Refund, error) {
+	return self.list(ctx, nil, count, offset)
+}
+
+// Returns a list of the Refunds of the charge with the given ID.
+func (self *RefundClient) ChargeList(id string) ([]*Refund, error) {
+	return self.ChargeListCtx(context.Background(), id)
+}
+
+// ChargeListCtx is like ChargeList, but uses ctx for the API request.
+func (self *RefundClient) ChargeListCtx(ctx context.Context, id string) ([]*Refund, error) {
+	return self.list(ctx, &RefundListParams{Charge: id}, 10, 0)
+}
+
+func (self *RefundClient) list(ctx context.Context, params *RefundListParams, count int, offset int) ([]*Refund, error) {
+	resp := listRefundsResp{}
+
+	// add the count and offset to the list of url values
+	values := url.Values{
+		"count":  {strconv.Itoa(count)},
+		"offset": {strconv.Itoa(offset)},
+	}
+
+	// add the filters, if provided
+	if params != nil {
+		appendRefundListParamsToValues(params, &values)
+	}
+
+	err := self.client.query(ctx, "GET", "/v1/refunds", values, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Iter returns an iterator that lazily pages through all of your Refunds
+// matching the filters in params, starting at its cursor, if any.
+func (self *RefundClient) Iter(params *RefundListParams) *RefundIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *RefundClient) IterCtx(ctx context.Context, params *RefundListParams) *RefundIter {
+	values := url.Values{}
+	var list *ListParams
+	if params != nil {
+		appendRefundListParamsToValues(params, &values)
+		list = &params.ListParams
+	}
+	return &RefundIter{newIter(list, values, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listRefundsResp{}
+		err := self.client.query(ctx, "GET", "/v1/refunds", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, refund := range resp.Data {
+			items[i] = refund
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// RefundIter is an iterator over a list of Refunds.
+type RefundIter struct {
+	*Iter
+}
+
+// Current returns the Refund at the current position of the iterator.
+func (it *RefundIter) Current() *Refund {
+	refund, _ := it.Iter.Current().(*Refund)
+	return refund
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helper Function(s)
+
+func appendRefundParamsToValues(params *RefundParams, values *url.Values) {
+	for k, v := range params.Metadata {
+		values.Add("metadata["+k+"]", v)
+	}
+}
+
+func appendRefundListParamsToValues(params *RefundListParams, values *url.Values) {
+	if params.Charge != "" {
+		values.Add("charge", params.Charge)
+	}
+}
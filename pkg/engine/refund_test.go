@@ -0,0 +1,95 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+)
+
+// TestCreateRefund will test that a charge can be refunded in parts, with a
+// reason and metadata, and that the charge lists its refunds.
+func TestCreateRefund(t *testing.T) {
+	charge, _ := Charges.Create(&charge1)
+
+	params := RefundParams{
+		Charge:   charge.ID,
+		Amount:   Money{Amount: 100, Currency: INR},
+		Reason:   RefundRequestedByCustomer,
+		Metadata: map[string]string{"ticket": "1234"},
+	}
+	refund, err := Refunds.Create(&params)
+	if err != nil {
+		t.Errorf("Expected Refund, got Error %s", err.Error())
+		return
+	}
+	if refund.Amount != params.Amount || refund.Charge != charge.ID {
+		t.Errorf("Expected Refund of %v of Charge %s, got %v of %s", params.Amount, charge.ID, refund.Amount, refund.Charge)
+	}
+	if refund.Reason != RefundRequestedByCustomer || refund.Metadata["ticket"] != "1234" {
+		t.Errorf("Expected Refund with reason and metadata, got %+v", refund)
+	}
+
+	// the rest of the charge is refunded by default
+	rest, err := Refunds.Create(&RefundParams{Charge: charge.ID, Reason: RefundDuplicate, RefundApplicationFee: true})
+	if err != nil {
+		t.Errorf("Expected Refund, got Error %s", err.Error())
+		return
+	}
+	if rest.Amount.Amount != charge.Amount.Amount-100 {
+		t.Errorf("Expected Refund of %d, got %d", charge.Amount.Amount-100, rest.Amount.Amount)
+	}
+	if _, err := Refunds.Create(&RefundParams{Charge: charge.ID}); err == nil {
+		t.Error("Expected Error refunding a Charge twice")
+	}
+
+	charge, _ = Charges.Retrieve(charge.ID)
+	if !charge.Refunded || charge.AmountRefunded != charge.Amount {
+		t.Errorf("Expected Charge to be refunded in full, got %v refunded", charge.AmountRefunded)
+	}
+	if charge.Refunds == nil || len(charge.Refunds.Data) != 2 || charge.Refunds.Data[0].ID != rest.ID {
+		t.Errorf("Expected the Charge to list both Refunds, most recent first")
+	}
+	refunds, _ := Refunds.ChargeList(charge.ID)
+	if len(refunds) != 2 {
+		t.Errorf("Expected 2 Refunds of the Charge, got %d", len(refunds))
+	}
+}
+
+// TestUpdateRefund will test that the metadata of a refund can be updated.
+func TestUpdateRefund(t *testing.T) {
+	charge, _ := Charges.Create(&charge1)
+	refund, _ := Refunds.Create(&RefundParams{Charge: charge.ID, Metadata: map[string]string{"ticket": "1234"}})
+
+	refund, err := Refunds.Update(refund.ID, &RefundParams{Metadata: map[string]string{"ticket": "", "agent": "pramila"}})
+	if err != nil {
+		t.Errorf("Expected Refund, got Error %s", err.Error())
+		return
+	}
+	if _, ok := refund.Metadata["ticket"]; ok || refund.Metadata["agent"] != "pramila" {
+		t.Errorf("Expected updated metadata, got %v", refund.Metadata)
+	}
+	if refund, _ = Refunds.Retrieve(refund.ID); refund.Metadata["agent"] != "pramila" {
+		t.Errorf("Expected updated metadata to be saved, got %v", refund.Metadata)
+	}
+	if _, err := Refunds.Create(&RefundParams{Charge: charge.ID, Reason: "changed_mind"}); err == nil {
+		t.Error("Expected Error for an invalid reason")
+	}
+}
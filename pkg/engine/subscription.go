@@ -21,6 +21,8 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
+	"errors"
 	"net/url"
 	"strconv"
 )
@@ -34,30 +36,50 @@ const (
 	SubscriptionUnpaid   = "unpaid"
 )
 
-// Subscriptions represents a recurring charge a customer's card.
+// Subscription represents a recurring charge to a customer's card. A
+// customer may hold any number of subscriptions at once.
 type Subscription struct {
-	Customer           string `json:"customer"`
-	Status             string `json:"status"`
-	Plan               *Plan  `json:"plan"`
-	Start              int64  `json:"start"`
-	EndedAt            Int64  `json:"ended_at"`
-	CurrentPeriodStart Int64  `json:"current_period_start"`
-	CurrentPeriodEnd   Int64  `json:"current_period_end"`
-	TrialStart         Int64  `json:"trial_start"`
-	TrialEnd           Int64  `json:"trial_end"`
-	CanceledAt         Int64  `json:"canceled_at"`
-	CancelAtPeriodEnd  bool   `json:"cancel_at_period_end"`
-	Quantity           int64  `json:"quantity"`
-}
-
-// SubscriptionClient encapsulates operations for updating and canceling
-// customer subscriptions using the Bhojpur Subscription REST API.
-type SubscriptionClient struct{}
-
-// SubscriptionParams encapsulates options for updating a Customer's
-// subscription.
+	ID                 string            `json:"id"`
+	Customer           string            `json:"customer"`
+	Status             string            `json:"status"`
+	Plan               *Plan             `json:"plan"`
+	Start              int64             `json:"start"`
+	EndedAt            Int64             `json:"ended_at"`
+	CurrentPeriodStart Int64             `json:"current_period_start"`
+	CurrentPeriodEnd   Int64             `json:"current_period_end"`
+	TrialStart         Int64             `json:"trial_start"`
+	TrialEnd           Int64             `json:"trial_end"`
+	CanceledAt         Int64             `json:"canceled_at"`
+	CancelAtPeriodEnd  bool              `json:"cancel_at_period_end"`
+	Quantity           int64             `json:"quantity"`
+	Metadata           map[string]string `json:"metadata"`
+}
+
+// SubscriptionData is the list of a Customer's subscriptions that have not
+// been canceled.
+type SubscriptionData struct {
+	Object string          `json:"object"`
+	Count  int             `json:"count"`
+	Url    string          `json:"url"`
+	Data   []*Subscription `json:"data"`
+}
+
+// SubscriptionClient encapsulates operations for creating, updating, canceling
+// and querying subscriptions using the Bhojpur Subscription REST API.
+type SubscriptionClient struct {
+	client *Client
+}
+
+// SubscriptionParams encapsulates options for creating or updating a
+// Subscription.
 type SubscriptionParams struct {
-	// The identifier of the plan to subscribe the customer to.
+	// The ID of the customer to subscribe. Required when creating a
+	// subscription, and ignored when updating one.
+	Customer string
+
+	// The identifier of the plan to subscribe the customer to. Required when
+	// creating a subscription; when updating one, the plan is only changed
+	// if specified.
 	Plan string
 
 	// (Optional) The code of the coupon to apply to the customer if you would
@@ -65,7 +87,7 @@ type SubscriptionParams struct {
 	Coupon string
 
 	// (Optional) Flag telling us whether to prorate switching plans during a
-	// billing cycle
+	// billing cycle. Use Prorate to calculate the resulting invoice items.
 	Prorate bool
 
 	// (Optional) UTC integer timestamp representing the end of the trial period
@@ -82,12 +104,306 @@ type SubscriptionParams struct {
 
 	// (Optional) The quantity you'd like to apply to the subscription you're creating.
 	Quantity int64
+
+	// (Optional) A set of key/value pairs that you can attach to the
+	// subscription. When updating, a key with an empty value is removed.
+	Metadata map[string]string
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
+}
+
+// SubscriptionListParams encapsulates options for filtering a list of
+// Subscriptions. The paging options of the embedded ListParams are only used
+// by Iter.
+type SubscriptionListParams struct {
+	ListParams
+
+	// (Optional) Only return subscriptions for the customer with this ID.
+	Customer string
+
+	// (Optional) Only return subscriptions to the plan with this ID.
+	Plan string
+
+	// (Optional) Only return subscriptions with this status. Canceled
+	// subscriptions are only returned when asked for, or with the status
+	// "all".
+	Status string
+}
+
+// listSubscriptionsResp is the wrapper for a list of Subscriptions, so that we
+// can cleanly parse the JSON.
+type listSubscriptionsResp struct {
+	ListMeta
+	Data []*Subscription `json:"data"`
+}
+
+// Subscribes a customer to a plan, creating a new subscription. The
+// customer's existing subscriptions are left unchanged.
+func (self *SubscriptionClient) Create(params *SubscriptionParams) (*Subscription, error) {
+	return self.CreateCtx(context.Background(), params)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *SubscriptionClient) CreateCtx(ctx context.Context, params *SubscriptionParams) (*Subscription, error) {
+	values := url.Values{
+		"customer": {params.Customer},
+		"plan":     {params.Plan},
+	}
+	appendSubscriptionParamsToValues(params, &values)
+
+	s := Subscription{}
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/subscriptions", params.IdempotencyKey, values, &s)
+	return &s, err
+}
+
+// Retrieves the subscription with the given ID.
+func (self *SubscriptionClient) Retrieve(id string) (*Subscription, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *SubscriptionClient) RetrieveCtx(ctx context.Context, id string) (*Subscription, error) {
+	s := Subscription{}
+	path := "/v1/subscriptions/" + url.QueryEscape(id)
+	err := self.client.query(ctx, "GET", path, nil, &s)
+	return &s, err
+}
+
+// Updates the subscription with the given ID, e.g. to change its plan,
+// quantity or metadata.
+func (self *SubscriptionClient) UpdateByID(id string, params *SubscriptionParams) (*Subscription, error) {
+	return self.UpdateByIDCtx(context.Background(), id, params)
+}
+
+// UpdateByIDCtx is like UpdateByID, but uses ctx for the API request.
+func (self *SubscriptionClient) UpdateByIDCtx(ctx context.Context, id string, params *SubscriptionParams) (*Subscription, error) {
+	values := url.Values{}
+	if len(params.Plan) != 0 {
+		values.Add("plan", params.Plan)
+	}
+	appendSubscriptionParamsToValues(params, &values)
+
+	s := Subscription{}
+	path := "/v1/subscriptions/" + url.QueryEscape(id)
+	err := self.client.queryIdempotent(ctx, "POST", path, params.IdempotencyKey, values, &s)
+	return &s, err
+}
+
+// Cancels the subscription with the given ID. It cancels the subscription
+// immediately.
+func (self *SubscriptionClient) CancelByID(id string) (*Subscription, error) {
+	return self.CancelByIDCtx(context.Background(), id)
+}
+
+// CancelByIDCtx is like CancelByID, but uses ctx for the API request.
+func (self *SubscriptionClient) CancelByIDCtx(ctx context.Context, id string) (*Subscription, error) {
+	s := Subscription{}
+	path := "/v1/subscriptions/" + url.QueryEscape(id)
+	err := self.client.query(ctx, "DELETE", path, nil, &s)
+	return &s, err
+}
+
+// Cancels the subscription with the given ID at the end of the billing
+// period.
+func (self *SubscriptionClient) CancelAtPeriodEndByID(id string) (*Subscription, error) {
+	return self.CancelAtPeriodEndByIDCtx(context.Background(), id)
 }
 
-// Subscribes a customer to a new plan.
+// CancelAtPeriodEndByIDCtx is like CancelAtPeriodEndByID, but uses ctx for
+// the API request.
+func (self *SubscriptionClient) CancelAtPeriodEndByIDCtx(ctx context.Context, id string) (*Subscription, error) {
+	values := url.Values{}
+	values.Add("at_period_end", "true")
+
+	s := Subscription{}
+	path := "/v1/subscriptions/" + url.QueryEscape(id)
+	err := self.client.query(ctx, "DELETE", path, values, &s)
+	return &s, err
+}
+
+// Changes the only subscription of the customer. It returns an error if the
+// customer has no subscription, or several. The subscription is looked up and
+// changed by two separate requests.
+//
+// Deprecated: a customer may have several subscriptions. Use UpdateByID with
+// the ID of the subscription, or Create to subscribe the customer.
 func (self *SubscriptionClient) Update(customerId string, params *SubscriptionParams) (*Subscription, error) {
-	values := url.Values{"plan": {params.Plan}}
+	return self.UpdateCtx(context.Background(), customerId, params)
+}
+
+// UpdateCtx is like Update, but uses ctx for the API requests.
+//
+// Deprecated: use UpdateByIDCtx with the ID of the subscription.
+func (self *SubscriptionClient) UpdateCtx(ctx context.Context, customerId string, params *SubscriptionParams) (*Subscription, error) {
+	sub, err := self.customerSubscription(ctx, customerId)
+	if err != nil {
+		return nil, err
+	}
+	return self.UpdateByIDCtx(ctx, sub.ID, params)
+}
+
+// Cancels the only subscription of the customer immediately. It returns an
+// error if the customer has no subscription, or several.
+//
+// Deprecated: a customer may have several subscriptions. Use CancelByID with
+// the ID of the subscription.
+func (self *SubscriptionClient) Cancel(customerId string) (*Subscription, error) {
+	return self.CancelCtx(context.Background(), customerId)
+}
+
+// CancelCtx is like Cancel, but uses ctx for the API requests.
+//
+// Deprecated: use CancelByIDCtx with the ID of the subscription.
+func (self *SubscriptionClient) CancelCtx(ctx context.Context, customerId string) (*Subscription, error) {
+	sub, err := self.customerSubscription(ctx, customerId)
+	if err != nil {
+		return nil, err
+	}
+	return self.CancelByIDCtx(ctx, sub.ID)
+}
+
+// Cancels the only subscription of the customer at the end of the billing
+// period. It returns an error if the customer has no subscription, or
+// several.
+//
+// Deprecated: a customer may have several subscriptions. Use
+// CancelAtPeriodEndByID with the ID of the subscription.
+func (self *SubscriptionClient) CancelAtPeriodEnd(customerId string) (*Subscription, error) {
+	return self.CancelAtPeriodEndCtx(context.Background(), customerId)
+}
+
+// CancelAtPeriodEndCtx is like CancelAtPeriodEnd, but uses ctx for the API
+// requests.
+//
+// Deprecated: use CancelAtPeriodEndByIDCtx with the ID of the subscription.
+func (self *SubscriptionClient) CancelAtPeriodEndCtx(ctx context.Context, customerId string) (*Subscription, error) {
+	sub, err := self.customerSubscription(ctx, customerId)
+	if err != nil {
+		return nil, err
+	}
+	return self.CancelAtPeriodEndByIDCtx(ctx, sub.ID)
+}
+
+// customerSubscription returns the only subscription of the customer that
+// has not been canceled, and an error if there is none or there are several.
+func (self *SubscriptionClient) customerSubscription(ctx context.Context, customerId string) (*Subscription, error) {
+	subs, err := self.list(ctx, &SubscriptionListParams{Customer: customerId}, 2, 0)
+	if err != nil {
+		return nil, err
+	}
+	switch len(subs) {
+	case 0:
+		return nil, errors.New("engine: customer " + customerId + " has no active subscription")
+	case 1:
+		return subs[0], nil
+	}
+	return nil, errors.New("engine: customer " + customerId + " has several subscriptions, use the ByID methods")
+}
+
+// Returns a list of your Subscriptions that have not been canceled.
+func (self *SubscriptionClient) List() ([]*Subscription, error) {
+	return self.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but uses ctx for the API request.
+func (self *SubscriptionClient) ListCtx(ctx context.Context) ([]*Subscription, error) {
+	return self.list(ctx, nil, 10, 0)
+}
+
+// Returns a list of your Subscriptions at the specified range.
+func (self *SubscriptionClient) ListN(count int, offset int) ([]*Subscription, error) {
+	return self.ListNCtx(context.Background(), count, offset)
+}
+
+// ListNCtx is like ListN, but uses ctx for the API request.
+func (self *SubscriptionClient) ListNCtx(ctx context.Context, count int, offset int) ([]*Subscription, error) {
+	return self.list(ctx, nil, count, offset)
+}
+
+// Returns a list of the Subscriptions of the customer with the given ID.
+func (self *SubscriptionClient) CustomerList(id string) ([]*Subscription, error) {
+	return self.CustomerListCtx(context.Background(), id)
+}
+
+// CustomerListCtx is like CustomerList, but uses ctx for the API request.
+func (self *SubscriptionClient) CustomerListCtx(ctx context.Context, id string) ([]*Subscription, error) {
+	return self.list(ctx, &SubscriptionListParams{Customer: id}, 10, 0)
+}
+
+// Returns a list of your Subscriptions matching the given filters, at the
+// specified range.
+func (self *SubscriptionClient) ListFiltered(params *SubscriptionListParams, count int, offset int) ([]*Subscription, error) {
+	return self.ListFilteredCtx(context.Background(), params, count, offset)
+}
+
+// ListFilteredCtx is like ListFiltered, but uses ctx for the API request.
+func (self *SubscriptionClient) ListFilteredCtx(ctx context.Context, params *SubscriptionListParams, count int, offset int) ([]*Subscription, error) {
+	return self.list(ctx, params, count, offset)
+}
+
+func (self *SubscriptionClient) list(ctx context.Context, params *SubscriptionListParams, count int, offset int) ([]*Subscription, error) {
+	resp := listSubscriptionsResp{}
+
+	// add the count and offset to the list of url values
+	values := url.Values{
+		"count":  {strconv.Itoa(count)},
+		"offset": {strconv.Itoa(offset)},
+	}
+
+	// add the filters, if provided
+	if params != nil {
+		appendSubscriptionListParamsToValues(params, &values)
+	}
 
+	err := self.client.query(ctx, "GET", "/v1/subscriptions", values, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Iter returns an iterator that lazily pages through all of your Subscriptions
+// matching the filters in params, starting at its cursor, if any.
+func (self *SubscriptionClient) Iter(params *SubscriptionListParams) *SubscriptionIter {
+	return self.IterCtx(context.Background(), params)
+}
+
+// IterCtx is like Iter, but uses ctx for every API request.
+func (self *SubscriptionClient) IterCtx(ctx context.Context, params *SubscriptionListParams) *SubscriptionIter {
+	values := url.Values{}
+	var list *ListParams
+	if params != nil {
+		appendSubscriptionListParamsToValues(params, &values)
+		list = &params.ListParams
+	}
+	return &SubscriptionIter{newIter(list, values, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listSubscriptionsResp{}
+		err := self.client.query(ctx, "GET", "/v1/subscriptions", values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, subscription := range resp.Data {
+			items[i] = subscription
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// SubscriptionIter is an iterator over a list of Subscriptions.
+type SubscriptionIter struct {
+	*Iter
+}
+
+// Current returns the Subscription at the current position of the iterator.
+func (it *SubscriptionIter) Current() *Subscription {
+	subscription, _ := it.Iter.Current().(*Subscription)
+	return subscription
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helper Function(s)
+
+func appendSubscriptionParamsToValues(params *SubscriptionParams, values *url.Values) {
 	// set optional parameters
 	if len(params.Coupon) != 0 {
 		values.Add("coupon", params.Coupon)
@@ -101,35 +417,25 @@ func (self *SubscriptionClient) Update(customerId string, params *SubscriptionPa
 	if params.Quantity != 0 {
 		values.Add("quantity", strconv.FormatInt(params.Quantity, 10))
 	}
+	for k, v := range params.Metadata {
+		values.Add("metadata["+k+"]", v)
+	}
 	// attach a new card, if requested
 	if len(params.Token) != 0 {
 		values.Add("card", params.Token)
 	} else if params.Card != nil {
-		appendCardParamsToValues(params.Card, &values)
+		appendCardParamsToValues(params.Card, values)
 	}
-
-	s := Subscription{}
-	path := "/v1/customers/" + url.QueryEscape(customerId) + "/subscription"
-	err := query("POST", path, values, &s)
-	return &s, err
-}
-
-// Cancels the customer's subscription if it exists. It cancels the
-// subscription immediately.
-func (self *SubscriptionClient) Cancel(customerId string) (*Subscription, error) {
-	s := Subscription{}
-	path := "/v1/customers/" + url.QueryEscape(customerId) + "/subscription"
-	err := query("DELETE", path, nil, &s)
-	return &s, err
 }
 
-// Cancels the customer's subscription at the end of the billing period.
-func (self *SubscriptionClient) CancelAtPeriodEnd(customerId string) (*Subscription, error) {
-	values := url.Values{}
-	values.Add("at_period_end", "true")
-
-	s := Subscription{}
-	path := "/v1/customers/" + url.QueryEscape(customerId) + "/subscription"
-	err := query("DELETE", path, values, &s)
-	return &s, err
+func appendSubscriptionListParamsToValues(params *SubscriptionListParams, values *url.Values) {
+	if params.Customer != "" {
+		values.Add("customer", params.Customer)
+	}
+	if params.Plan != "" {
+		values.Add("plan", params.Plan)
+	}
+	if params.Status != "" {
+		values.Add("status", params.Status)
+	}
 }
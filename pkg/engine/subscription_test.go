@@ -25,14 +25,6 @@ import (
 	"time"
 )
 
-func init() {
-	// In order to execute Unit Test, you must set your Bhojpur Subscription API Key
-	// as environment variable, BHOJPUR_API_KEY=xxxx
-	if err := SetKeyEnv(); err != nil {
-		panic(err)
-	}
-}
-
 // Sample Subscriptions to use for testing
 var (
 
@@ -57,19 +49,27 @@ var (
 	}
 )
 
-func TestUpdateSubscription(t *testing.T) {
+// TestCreateSubscription will test that we can subscribe a Customer to a
+// Plan, and that the new Subscription has an ID.
+func TestCreateSubscription(t *testing.T) {
 	// Create the customer, and defer its deletion
 	cust, _ := Customers.Create(&cust1)
 	defer Customers.Delete(cust.ID)
 
 	// Create the plan, and defer its deletion
 	Plans.Create(&p1)
-	defer Customers.Delete(p1.ID)
+	defer Plans.Delete(p1.ID)
 
 	// Subscribe the Customer to the Plan
-	resp, err := Subscriptions.Update(cust.ID, &sub1)
+	params := sub1
+	params.Customer = cust.ID
+	resp, err := Subscriptions.Create(&params)
 	if err != nil {
 		t.Errorf("Expected Subscription, got error %s", err.Error())
+		return
+	}
+	if resp.ID == "" {
+		t.Errorf("Expected Subscription ID, got none")
 	}
 	if resp.Customer != cust.ID {
 		t.Errorf("Expected Customer %s, got %s", cust.ID, resp.Customer)
@@ -77,9 +77,19 @@ func TestUpdateSubscription(t *testing.T) {
 	if resp.Status != SubscriptionActive {
 		t.Errorf("Expected Active Subscription, got %s", resp.Status)
 	}
+
+	// Retrieve the Subscription by Id
+	sub, err := Subscriptions.Retrieve(resp.ID)
+	if err != nil {
+		t.Errorf("Expected Subscription %s, got error %s", resp.ID, err.Error())
+		return
+	}
+	if sub.Plan == nil || sub.Plan.ID != p1.ID {
+		t.Errorf("Expected Plan %s, got %v", p1.ID, sub.Plan)
+	}
 }
 
-func TestUpdateSubscriptionCard(t *testing.T) {
+func TestCreateSubscriptionCard(t *testing.T) {
 
 	// Create the customer, and defer its deletion
 	cust, _ := Customers.Create(&cust1)
@@ -91,16 +101,19 @@ func TestUpdateSubscriptionCard(t *testing.T) {
 
 	// Create the plan, and defer its deletion
 	Plans.Create(&p1)
-	defer Customers.Delete(p1.ID)
+	defer Plans.Delete(p1.ID)
 
 	// Create the coupon, and defer its deletion
 	Coupons.Create(&c1)
 	defer Coupons.Delete(c1.ID)
 
 	// Subscribe a Customer to a new plan, using a new Credit Card
-	resp, err := Subscriptions.Update(cust.ID, &sub2)
+	params := sub2
+	params.Customer = cust.ID
+	resp, err := Subscriptions.Create(&params)
 	if err != nil {
 		t.Errorf("Expected Subscription, got error %s", err.Error())
+		return
 	}
 	if resp.Quantity != sub2.Quantity {
 		t.Errorf("Expected Quantity %d, got %d", sub2.Quantity, resp.Quantity)
@@ -113,7 +126,7 @@ func TestUpdateSubscriptionCard(t *testing.T) {
 	}
 }
 
-func TestUpdateSubscriptionToken(t *testing.T) {
+func TestCreateSubscriptionToken(t *testing.T) {
 	// Create the customer, and defer its deletion
 	cust, _ := Customers.Create(&cust1)
 	defer Customers.Delete(cust.ID)
@@ -124,14 +137,14 @@ func TestUpdateSubscriptionToken(t *testing.T) {
 
 	// Create the plan, and defer its deletion
 	Plans.Create(&p1)
-	defer Customers.Delete(p1.ID)
+	defer Plans.Delete(p1.ID)
 
 	// Create a Token for the credit card
 	token, _ := Tokens.Create(&token1)
 
 	// Subscribe the Customer to the Plan, using the Token
-	params := SubscriptionParams{Plan: "plan1", Token: token.ID}
-	_, err := Subscriptions.Update(cust.ID, &params)
+	params := SubscriptionParams{Customer: cust.ID, Plan: "plan1", Token: token.ID}
+	_, err := Subscriptions.Create(&params)
 	if err != nil {
 		t.Errorf("Expected Subscription with Token, got error %s", err.Error())
 	}
@@ -143,6 +156,97 @@ func TestUpdateSubscriptionToken(t *testing.T) {
 	}
 }
 
+// TestUpdateSubscription will test that we can change the quantity and
+// metadata of a Subscription, without changing its Plan.
+func TestUpdateSubscription(t *testing.T) {
+	// Create the customer, and defer its deletion
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+
+	// Create the plan, and defer its deletion
+	Plans.Create(&p1)
+	defer Plans.Delete(p1.ID)
+
+	// Subscribe the Customer to the Plan
+	sub, err := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: p1.ID})
+	if err != nil {
+		t.Errorf("Expected Subscription, got error %s", err.Error())
+		return
+	}
+
+	// Now update the quantity and metadata
+	params := SubscriptionParams{Quantity: 3, Metadata: map[string]string{"order": "6735"}}
+	resp, err := Subscriptions.UpdateByID(sub.ID, &params)
+	if err != nil {
+		t.Errorf("Expected Subscription, got error %s", err.Error())
+		return
+	}
+	if resp.ID != sub.ID {
+		t.Errorf("Expected Subscription %s, got %s", sub.ID, resp.ID)
+	}
+	if resp.Quantity != 3 {
+		t.Errorf("Expected Quantity %d, got %d", 3, resp.Quantity)
+	}
+	if resp.Metadata["order"] != "6735" {
+		t.Errorf("Expected Metadata order %s, got %v", "6735", resp.Metadata)
+	}
+	if resp.Plan == nil || resp.Plan.ID != p1.ID {
+		t.Errorf("Expected Plan %s, got %v", p1.ID, resp.Plan)
+	}
+}
+
+// TestListSubscriptions will test that a Customer can hold several
+// Subscriptions at once, and that they can be listed by customer, plan and
+// status.
+func TestListSubscriptions(t *testing.T) {
+	// Create the customer, and defer its deletion
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+
+	// Create the plans, and defer their deletion
+	Plans.Create(&p1)
+	defer Plans.Delete(p1.ID)
+	Plans.Create(&p2)
+	defer Plans.Delete(p2.ID)
+
+	// Subscribe the Customer to both Plans
+	sub, _ := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: p1.ID})
+	Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: p2.ID})
+
+	cust, _ = Customers.Retrieve(cust.ID)
+	if cust.Subscriptions.Count != 2 || len(cust.Subscriptions.Data) != 2 {
+		t.Errorf("Expected Customer with %d Subscriptions, got %d", 2, cust.Subscriptions.Count)
+	}
+
+	tests := []struct {
+		params SubscriptionListParams
+		count  int
+	}{
+		{SubscriptionListParams{Customer: cust.ID}, 2},
+		{SubscriptionListParams{Customer: cust.ID, Plan: p2.ID}, 1},
+		{SubscriptionListParams{Customer: cust.ID, Status: SubscriptionTrialing}, 1},
+	}
+	for _, test := range tests {
+		subs, err := Subscriptions.ListFiltered(&test.params, 10, 0)
+		if err != nil {
+			t.Errorf("Expected Subscriptions, got error %s", err.Error())
+		} else if len(subs) != test.count {
+			t.Errorf("Expected %d Subscriptions for %+v, got %d", test.count, test.params, len(subs))
+		}
+	}
+
+	// Canceled Subscriptions are only listed when asked for
+	Subscriptions.CancelByID(sub.ID)
+	subs, _ := Subscriptions.CustomerList(cust.ID)
+	if len(subs) != 1 {
+		t.Errorf("Expected %d Subscriptions, got %d", 1, len(subs))
+	}
+	subs, _ = Subscriptions.ListFiltered(&SubscriptionListParams{Customer: cust.ID, Status: "all"}, 10, 0)
+	if len(subs) != 2 {
+		t.Errorf("Expected %d Subscriptions, got %d", 2, len(subs))
+	}
+}
+
 func TestCancelSubscription(t *testing.T) {
 	// Create the customer, and defer its deletion
 	cust, _ := Customers.Create(&cust1)
@@ -150,18 +254,20 @@ func TestCancelSubscription(t *testing.T) {
 
 	// Create the plan, and defer its deletion
 	Plans.Create(&p1)
-	defer Customers.Delete(p1.ID)
+	defer Plans.Delete(p1.ID)
 
 	// Subscribe the Customer to the Plan
-	_, err := Subscriptions.Update(cust.ID, &sub1)
+	sub, err := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: p1.ID})
 	if err != nil {
 		t.Errorf("Expected Subscription, got error %s", err.Error())
+		return
 	}
 
 	// Now cancel the subscription
-	subs, err := Subscriptions.Cancel(cust.ID)
+	subs, err := Subscriptions.CancelByID(sub.ID)
 	if err != nil {
 		t.Errorf("Expected Subscription Cancellation, got error %s", err.Error())
+		return
 	}
 
 	if subs.Status != SubscriptionCanceled {
@@ -176,25 +282,83 @@ func TestCancelSubscriptionAtPeriodEnd(t *testing.T) {
 
 	// Create the plan, and defer its deletion
 	Plans.Create(&p1)
-	defer Customers.Delete(p1.ID)
+	defer Plans.Delete(p1.ID)
 
 	// Subscribe the Customer to the Plan
-	_, err := Subscriptions.Update(cust.ID, &sub1)
+	sub, err := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: p1.ID})
 	if err != nil {
 		t.Errorf("Expected Subscription, got error %s", err.Error())
+		return
 	}
 
 	// Now cancel the subscription
-	subs, err := Subscriptions.CancelAtPeriodEnd(cust.ID)
+	subs, err := Subscriptions.CancelAtPeriodEndByID(sub.ID)
 	if err != nil {
 		t.Errorf("Expected Subscription Cancellation, got error %s", err.Error())
+		return
 	}
 
 	if subs.Status != SubscriptionActive {
-		t.Errorf("Expected Subscription Status %s, got %s", SubscriptionCanceled, subs.Status)
+		t.Errorf("Expected Subscription Status %s, got %s", SubscriptionActive, subs.Status)
 	}
 
 	if subs.CancelAtPeriodEnd != true {
-		t.Errorf("Expected CancelAtPeriodEnd to be %s, got %s", true, subs.CancelAtPeriodEnd)
+		t.Errorf("Expected CancelAtPeriodEnd to be %v, got %v", true, subs.CancelAtPeriodEnd)
+	}
+}
+
+// TestCustomerSubscription will test that the deprecated customer scoped
+// methods act on the Customer's only Subscription, and refuse to guess when
+// there is none or there are several.
+func TestCustomerSubscription(t *testing.T) {
+	// Create the customer, and defer its deletion
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+
+	// Create the plans, and defer their deletion
+	Plans.Create(&p1)
+	defer Plans.Delete(p1.ID)
+	Plans.Create(&p2)
+	defer Plans.Delete(p2.ID)
+
+	// Without a Subscription, Update does not subscribe the Customer
+	if _, err := Subscriptions.Update(cust.ID, &SubscriptionParams{Plan: p1.ID}); err == nil {
+		t.Error("Expected Error updating the Subscription of a Customer without one")
+	}
+	if subs, _ := Subscriptions.CustomerList(cust.ID); len(subs) != 0 {
+		t.Errorf("Expected no Subscriptions, got %d", len(subs))
+	}
+
+	// With one, Update changes its Plan
+	sub, _ := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: p1.ID})
+	resp, err := Subscriptions.Update(cust.ID, &SubscriptionParams{Plan: p2.ID})
+	if err != nil {
+		t.Errorf("Expected Subscription, got error %s", err.Error())
+		return
+	}
+	if resp.ID != sub.ID || resp.Plan.ID != p2.ID {
+		t.Errorf("Expected Subscription %s to %s, got %s to %v", sub.ID, p2.ID, resp.ID, resp.Plan)
+	}
+
+	// With several, none of them is changed
+	other, _ := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: p1.ID})
+	if _, err := Subscriptions.Cancel(cust.ID); err == nil {
+		t.Error("Expected Error canceling the Subscription of a Customer with several")
+	}
+	if _, err := Subscriptions.CancelAtPeriodEnd(cust.ID); err == nil {
+		t.Error("Expected Error canceling the Subscription of a Customer with several")
+	}
+	Subscriptions.CancelByID(other.ID)
+
+	resp, err = Subscriptions.Cancel(cust.ID)
+	if err != nil {
+		t.Errorf("Expected Subscription Cancellation, got error %s", err.Error())
+		return
+	}
+	if resp.ID != sub.ID || resp.Status != SubscriptionCanceled {
+		t.Errorf("Expected Subscription %s to be canceled, got %s %s", sub.ID, resp.ID, resp.Status)
+	}
+	if _, err := Subscriptions.CancelAtPeriodEnd(cust.ID); err == nil {
+		t.Error("Expected Error canceling the Subscription of a Customer without one")
 	}
 }
@@ -21,30 +21,47 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
+	"encoding/json"
 	"net/url"
 )
 
 // Token represents a unique identifier for a credit card that can be safely
 // stored without having to hold sensitive card information on your own servers.
 type Token struct {
-	ID       string  `json:"id"`
-	Amount   float64 `json:"amount"`
-	Currency string  `json:"currency"`
-	Created  int64   `json:"created"`
-	Used     bool    `json:"used"`
-	Livemode bool    `json:"livemode"`
-	Type     string  `json:"type"`
-	Card     *Card   `json:"card"`
+	ID       string `json:"id"`
+	Amount   Money  `json:"amount"`
+	Currency string `json:"currency"`
+	Created  int64  `json:"created"`
+	Used     bool   `json:"used"`
+	Livemode bool   `json:"livemode"`
+	Type     string `json:"type"`
+	Card     *Card  `json:"card"`
+}
+
+func (self *Token) UnmarshalJSON(data []byte) error {
+	type token Token
+	if err := json.Unmarshal(data, (*token)(self)); err != nil {
+		return err
+	}
+	setCurrency(self.Currency, &self.Amount)
+	return nil
 }
 
 // TokenClient encapsulates operations for creating and querying tokens using
 // the Bhojpur Subscription REST API.
-type TokenClient struct{}
+type TokenClient struct {
+	client *Client
+}
 
 // TokenParams encapsulates options for creating a new Card Token.
 type TokenParams struct {
 	//Currency string REMOVED! no longer part of the API
 	Card *CardParams
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
 }
 
 // Creates a single use token that wraps the details of a credit card.
@@ -52,18 +69,28 @@ type TokenParams struct {
 // These tokens can only be used once: by creating a new charge object, or
 // attaching them to a customer.
 func (self *TokenClient) Create(params *TokenParams) (*Token, error) {
+	return self.CreateCtx(context.Background(), params)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *TokenClient) CreateCtx(ctx context.Context, params *TokenParams) (*Token, error) {
 	token := Token{}
 	values := url.Values{} // REMOVED "currency": {params.Currency}}
 	appendCardParamsToValues(params.Card, &values)
 
-	err := query("POST", "/v1/tokens", values, &token)
+	err := self.client.queryIdempotent(ctx, "POST", "/v1/tokens", params.IdempotencyKey, values, &token)
 	return &token, err
 }
 
 // Retrieves the card token with the given Id.
 func (self *TokenClient) Retrieve(id string) (*Token, error) {
+	return self.RetrieveCtx(context.Background(), id)
+}
+
+// RetrieveCtx is like Retrieve, but uses ctx for the API request.
+func (self *TokenClient) RetrieveCtx(ctx context.Context, id string) (*Token, error) {
 	token := Token{}
 	path := "/v1/tokens/" + url.QueryEscape(id)
-	err := query("GET", path, nil, &token)
+	err := self.client.query(ctx, "GET", path, nil, &token)
 	return &token, err
 }
@@ -25,14 +25,6 @@ import (
 	"time"
 )
 
-func init() {
-	// In order to execute Unit Test, you must set your Bhojpur Subscription API Key
-	// as environment variable, BHOJPUR_API_KEY=xxxx
-	if err := SetKeyEnv(); err != nil {
-		panic(err)
-	}
-}
-
 // Sample Tokens to use when creating tokens
 var (
 
@@ -58,7 +50,7 @@ func TestCreateToken(t *testing.T) {
 	if err != nil {
 		t.Errorf("Expected Token Created, got Error %s", err.Error())
 	}
-	if resp.Amount != 0 {
+	if !resp.Amount.IsZero() {
 		t.Errorf("Expected Token Amount 0, got %v", resp.Amount)
 	}
 	if resp.Used == true {
@@ -79,7 +71,7 @@ func TestCreateToken(t *testing.T) {
 		t.Errorf("Expected Token Card ExpYear %d, got %d", token1.Card.ExpYear, resp.Card.ExpYear)
 	}
 	if resp.Card.Last4 != "4242" {
-		t.Errorf("Expected Token Card Last4 4242, got %d", resp.Card.Last4)
+		t.Errorf("Expected Token Card Last4 4242, got %s", resp.Card.Last4)
 	}
 }
 
@@ -0,0 +1,165 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Usage Record Actions
+const (
+	// UsageRecordIncrement adds the quantity to any usage already reported
+	// at the same timestamp.
+	UsageRecordIncrement = "increment"
+
+	// UsageRecordSet replaces any usage already reported at the same
+	// timestamp with the quantity.
+	UsageRecordSet = "set"
+)
+
+// UsageRecord represents a quantity of usage reported against a subscription
+// to a metered plan.
+type UsageRecord struct {
+	ID           string `json:"id"`
+	Quantity     int64  `json:"quantity"`
+	Subscription string `json:"subscription"`
+	Timestamp    int64  `json:"timestamp"`
+	Livemode     bool   `json:"livemode"`
+}
+
+// UsageRecordSummary represents the usage of a subscription to a metered plan
+// over one billing period, combined using the plan's AggregateUsage mode.
+type UsageRecordSummary struct {
+	ID           string  `json:"id"`
+	Invoice      String  `json:"invoice"`
+	Period       *Period `json:"period"`
+	Subscription string  `json:"subscription"`
+	TotalUsage   int64   `json:"total_usage"`
+	Livemode     bool    `json:"livemode"`
+}
+
+// UsageRecordParams encapsulates options for reporting usage.
+type UsageRecordParams struct {
+	// The usage quantity for the timestamp.
+	Quantity int64
+
+	// (Optional) UTC integer timestamp of the usage. Defaults to the time of
+	// the request.
+	Timestamp int64
+
+	// (Optional) Either UsageRecordIncrement, the default, or UsageRecordSet.
+	Action string
+
+	// (Optional) A unique key that makes the request safe to retry. When left
+	// blank, a random key is generated for every call.
+	IdempotencyKey string
+}
+
+// listUsageRecordSummariesResp is the wrapper for a list of Usage Record
+// Summaries, so that we can cleanly parse the JSON.
+type listUsageRecordSummariesResp struct {
+	ListMeta
+	Data []*UsageRecordSummary `json:"data"`
+}
+
+// UsageRecordClient encapsulates operations for reporting and querying the
+// usage of metered subscriptions using the Bhojpur Subscription REST API.
+type UsageRecordClient struct {
+	client *Client
+}
+
+// Create reports usage against the subscription with the given ID, which must
+// be to a metered plan.
+func (self *UsageRecordClient) Create(subscriptionId string, params *UsageRecordParams) (*UsageRecord, error) {
+	return self.CreateCtx(context.Background(), subscriptionId, params)
+}
+
+// CreateCtx is like Create, but uses ctx for the API request.
+func (self *UsageRecordClient) CreateCtx(ctx context.Context, subscriptionId string, params *UsageRecordParams) (*UsageRecord, error) {
+	values := url.Values{
+		"quantity": {strconv.FormatInt(params.Quantity, 10)},
+	}
+
+	// add optional parameters
+	if params.Timestamp != 0 {
+		values.Add("timestamp", strconv.FormatInt(params.Timestamp, 10))
+	}
+	if params.Action != "" {
+		values.Add("action", params.Action)
+	}
+
+	record := UsageRecord{}
+	path := "/v1/subscriptions/" + url.QueryEscape(subscriptionId) + "/usage_records"
+	err := self.client.queryIdempotent(ctx, "POST", path, params.IdempotencyKey, values, &record)
+	return &record, err
+}
+
+// Summaries returns the usage of the subscription with the given ID for each
+// of its billing periods, newest first.
+func (self *UsageRecordClient) Summaries(subscriptionId string) ([]*UsageRecordSummary, error) {
+	return self.SummariesCtx(context.Background(), subscriptionId)
+}
+
+// SummariesCtx is like Summaries, but uses ctx for the API request.
+func (self *UsageRecordClient) SummariesCtx(ctx context.Context, subscriptionId string) ([]*UsageRecordSummary, error) {
+	resp := listUsageRecordSummariesResp{}
+	path := "/v1/subscriptions/" + url.QueryEscape(subscriptionId) + "/usage_record_summaries"
+	err := self.client.query(ctx, "GET", path, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// SummariesIter returns an iterator that lazily pages through the usage of the
+// subscription with the given ID for each of its billing periods, starting at
+// the cursor in params, if any.
+func (self *UsageRecordClient) SummariesIter(subscriptionId string, params *ListParams) *UsageRecordSummaryIter {
+	return self.SummariesIterCtx(context.Background(), subscriptionId, params)
+}
+
+// SummariesIterCtx is like SummariesIter, but uses ctx for every API request.
+func (self *UsageRecordClient) SummariesIterCtx(ctx context.Context, subscriptionId string, params *ListParams) *UsageRecordSummaryIter {
+	path := "/v1/subscriptions/" + url.QueryEscape(subscriptionId) + "/usage_record_summaries"
+	return &UsageRecordSummaryIter{newIter(params, url.Values{}, func(values url.Values) ([]interface{}, ListMeta, error) {
+		resp := listUsageRecordSummariesResp{}
+		err := self.client.query(ctx, "GET", path, values, &resp)
+		items := make([]interface{}, len(resp.Data))
+		for i, summary := range resp.Data {
+			items[i] = summary
+		}
+		return items, resp.ListMeta, err
+	})}
+}
+
+// UsageRecordSummaryIter is an iterator over a list of Usage Record Summaries.
+type UsageRecordSummaryIter struct {
+	*Iter
+}
+
+// Current returns the Usage Record Summary at the current position of the
+// iterator.
+func (it *UsageRecordSummaryIter) Current() *UsageRecordSummary {
+	summary, _ := it.Iter.Current().(*UsageRecordSummary)
+	return summary
+}
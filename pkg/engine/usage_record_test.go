@@ -0,0 +1,113 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+	"time"
+)
+
+// Sample metered Plan to report usage against.
+var pMetered = PlanParams{
+	ID:        "plan_metered",
+	Name:      "metered plan",
+	Amount:    Money{Amount: 25, Currency: INR},
+	Interval:  IntervalMonth,
+	UsageType: UsageMetered,
+}
+
+// TestCreateUsageRecord will test that usage reported against a metered
+// Subscription is combined per timestamp, summarised per period, and billed
+// on the upcoming invoice.
+func TestCreateUsageRecord(t *testing.T) {
+	// Create the customer, plan and subscription, and defer their deletion
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+	plan, err := Plans.Create(&pMetered)
+	if err != nil {
+		t.Errorf("Expected Plan, got Error %s", err.Error())
+		return
+	}
+	defer Plans.Delete(pMetered.ID)
+	if plan.UsageType != UsageMetered || plan.AggregateUsage != AggregateUsageSum {
+		t.Errorf("Expected metered Plan with sum aggregate usage, got %s and %s", plan.UsageType, plan.AggregateUsage)
+	}
+	sub, _ := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: pMetered.ID})
+
+	// Report usage, which is added up at the same timestamp unless set
+	now := time.Now().Unix()
+	UsageRecords.Create(sub.ID, &UsageRecordParams{Quantity: 10, Timestamp: now})
+	record, err := UsageRecords.Create(sub.ID, &UsageRecordParams{Quantity: 5, Timestamp: now})
+	if err != nil {
+		t.Errorf("Expected Usage Record, got Error %s", err.Error())
+		return
+	}
+	if record.Quantity != 15 {
+		t.Errorf("Expected Quantity %d, got %d", 15, record.Quantity)
+	}
+	UsageRecords.Create(sub.ID, &UsageRecordParams{Quantity: 3, Timestamp: now + 1})
+	record, _ = UsageRecords.Create(sub.ID, &UsageRecordParams{Quantity: 7, Timestamp: now + 1, Action: UsageRecordSet})
+	if record.Quantity != 7 {
+		t.Errorf("Expected Quantity %d, got %d", 7, record.Quantity)
+	}
+
+	summaries, err := UsageRecords.Summaries(sub.ID)
+	if err != nil {
+		t.Errorf("Expected Usage Record Summaries, got Error %s", err.Error())
+		return
+	}
+	if len(summaries) != 1 || summaries[0].TotalUsage != 22 {
+		t.Errorf("Expected one Summary with Total Usage %d, got %v", 22, summaries)
+	}
+
+	// The upcoming invoice bills the usage of the current period
+	invoice, err := Invoices.RetrieveCustomer(cust.ID)
+	if err != nil {
+		t.Errorf("Expected upcoming Invoice, got Error %s", err.Error())
+		return
+	}
+	if len(invoice.Lines.Subscriptions) != 1 {
+		t.Errorf("Expected %d Subscription line, got %d", 1, len(invoice.Lines.Subscriptions))
+		return
+	}
+	line := invoice.Lines.Subscriptions[0]
+	if line.Quantity != 22 || line.Amount.Amount != 550 {
+		t.Errorf("Expected line for %d units of %d, got %d for %v", 22, 550, line.Quantity, line.Amount)
+	}
+	if line.Period.Start != int64(sub.CurrentPeriodStart) {
+		t.Errorf("Expected line for the period starting at %d, got %d", sub.CurrentPeriodStart, line.Period.Start)
+	}
+}
+
+// TestCreateUsageRecordLicensed will test that usage can only be reported
+// against Subscriptions to metered Plans.
+func TestCreateUsageRecordLicensed(t *testing.T) {
+	cust, _ := Customers.Create(&cust1)
+	defer Customers.Delete(cust.ID)
+	Plans.Create(&p1)
+	defer Plans.Delete(p1.ID)
+	sub, _ := Subscriptions.Create(&SubscriptionParams{Customer: cust.ID, Plan: p1.ID})
+
+	_, err := UsageRecords.Create(sub.ID, &UsageRecordParams{Quantity: 1})
+	if err == nil {
+		t.Error("Expected non-null Error when reporting usage for a licensed Plan.")
+	}
+}
@@ -0,0 +1,137 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maximum size of a webhook request body
+const maxWebhookBody = 1 << 20
+
+// EventHandler handles an Event of a single type. Returning an error tells
+// Bhojpur Subscription that the webhook failed, so it is delivered again.
+type EventHandler func(ctx context.Context, e *Event) error
+
+// WebhookMux is an http.Handler that verifies the signature of webhook
+// requests and dispatches each Event to the handler registered for its type.
+// Events without a registered handler are acknowledged and ignored.
+type WebhookMux struct {
+	secret string
+
+	mu        sync.RWMutex
+	tolerance time.Duration
+	logger    *log.Logger
+	handlers  map[string][]EventHandler
+}
+
+// NewWebhookMux returns a WebhookMux that verifies requests using the signing
+// secret of the webhook endpoint.
+func NewWebhookMux(secret string) *WebhookMux {
+	return &WebhookMux{
+		secret:    secret,
+		tolerance: DefaultTolerance,
+		handlers:  make(map[string][]EventHandler),
+	}
+}
+
+// SetTolerance overrides the maximum age of an accepted webhook request. A
+// tolerance of zero disables the check.
+func (self *WebhookMux) SetTolerance(tolerance time.Duration) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.tolerance = tolerance
+}
+
+// SetLogger sets the logger that handler errors are written to. By default,
+// they are written to the standard logger of the log package.
+func (self *WebhookMux) SetLogger(logger *log.Logger) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.logger = logger
+}
+
+// Handle registers the handler for Events of the given type, such as
+// EventInvoicePaymentFailed. Several handlers may be registered for the same
+// type; they are called in the order they were registered.
+func (self *WebhookMux) Handle(eventType string, handler EventHandler) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.handlers[eventType] = append(self.handlers[eventType], handler)
+}
+
+// Dispatch calls the handlers registered for the type of the Event, stopping
+// at the first error. It may be used to replay Events that were not received
+// as webhooks.
+func (self *WebhookMux) Dispatch(ctx context.Context, e *Event) error {
+	self.mu.RLock()
+	handlers := self.handlers[e.Type]
+	self.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP verifies and dispatches a single webhook request. It responds
+// with 400 if the request cannot be verified, and 500 if a handler fails. The
+// error of a failed handler is logged, but not included in the response.
+func (self *WebhookMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	self.mu.RLock()
+	tolerance, logger := self.tolerance, self.logger
+	self.mu.RUnlock()
+
+	event, err := ConstructEventWithTolerance(payload, r.Header.Get(SignatureHeader), self.secret, tolerance)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := self.Dispatch(r.Context(), event); err != nil {
+		if logger == nil {
+			logger = log.Default()
+		}
+		logger.Printf("engine: webhook handler for %s event %s failed: %s", event.Type, event.ID, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,94 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWebhookMux will test that a verified webhook request is dispatched to
+// the handlers registered for its Event type, and only to those.
+func TestWebhookMux(t *testing.T) {
+	var failed, deleted int
+	mux := NewWebhookMux(whsecret)
+	mux.Handle(EventInvoicePaymentFailed, func(ctx context.Context, e *Event) error {
+		failed++
+		if _, ok := e.Data.Object.(*Invoice); !ok {
+			t.Errorf("Expected *Invoice, got %T", e.Data.Object)
+		}
+		return nil
+	})
+	mux.Handle(EventCustomerSubscriptionDeleted, func(ctx context.Context, e *Event) error {
+		deleted++
+		return nil
+	})
+
+	send := func(payload []byte, header string) int {
+		r := httptest.NewRequest("POST", "/webhook", bytes.NewReader(payload))
+		r.Header.Set(SignatureHeader, header)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := send(invoiceEvent, SignPayload(invoiceEvent, whsecret, time.Now())); code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := send(invoiceEvent, SignPayload(invoiceEvent, "whsec_other", time.Now())); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, code)
+	}
+	if failed != 1 || deleted != 0 {
+		t.Errorf("Expected 1 invoice.payment_failed and 0 customer.subscription.deleted, got %d and %d", failed, deleted)
+	}
+}
+
+// TestWebhookMuxError will test that a failing handler results in a 500, so
+// the webhook is delivered again.
+func TestWebhookMuxError(t *testing.T) {
+	var logged bytes.Buffer
+	mux := NewWebhookMux(whsecret)
+	mux.SetLogger(log.New(&logged, "", 0))
+	mux.Handle(EventInvoicePaymentFailed, func(ctx context.Context, e *Event) error {
+		return errors.New("database unavailable")
+	})
+
+	r := httptest.NewRequest("POST", "/webhook", bytes.NewReader(invoiceEvent))
+	r.Header.Set(SignatureHeader, SignPayload(invoiceEvent, whsecret, time.Now()))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if strings.Contains(w.Body.String(), "database") {
+		t.Errorf("Expected generic error response, got %q", w.Body.String())
+	}
+	if !strings.Contains(logged.String(), "database unavailable") {
+		t.Errorf("Expected handler error to be logged, got %q", logged.String())
+	}
+}
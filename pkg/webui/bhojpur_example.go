@@ -81,10 +81,9 @@ func paymentHandler(w http.ResponseWriter, r *http.Request) {
 
 	params := engine.ChargeParams{
 		Desc: "Litti Chokha",
-		// Amount as an integer: 2000 = $20.00
-		Amount:   2000,
-		Currency: "INR",
-		Token:    r.PostFormValue("bhojpurToken"),
+		// Amount in paisa: 2000 = ₹20.00
+		Amount: engine.Money{Amount: 2000, Currency: engine.INR},
+		Token:  r.PostFormValue("bhojpurToken"),
 	}
 
 	_, err = engine.Charges.Create(&params)